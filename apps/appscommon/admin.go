@@ -0,0 +1,191 @@
+package appscommon
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"lumelpkg/common"
+	"lumelpkg/config"
+	"lumelpkg/db"
+	"lumelpkg/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultLogSearchLimit caps a log search that does not set limit
+const defaultLogSearchLimit = 1000
+
+// AdminSettings is the [Admin] section of appconfig.toml
+type AdminSettings struct {
+	Token string `validate:"required" secret:"true"` // usually a secret reference such as "env:ADMIN_TOKEN"
+}
+
+// AdminOnly is a mux middleware that only lets requests through when they carry the
+// admin token from appconfig.toml, either as "Authorization: Bearer <token>" or in
+// the X-Admin-Token header. Without a configured token every admin request is refused.
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
+		log := utils.ContextLogger(lHttpRequest.Context())
+
+		var lSettings AdminSettings
+		if lErr := config.GetAndAssignTomlValue("appconfig", "Admin", &lSettings); lErr != nil || lSettings.Token == "" {
+			log.Log(common.ERROR, "AdminOnly", "Admin token is not configured, refusing "+lHttpRequest.URL.Path)
+			http.Error(lHttpWriter, "admin access is not configured", http.StatusForbidden)
+			return
+		}
+
+		lToken := lHttpRequest.Header.Get("X-Admin-Token")
+		if lBearer, ok := strings.CutPrefix(lHttpRequest.Header.Get("Authorization"), "Bearer "); ok {
+			lToken = lBearer
+		}
+		if subtle.ConstantTimeCompare([]byte(lToken), []byte(lSettings.Token)) != 1 {
+			log.Log(common.ERROR, "AdminOnly", "Invalid admin token for "+lHttpRequest.URL.Path)
+			http.Error(lHttpWriter, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(lHttpWriter, lHttpRequest)
+	})
+}
+
+// InspectConfig returns the effective configuration with the source of each value,
+// the last reload time and a hash per file. Sensitive values are masked.
+func InspectConfig(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
+	// Logger of this request, set up by RequestLogger
+	log := utils.ContextLogger(lHttpRequest.Context())
+	log.Log(common.INFO, "InspectConfig", "Started")
+
+	lHttpWriter.Header().Set("Access-Control-Allow-Origin", "*")
+	lHttpWriter.Header().Set("Access-Control-Allow-Credentials", "true")
+	lHttpWriter.Header().Set("Access-Control-Allow-Methods", http.MethodGet)
+	lHttpWriter.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Admin-Token")
+
+	var lRespRec common.CommonResp
+	if strings.EqualFold(http.MethodGet, lHttpRequest.Method) {
+		lRespRec.DetailsArr = config.Inspect()
+		lRespRec.Status = common.SuccessCode
+	}
+	CompleteAndMarshall(log, lRespRec, lHttpWriter)
+	log.Log(common.INFO, "InspectConfig", "Finished")
+}
+
+// DatabaseStats returns, per logical database, the connection pool statistics
+// (open, in use, idle, waits) and the query metrics collected by the db package.
+func DatabaseStats(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
+	log := utils.ContextLogger(lHttpRequest.Context())
+	log.Log(common.INFO, "DatabaseStats", "Started")
+
+	lHttpWriter.Header().Set("Access-Control-Allow-Origin", "*")
+	lHttpWriter.Header().Set("Access-Control-Allow-Credentials", "true")
+	lHttpWriter.Header().Set("Access-Control-Allow-Methods", http.MethodGet)
+	lHttpWriter.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Admin-Token")
+
+	var lRespRec common.CommonResp
+	if strings.EqualFold(http.MethodGet, lHttpRequest.Method) {
+		lRespRec.DetailsArr = db.Stats()
+		lRespRec.Status = common.SuccessCode
+	}
+	CompleteAndMarshall(log, lRespRec, lHttpWriter)
+	log.Log(common.INFO, "DatabaseStats", "Finished")
+}
+
+// SearchLogs streams the log entries matching the query parameters, oldest first and
+// rotated files included, one per line: JSON (application/x-ndjson) by default, text with
+// format=text. Parameters: reqId, level (minimum), step (substring), since and until
+// (see utils.ParseLogTime), limit (1000 by default, 0 for all) and follow=true to keep the
+// response open for new entries.
+func SearchLogs(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
+	log := utils.ContextLogger(lHttpRequest.Context())
+	log.Log(common.INFO, "SearchLogs", "Started")
+
+	lHttpWriter.Header().Set("Access-Control-Allow-Origin", "*")
+	lHttpWriter.Header().Set("Access-Control-Allow-Credentials", "true")
+	lHttpWriter.Header().Set("Access-Control-Allow-Methods", http.MethodGet)
+	lHttpWriter.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Admin-Token")
+
+	lQuery, lText, lErr := logQueryFrom(lHttpRequest)
+	if lErr != nil {
+		log.Log(common.ERROR, "SearchLogs", lErr.Error())
+		CompleteAndMarshall(log, common.CommonResp{
+			Status:   common.ErrorCode,
+			ErrMsg:   lErr.Error(),
+			ErrClass: common.ErrClassInvalid,
+			ErrCode:  http.StatusBadRequest,
+		}, lHttpWriter)
+		return
+	}
+
+	if lText {
+		lHttpWriter.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		lHttpWriter.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	lFlusher, _ := lHttpWriter.(http.Flusher)
+	lHttpWriter.WriteHeader(http.StatusOK)
+
+	lCount := 0
+	lErr = utils.SearchLogs(lHttpRequest.Context(), utils.LogDir(), lQuery, func(pRecord utils.LogRecord) error {
+		lLine := []byte(pRecord.Text())
+		if !lText {
+			var lErr error
+			if lLine, lErr = json.Marshal(pRecord); lErr != nil {
+				return lErr
+			}
+		}
+		if _, lErr := lHttpWriter.Write(append(lLine, '\n')); lErr != nil {
+			return lErr
+		}
+		lCount++
+		if lQuery.Follow && lFlusher != nil {
+			lFlusher.Flush()
+		}
+		return nil
+	})
+	if lErr != nil {
+		log.Log(common.ERROR, "SearchLogs", lErr.Error())
+	}
+	log.Log(common.INFO, "SearchLogs", "Finished", utils.F("records", lCount))
+}
+
+// logQueryFrom reads the search filters from the URL; lText is set for format=text.
+func logQueryFrom(pHttpRequest *http.Request) (lQuery utils.LogQuery, lText bool, lErr error) {
+	lValues := pHttpRequest.URL.Query()
+	lNow := time.Now()
+
+	lQuery.ReqID = lValues.Get("reqId")
+	lQuery.Step = lValues.Get("step")
+	lQuery.Level = strings.ToUpper(lValues.Get("level"))
+	switch lQuery.Level {
+	case "", common.DEBUG, common.INFO, common.ERROR:
+	default:
+		return lQuery, false, fmt.Errorf("invalid level %q, use DEBUG, INFO or ERROR", lQuery.Level)
+	}
+	if lQuery.Since, lErr = utils.ParseLogTime(lValues.Get("since"), lNow); lErr != nil {
+		return lQuery, false, lErr
+	}
+	if lQuery.Until, lErr = utils.ParseLogTime(lValues.Get("until"), lNow); lErr != nil {
+		return lQuery, false, lErr
+	}
+
+	lQuery.Limit = defaultLogSearchLimit
+	if lLimit := lValues.Get("limit"); lLimit != "" {
+		if lQuery.Limit, lErr = strconv.Atoi(lLimit); lErr != nil || lQuery.Limit < 0 {
+			return lQuery, false, fmt.Errorf("invalid limit %q", lLimit)
+		}
+	}
+	if lFollow := lValues.Get("follow"); lFollow != "" {
+		if lQuery.Follow, lErr = strconv.ParseBool(lFollow); lErr != nil {
+			return lQuery, false, fmt.Errorf("invalid follow %q", lFollow)
+		}
+	}
+
+	switch lValues.Get("format") {
+	case "", "json":
+	case "text":
+		lText = true
+	default:
+		return lQuery, false, fmt.Errorf("invalid format %q, use json or text", lValues.Get("format"))
+	}
+	return lQuery, lText, nil
+}
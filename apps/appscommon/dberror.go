@@ -0,0 +1,34 @@
+package appscommon
+
+import (
+	"context"
+	"errors"
+	"lumelpkg/common"
+	"lumelpkg/db"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// SetErrorStatus records on pResp the class and HTTP status matching an error coming back from
+// the DB layer: 503 Service Unavailable when the database is down or the request was rejected
+// by a circuit breaker or bulkhead (with a Retry-After hint), 504 Gateway Timeout when a query
+// ran past its timeout (see db.WithTimeout), 500 Internal Server Error otherwise.
+// CompleteAndMarshall writes the status together with the body.
+func SetErrorStatus(lHttpWriter http.ResponseWriter, pResp *common.CommonResp, pErr error) {
+	var lRejected *db.RejectedError
+	if errors.As(pErr, &lRejected) {
+		lHttpWriter.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lRejected.RetryAfter.Seconds()))))
+	}
+
+	switch {
+	case lRejected != nil:
+		pResp.ErrClass, pResp.ErrCode = common.ErrClassRejected, http.StatusServiceUnavailable
+	case errors.Is(pErr, db.ErrDBUnavailable):
+		pResp.ErrClass, pResp.ErrCode = common.ErrClassUnavailable, http.StatusServiceUnavailable
+	case errors.Is(pErr, context.DeadlineExceeded):
+		pResp.ErrClass, pResp.ErrCode = common.ErrClassTimeout, http.StatusGatewayTimeout
+	default:
+		pResp.ErrClass, pResp.ErrCode = common.ErrClassInternal, http.StatusInternalServerError
+	}
+}
@@ -2,15 +2,15 @@ package appscommon
 
 import (
 	"lumelpkg/common"
+	"lumelpkg/db"
 	"lumelpkg/utils"
 	"net/http"
 	"strings"
 )
 
 func Ready(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
-	// Initialize logger with a unique request ID for tracing
-	log := new(utils.Logger)
-	log.SetReqID()
+	// Logger of this request, set up by RequestLogger
+	log := utils.ContextLogger(lHttpRequest.Context())
 	log.Log(common.INFO, "Ready", "Started")
 	// Set HTTP headers for CORS and request handling
 	lHttpWriter.Header().Set("Access-Control-Allow-Origin", "*")
@@ -19,8 +19,14 @@ func Ready(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
 	lHttpWriter.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, credentials")
 
 	if strings.EqualFold(lHttpRequest.Method, http.MethodGet) {
-		log.Log(common.DEBUG, "STATUS => ", http.StatusOK)
-		lHttpWriter.WriteHeader(http.StatusOK)
+		// Not ready while the order database is down
+		if _, lErr := db.GetDB(db.SQLDB); lErr != nil {
+			log.Log(common.ERROR, "STATUS => ", http.StatusServiceUnavailable, lErr.Error())
+			lHttpWriter.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			log.Log(common.DEBUG, "STATUS => ", http.StatusOK)
+			lHttpWriter.WriteHeader(http.StatusOK)
+		}
 	}
 	log.Log(common.INFO, "Ready", "Finished")
 
@@ -0,0 +1,21 @@
+package appscommon
+
+import (
+	"lumelpkg/utils"
+	"net/http"
+)
+
+// RequestLogger is a mux middleware that gives every request one logger. Its ReqID is the
+// inbound X-Request-ID or X-Correlation-ID when present (see Logger.SetSid), it is stored in
+// the request context for the handlers and everything they call (utils.ContextLogger), and
+// it is echoed in the X-Request-ID response header.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
+		log := new(utils.Logger)
+		log.SetSid(lHttpRequest)
+
+		lHttpWriter.Header().Set(utils.RequestIDHeader, log.ReqID)
+		lHttpWriter.Header().Add("Access-Control-Expose-Headers", utils.RequestIDHeader)
+		next.ServeHTTP(lHttpWriter, lHttpRequest.WithContext(utils.WithLogger(lHttpRequest.Context(), log)))
+	})
+}
@@ -1,18 +1,18 @@
 package appscommon
 
 import (
-	"log"
 	"lumelpkg/common"
 	"lumelpkg/config"
 	"lumelpkg/utils"
 	"net/http"
+	"strings"
 )
 
+// ResetToml re-reads the ./toml folder and swaps the active configuration.
+// If any file fails to parse the previous configuration is kept and an error is returned.
 func ResetToml(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
-	log.Println("ResetToml (+)")
-	// Initialize logger with a unique request ID for tracing
-	log := new(utils.Logger)
-	log.SetReqID()
+	// Logger of this request, set up by RequestLogger
+	log := utils.ContextLogger(lHttpRequest.Context())
 	log.Log(common.INFO, "ResetToml", "Started")
 
 	// Set HTTP headers for CORS and request handling
@@ -21,11 +21,19 @@ func ResetToml(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
 	lHttpWriter.Header().Set("Access-Control-Allow-Methods", "POST")
 	lHttpWriter.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, credentials")
 
-	if lHttpRequest.Method == http.MethodGet {
+	var lRespRec common.CommonResp
+	if strings.EqualFold(http.MethodPost, lHttpRequest.Method) {
 		// Global toml Values Read
-		config.Init(log)
+		if lErr := config.Reload(log); lErr != nil {
+			lRespRec.Status = common.ErrorCode
+			lRespRec.ErrMsg = lErr.Error()
+			log.Log(common.ERROR, "Error In Reload Config", lErr.Error())
+			lRespRec.ErrClass, lRespRec.ErrCode = common.ErrClassInternal, http.StatusInternalServerError
+			goto marshal
+		}
+		lRespRec.Status = common.SuccessCode
 	}
-	lHttpWriter.WriteHeader(200)
-
+marshal:
+	CompleteAndMarshall(log, lRespRec, lHttpWriter)
 	log.Log(common.INFO, "ResetToml", "Finished")
 }
@@ -100,15 +100,22 @@ func ValidateRequest(log *utils.Logger, pRequestData any, pHttpRequest *http.Req
    Author : VIJAY
    Created Date : 11-04-2025
 */
-// CompleteAndMarshall sends the final response
+// CompleteAndMarshall sends the final response with the status recorded in ErrCode, 200 when
+// unset. Handlers set ErrCode instead of calling WriteHeader, so the status is written once.
 func CompleteAndMarshall(log *utils.Logger, pResponseRec common.CommonResp, pHttpWriter http.ResponseWriter) {
 	log.Log(common.INFO, "CompleteAndMarshall (+)")
+	// Echo the request ID so a client can quote it when reporting a problem
+	pResponseRec.ReqID = log.ReqID
 	lData, lErr := json.Marshal(pResponseRec)
 	if lErr != nil {
 		http.Error(pHttpWriter, "Error marshaling response: "+lErr.Error(), http.StatusInternalServerError)
 		return
 	}
-	pHttpWriter.WriteHeader(http.StatusOK)
+	lStatus := http.StatusOK
+	if pResponseRec.ErrCode != 0 {
+		lStatus = pResponseRec.ErrCode
+	}
+	pHttpWriter.WriteHeader(lStatus)
 	pHttpWriter.Write(lData)
 	log.Log(common.INFO, "CompleteAndMarshall (-)")
 }
@@ -1,14 +1,30 @@
 package scheduler
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	ordercommon "lumelpkg/apps/orderManagement/common"
 	"lumelpkg/common"
+	"lumelpkg/config"
 	"lumelpkg/db"
 	"lumelpkg/utils"
 	"time"
 )
 
+// defaultInterval is used when appconfig.toml has no Scheduler section
+const defaultInterval = 24 * time.Hour
+
+// SchedulerSettings holds the CSV refresh interval read from appconfig.toml
+type SchedulerSettings struct {
+	IntervalMinutes int `validate:"gte=0"`
+}
+
+// RegisterConfigSchemas declares the appconfig.toml sections owned by the scheduler.
+func RegisterConfigSchemas() {
+	config.RegisterOptionalSchema[SchedulerSettings]("appconfig", "Scheduler")
+}
+
 func SchedularInit() {
 	log := new(utils.Logger)
 	log.SetReqID()
@@ -19,26 +35,54 @@ func SchedularInit() {
 	pDelimeter := ','
 
 	// Run immediately
-	lErr := LoadCSVFile(log, pFilePath, pDelimeter)
+	lRunCtx, lRunLog := newRunContext()
+	lErr := LoadCSVFile(lRunCtx, pFilePath, pDelimeter)
 	if lErr != nil {
-		log.Log(common.ERROR, "Error during initial data refresh:", lErr.Error())
+		lRunLog.Log(common.ERROR, "Error during initial data refresh:", lErr.Error())
 	}
 
-	// Set ticker to run every 24 hours
-	ticker := time.NewTicker(24 * time.Hour)
+	// Set ticker to the configured interval and follow changes on config reload
+	var lSettings SchedulerSettings
+	if lErr := config.GetAndAssignTomlValue("appconfig", "Scheduler", &lSettings); lErr != nil {
+		log.Log(common.ERROR, "SchedularInit", "Using default interval: "+lErr.Error())
+	}
+	ticker := time.NewTicker(schedulerInterval(lSettings))
 	defer ticker.Stop()
 
+	config.Watch("appconfig", "Scheduler", func(pOld, pNew SchedulerSettings) {
+		log.Log(common.INFO, "SchedularInit", fmt.Sprintf("Interval changed from %d to %d minutes", pOld.IntervalMinutes, pNew.IntervalMinutes))
+		ticker.Reset(schedulerInterval(pNew))
+	})
+
 	for range ticker.C {
-		log.Log(common.INFO, "Scheduled data refresh")
-		lErr := LoadCSVFile(log, pFilePath, pDelimeter)
+		lRunCtx, lRunLog := newRunContext()
+		lRunLog.Log(common.INFO, "Scheduled data refresh")
+		lErr := LoadCSVFile(lRunCtx, pFilePath, pDelimeter)
 		if lErr != nil {
-			log.Log(common.ERROR, "Error during scheduled data refresh:", lErr.Error())
+			lRunLog.Log(common.ERROR, "Error during scheduled data refresh:", lErr.Error())
 		}
 	}
 	// log.Log(common.INFO, "LoadCSVFile ", "Ended")
 }
 
-func LoadCSVFile(log *utils.Logger, pFilePath string, pDelimeter rune) error {
+// newRunContext gives each load its own ReqID, carried in the context like a request's.
+func newRunContext() (context.Context, *utils.Logger) {
+	log := new(utils.Logger)
+	log.SetReqID()
+	return utils.WithLogger(context.Background(), log), log
+}
+
+// schedulerInterval converts the configured minutes into a ticker duration.
+func schedulerInterval(pSettings SchedulerSettings) time.Duration {
+	if pSettings.IntervalMinutes <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(pSettings.IntervalMinutes) * time.Minute
+}
+
+// LoadCSVFile loads the order CSV in one transaction, logging with the logger carried in pCtx.
+func LoadCSVFile(pCtx context.Context, pFilePath string, pDelimeter rune) error {
+	log := utils.ContextLogger(pCtx)
 	log.Log(common.INFO, "LoadCSVFile ", "Started")
 
 	// Load CSV data to structure
@@ -48,63 +92,90 @@ func LoadCSVFile(log *utils.Logger, pFilePath string, pDelimeter rune) error {
 		return lErr
 	}
 
+	// Ingestion has its own bulkhead slots, busy reports do not hold it up
+	lRelease, lErr := db.Acquire(pCtx, db.ClassIngestion)
+	if lErr != nil {
+		log.Log(common.ERROR, "LoadCSVFile ", lErr.Error())
+		return lErr
+	}
+	defer lRelease()
+
+	lDb, lErr := db.Writer(db.SQLDB)
+	if lErr != nil {
+		log.Log(common.ERROR, "LoadCSVFile ", lErr.Error())
+		return lErr
+	}
+
+	// The whole file is one unit of work, a failing row leaves the tables as they were
+	lCtx, lCancel := db.WithTimeout(pCtx, db.ClassIngestion)
+	defer lCancel()
+
 	// Initialize instance
 	var lCustomerRec ordercommon.Customer
 	var lProductRec ordercommon.Product
 	var lOrderRec ordercommon.Order
 	var lOrderItemRec ordercommon.OrderItem
 
-	for _, record := range lCsvData {
-		lCustomerRec = ordercommon.Customer{
-			CustomerID:      record.CustomerID,
-			CustomerName:    record.CustomerName,
-			CustomerEmail:   record.CustomerEmail,
-			CustomerAddress: record.CustomerAddress,
-		}
-
-		lProductRec = ordercommon.Product{
-			ProductID:   record.ProductID,
-			ProductName: record.ProductName,
-			Category:    record.Category,
+	lErr = db.WithTx(lCtx, lDb, db.DefaultTxOptions, func(pTx *sql.Tx) error {
+		for _, record := range lCsvData {
+			lCustomerRec = ordercommon.Customer{
+				CustomerID:      record.CustomerID,
+				CustomerName:    record.CustomerName,
+				CustomerEmail:   record.CustomerEmail,
+				CustomerAddress: record.CustomerAddress,
+			}
+
+			lProductRec = ordercommon.Product{
+				ProductID:   record.ProductID,
+				ProductName: record.ProductName,
+				Category:    record.Category,
+			}
+
+			lOrderRec = ordercommon.Order{
+				OrderID:       record.OrderID,
+				CustomerID:    record.CustomerID,
+				Region:        record.Region,
+				DateOfSale:    record.DateOfSale,
+				ShippingCost:  record.ShippingCost,
+				PaymentMethod: record.PaymentMethod,
+			}
+
+			lOrderItemRec = ordercommon.OrderItem{
+				OrderID:   record.OrderID,
+				ProductID: record.ProductID,
+				Quantity:  record.Quantity,
+				UnitPrice: record.UnitPrice,
+				Discount:  record.Discount,
+			}
+
+			// Parents before children, orders and order_items reference the other tables
+			if lErr := InsertCustomer(lCtx, log, pTx, lCustomerRec); lErr != nil {
+				log.Log(common.ERROR, "LoadCSVFile ", "InsertCustomer ", lErr.Error())
+				return lErr
+			}
+			if lErr := InsertProducts(lCtx, log, pTx, lProductRec); lErr != nil {
+				log.Log(common.ERROR, "LoadCSVFile ", "InsertProducts ", lErr.Error())
+				return lErr
+			}
+			if lErr := InsertOrder(lCtx, log, pTx, lOrderRec); lErr != nil {
+				log.Log(common.ERROR, "LoadCSVFile ", "InsertOrder ", lErr.Error())
+				return lErr
+			}
+			if lErr := InsertOrderItem(lCtx, log, pTx, lOrderItemRec); lErr != nil {
+				log.Log(common.ERROR, "LoadCSVFile ", "InsertOrderItem ", lErr.Error())
+				return lErr
+			}
 		}
-
-		lOrderRec = ordercommon.Order{
-			OrderID:       record.OrderID,
-			CustomerID:    record.CustomerID,
-			Region:        record.Region,
-			DateOfSale:    record.DateOfSale,
-			ShippingCost:  record.ShippingCost,
-			PaymentMethod: record.PaymentMethod,
-		}
-
-		lOrderItemRec = ordercommon.OrderItem{
-			OrderID:   record.OrderID,
-			ProductID: record.ProductID,
-			Quantity:  record.Quantity,
-			UnitPrice: record.UnitPrice,
-			Discount:  record.Discount,
-		}
-
-	}
-	fmt.Printf("lCsvData %+v", lCustomerRec)
-	if lErr = InsertCustomer(log, lCustomerRec); lErr != nil {
-		log.Log(common.ERROR, "LoadCSVFile ", "InsertCustomer ", lErr.Error())
-		return lErr
-	}
-	if lErr = InsertOrder(log, lOrderRec); lErr != nil {
-		log.Log(common.ERROR, "LoadCSVFile ", "InsertOrder ", lErr.Error())
-		return lErr
-	}
-	if lErr = InsertOrderItem(log, lOrderItemRec); lErr != nil {
-		log.Log(common.ERROR, "LoadCSVFile ", "InsertOrderItem ", lErr.Error())
-		return lErr
-	}
-	if lErr = InsertProducts(log, lProductRec); lErr != nil {
-		log.Log(common.ERROR, "LoadCSVFile ", "InsertProducts ", lErr.Error())
+		return nil
+	})
+	if lErr != nil {
+		log.Log(common.ERROR, "LoadCSVFile ", "Rolled back: "+lErr.Error())
 		return lErr
 	}
+	log.Log(common.DEBUG, "LoadCSVFile ", "last customer", utils.F("customer", lCustomerRec))
+	log.Log(common.INFO, "LoadCSVFile ", "records loaded", utils.F("records", len(lCsvData)))
 
-	log.Log(common.INFO, "LoadCSVFile ", "Started")
+	log.Log(common.INFO, "LoadCSVFile ", "Ended")
 	return nil
 }
 
@@ -125,17 +196,24 @@ func LoadCSVFile(log *utils.Logger, pFilePath string, pDelimeter rune) error {
    Date : 17-05-2025
 */
 
-func InsertCustomer(log *utils.Logger, pCustomerData ordercommon.Customer) error {
+func InsertCustomer(pCtx context.Context, log *utils.Logger, pExec db.Execer, pCustomerData ordercommon.Customer) error {
 	log.Log(common.INFO, "InsertCustomer (+)")
 
-	lSqlString := `INSERT INTO customers (CustomerID, CustomerName, CustomerEmail, CustomerAddress)
-		VALUES (?, ?, ?, ?)
-		ON DUPLICATE KEY UPDATE CustomerName=VALUES(CustomerName), CustomerEmail=VALUES(CustomerEmail), CustomerAddress=VALUES(CustomerAddress)`
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	if lErr != nil {
+		log.Log(common.ERROR, "IC-004 ", lErr.Error())
+		return fmt.Errorf("InsertCustomer - (IC-004) %w", lErr)
+	}
+
+	// Insert or update on customer_id in the syntax of the configured DBType
+	lSqlString := lDialect.Upsert("customers",
+		[]string{"customer_id", "name", "email", "address"},
+		[]string{"customer_id"})
 
-	lExecResult, lErr := db.Global_DB_Instance.Exec(lSqlString, pCustomerData.CustomerID, pCustomerData.CustomerName, pCustomerData.CustomerEmail, pCustomerData.CustomerAddress)
+	lExecResult, lErr := pExec.ExecContext(pCtx, lSqlString, pCustomerData.CustomerID, pCustomerData.CustomerName, pCustomerData.CustomerEmail, pCustomerData.CustomerAddress)
 	if lErr != nil {
 		log.Log(common.ERROR, "IC-001 ", lErr.Error())
-		return fmt.Errorf("InsertCustomer - (IC-001) " + lErr.Error())
+		return fmt.Errorf("InsertCustomer - (IC-001) %w", db.ContextErr(pCtx, lErr))
 	}
 
 	lRowsAffected, lErr := lExecResult.RowsAffected()
@@ -144,7 +222,7 @@ func InsertCustomer(log *utils.Logger, pCustomerData ordercommon.Customer) error
 	}
 
 	log.Log(common.DEBUG, "InsertCustomer Rows affected: ", lRowsAffected)
-	log.Log(common.ERROR, "Record Inserted successfully")
+	log.Log(common.DEBUG, "Record Inserted successfully")
 
 	log.Log(common.INFO, "InsertCustomer (-)")
 	return nil
@@ -167,26 +245,33 @@ func InsertCustomer(log *utils.Logger, pCustomerData ordercommon.Customer) error
    Date : 17-05-2025
 */
 
-func InsertProducts(log *utils.Logger, pProductData ordercommon.Product) error {
+func InsertProducts(pCtx context.Context, log *utils.Logger, pExec db.Execer, pProductData ordercommon.Product) error {
 	log.Log(common.INFO, "InsertProducts (+)")
 
-	lSqlString := `INSERT INTO products (ProductID, ProductName, Category)
-		VALUES (?, ?, ?)
-		ON DUPLICATE KEY UPDATE ProductName=VALUES(ProductName), Category=VALUES(Category)`
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	if lErr != nil {
+		log.Log(common.ERROR, "IP-004 ", lErr.Error())
+		return fmt.Errorf("InsertProducts - (IP-004) %w", lErr)
+	}
+
+	// Insert or update on product_id in the syntax of the configured DBType
+	lSqlString := lDialect.Upsert("products",
+		[]string{"product_id", "name", "category"},
+		[]string{"product_id"})
 
-	lExecResult, lErr := db.Global_DB_Instance.Exec(lSqlString, pProductData.ProductID, pProductData.ProductName, pProductData.Category)
+	lExecResult, lErr := pExec.ExecContext(pCtx, lSqlString, pProductData.ProductID, pProductData.ProductName, pProductData.Category)
 	if lErr != nil {
-		log.Log(common.ERROR, "IC-001 ", lErr.Error())
-		return fmt.Errorf("InsertProducts - (IC-001) " + lErr.Error())
+		log.Log(common.ERROR, "IP-001 ", lErr.Error())
+		return fmt.Errorf("InsertProducts - (IP-001) %w", db.ContextErr(pCtx, lErr))
 	}
 
 	lRowsAffected, lErr := lExecResult.RowsAffected()
 	if lErr != nil {
-		log.Log(common.ERROR, "IC-002 ", lErr.Error())
+		log.Log(common.ERROR, "IP-002 ", lErr.Error())
 	}
 
 	log.Log(common.DEBUG, "InsertProducts Rows affected: ", lRowsAffected)
-	log.Log(common.ERROR, "Record Inserted successfully")
+	log.Log(common.DEBUG, "Record Inserted successfully")
 
 	log.Log(common.INFO, "InsertProducts (-)")
 	return nil
@@ -209,26 +294,33 @@ func InsertProducts(log *utils.Logger, pProductData ordercommon.Product) error {
    Date : 17-05-2025
 */
 
-func InsertOrder(log *utils.Logger, pOrderData ordercommon.Order) error {
+func InsertOrder(pCtx context.Context, log *utils.Logger, pExec db.Execer, pOrderData ordercommon.Order) error {
 	log.Log(common.INFO, "InsertOrder (+)")
 
-	lSqlString := `INSERT INTO orders (OrderID, CustomerID, Region, DateOfSale, ShippingCost, PaymentMethod)
-		VALUES (?, ?, ?, ?, ?, ?)
-		ON DUPLICATE KEY UPDATE Region=VALUES(Region), DateOfSale=VALUES(DateOfSale), ShippingCost=VALUES(ShippingCost), PaymentMethod=VALUES(PaymentMethod)`
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	if lErr != nil {
+		log.Log(common.ERROR, "IO-004 ", lErr.Error())
+		return fmt.Errorf("InsertOrder - (IO-004) %w", lErr)
+	}
+
+	// Insert or update on order_id in the syntax of the configured DBType
+	lSqlString := lDialect.Upsert("orders",
+		[]string{"order_id", "customer_id", "region", "date_of_sale", "shipping_cost", "payment_method"},
+		[]string{"order_id"})
 
-	lExecResult, lErr := db.Global_DB_Instance.Exec(lSqlString, pOrderData.OrderID, pOrderData.CustomerID, pOrderData.Region, pOrderData.DateOfSale, pOrderData.ShippingCost, pOrderData.PaymentMethod)
+	lExecResult, lErr := pExec.ExecContext(pCtx, lSqlString, pOrderData.OrderID, pOrderData.CustomerID, pOrderData.Region, pOrderData.DateOfSale, pOrderData.ShippingCost, pOrderData.PaymentMethod)
 	if lErr != nil {
-		log.Log(common.ERROR, "IC-001 ", lErr.Error())
-		return fmt.Errorf("InsertOrder - (IC-001) " + lErr.Error())
+		log.Log(common.ERROR, "IO-001 ", lErr.Error())
+		return fmt.Errorf("InsertOrder - (IO-001) %w", db.ContextErr(pCtx, lErr))
 	}
 
 	lRowsAffected, lErr := lExecResult.RowsAffected()
 	if lErr != nil {
-		log.Log(common.ERROR, "IC-002 ", lErr.Error())
+		log.Log(common.ERROR, "IO-002 ", lErr.Error())
 	}
 
 	log.Log(common.DEBUG, "InsertOrder Rows affected: ", lRowsAffected)
-	log.Log(common.ERROR, "Record Inserted successfully")
+	log.Log(common.DEBUG, "Record Inserted successfully")
 
 	log.Log(common.INFO, "InsertOrder (-)")
 	return nil
@@ -251,26 +343,33 @@ func InsertOrder(log *utils.Logger, pOrderData ordercommon.Order) error {
    Date : 17-05-2025
 */
 
-func InsertOrderItem(log *utils.Logger, pOrderItems ordercommon.OrderItem) error {
+func InsertOrderItem(pCtx context.Context, log *utils.Logger, pExec db.Execer, pOrderItems ordercommon.OrderItem) error {
 	log.Log(common.INFO, "InsertOrderItem (+)")
 
-	lSqlString := `INSERT INTO order_items (OrderID, ProductID, Quantity, UnitPrice, Discount)
-		VALUES (?, ?, ?, ?, ?)
-		ON DUPLICATE KEY UPDATE Quantity=VALUES(Quantity), UnitPrice=VALUES(UnitPrice), Discount=VALUES(Discount)`
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	if lErr != nil {
+		log.Log(common.ERROR, "IOI-004 ", lErr.Error())
+		return fmt.Errorf("InsertOrderItem - (IOI-004) %w", lErr)
+	}
 
-	lExecResult, lErr := db.Global_DB_Instance.Exec(lSqlString, pOrderItems.OrderID, pOrderItems.ProductID, pOrderItems.Quantity, pOrderItems.UnitPrice, pOrderItems.Discount)
+	// Insert or update on order_id, product_id in the syntax of the configured DBType
+	lSqlString := lDialect.Upsert("order_items",
+		[]string{"order_id", "product_id", "quantity_sold", "unit_price", "discount"},
+		[]string{"order_id", "product_id"})
+
+	lExecResult, lErr := pExec.ExecContext(pCtx, lSqlString, pOrderItems.OrderID, pOrderItems.ProductID, pOrderItems.Quantity, pOrderItems.UnitPrice, pOrderItems.Discount)
 	if lErr != nil {
-		log.Log(common.ERROR, "IC-001 ", lErr.Error())
-		return fmt.Errorf("InsertOrderItem - (IC-001) " + lErr.Error())
+		log.Log(common.ERROR, "IOI-001 ", lErr.Error())
+		return fmt.Errorf("InsertOrderItem - (IOI-001) %w", db.ContextErr(pCtx, lErr))
 	}
 
 	lRowsAffected, lErr := lExecResult.RowsAffected()
 	if lErr != nil {
-		log.Log(common.ERROR, "IC-002 ", lErr.Error())
+		log.Log(common.ERROR, "IOI-002 ", lErr.Error())
 	}
 
 	log.Log(common.DEBUG, "InsertOrderItem Rows affected: ", lRowsAffected)
-	log.Log(common.ERROR, "Record Inserted successfully")
+	log.Log(common.DEBUG, "Record Inserted successfully")
 
 	log.Log(common.INFO, "InsertOrderItem (-)")
 	return nil
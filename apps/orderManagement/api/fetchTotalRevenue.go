@@ -11,8 +11,7 @@ import (
 )
 
 func FetchTotalRevenue(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
-	log := new(utils.Logger)
-	log.SetReqID()
+	log := utils.ContextLogger(lHttpRequest.Context())
 	log.Log(common.INFO, "FetchTotalRevenue (+)")
 
 	(lHttpWriter).Header().Set("Access-Control-Allow-Origin", "*")
@@ -30,7 +29,7 @@ func FetchTotalRevenue(lHttpWriter http.ResponseWriter, lHttpRequest *http.Reque
 			lRespRec.Status = common.ErrorCode
 			lRespRec.ErrMsg = "Error In request Data"
 			log.Log(common.ERROR, "Error In request Data", lErr.Error())
-			lHttpWriter.WriteHeader(http.StatusBadRequest)
+			lRespRec.ErrClass, lRespRec.ErrCode = common.ErrClassInvalid, http.StatusBadRequest
 			goto marshal
 		}
 		lErr = appscommon.ValidateRequest(log, &lReqRec, lHttpRequest)
@@ -38,7 +37,7 @@ func FetchTotalRevenue(lHttpWriter http.ResponseWriter, lHttpRequest *http.Reque
 			lRespRec.Status = common.ErrorCode
 			lRespRec.ErrMsg = lErr.Error()
 			log.Log(common.ERROR, "Error In Validate Data", lErr.Error())
-			lHttpWriter.WriteHeader(http.StatusBadRequest)
+			lRespRec.ErrClass, lRespRec.ErrCode = common.ErrClassInvalid, http.StatusBadRequest
 			goto marshal
 		}
 		lErr = appscommon.CompareDates(lReqRec.FromDate, lReqRec.ToDate, common.DateLayout)
@@ -46,15 +45,15 @@ func FetchTotalRevenue(lHttpWriter http.ResponseWriter, lHttpRequest *http.Reque
 			lRespRec.Status = common.ErrorCode
 			lRespRec.ErrMsg = lErr.Error()
 			log.Log(common.ERROR, "Error In request Data", lErr.Error())
-			lHttpWriter.WriteHeader(http.StatusBadRequest)
+			lRespRec.ErrClass, lRespRec.ErrCode = common.ErrClassInvalid, http.StatusBadRequest
 			goto marshal
 		}
-		lRespRec.DetailsArr, lErr = ordermanagement.CommunicateWithDB(log, lReqRec, ordercommon.GetTotalRevenue)
+		lRespRec.DetailsArr, lErr = ordermanagement.CommunicateWithDB(lHttpRequest.Context(), lReqRec, ordercommon.GetTotalRevenue)
 		if lErr != nil {
 			lRespRec.Status = common.ErrorCode
 			lRespRec.ErrMsg = lErr.Error()
 			log.Log(common.ERROR, "Error In Communicate with DB", lErr.Error())
-			lHttpWriter.WriteHeader(http.StatusInternalServerError)
+			appscommon.SetErrorStatus(lHttpWriter, &lRespRec, lErr)
 			goto marshal
 		}
 		lRespRec.Status = common.SuccessCode
@@ -9,9 +9,9 @@ type CsvData struct {
 	// Orders Data
 	OrderID       string  `csv:"Order ID"`
 	Region        string  `csv:"Region"`
-	DateOfSale    string  `csv:"DateOfSale"`
-	ShippingCost  float64 `csv:"ShippingCost"`
-	PaymentMethod string  `csv:"PaymentMethod"`
+	DateOfSale    string  `csv:"Date of Sale"`
+	ShippingCost  float64 `csv:"Shipping Cost"`
+	PaymentMethod string  `csv:"Payment Method"`
 
 	// Orders Items Data
 	Quantity  int     `csv:"Quantity Sold"`
@@ -56,13 +56,13 @@ type OrderItem struct {
 }
 
 type RevenueStruct struct {
-	RevenueWithDiscount    string `json:"totalRevenueWithDis,omitempty" `
-	RevenueWithoutDiscount string `json:"totalRevenueWithoutDis,omitempty" `
+	RevenueWithDiscount    string `json:"totalRevenueWithDis,omitempty" db:"RevenueWithDiscount"`
+	RevenueWithoutDiscount string `json:"totalRevenueWithoutDis,omitempty" db:"RevenueWithoutDiscount"`
 }
 type RevenueResp struct {
-	ProductName   string `json:"product_name,omitempty" `
-	CatagoryName  string `json:"catagiryName,omitempty" `
-	RegionName    string `json:"regionName,omitempty" `
+	ProductName   string `json:"product_name,omitempty" db:"ProductName"`
+	CatagoryName  string `json:"catagiryName,omitempty" db:"CatagoryName"`
+	RegionName    string `json:"regionName,omitempty" db:"RegionName"`
 	RevenueStruct `json:"Revenue" `
 }
 
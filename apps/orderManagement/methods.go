@@ -1,7 +1,7 @@
 package ordermanagement
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	ordercommon "lumelpkg/apps/orderManagement/common"
 	"lumelpkg/common"
@@ -16,44 +16,47 @@ import (
    Author : VIJAY
    Created Date : 11-04-2025
 */
-// CommunicateWithDB retrieves external data
-func CommunicateWithDB(log *utils.Logger, pReqRec ordercommon.RequestStruct, pKeyToFetch string) (any, error) {
+// CommunicateWithDB retrieves external data.
+// pCtx is the request context, the queries stop when it is cancelled or their timeout expires.
+// Everything is logged with the request's logger carried in pCtx.
+func CommunicateWithDB(pCtx context.Context, pReqRec ordercommon.RequestStruct, pKeyToFetch string) (any, error) {
+	log := utils.ContextLogger(pCtx)
 	log.Log(common.INFO, "CommunicateWithDB (+)")
 
 	switch pKeyToFetch {
 	case ordercommon.GetTotalRevenue:
 		// Here we fetch total revenue
-		lTotalRevenue, lErr := GetTotalRevenue(log, pReqRec)
+		lTotalRevenue, lErr := GetTotalRevenue(pCtx, log, pReqRec)
 		if lErr != nil {
 			log.Log(common.ERROR, "CommunicateWithDB:002 -", lErr.Error()+" Error While fetching Client Basic Details")
-			return lTotalRevenue, errors.New(" Error While fetching Client Basic Details" + lErr.Error())
+			return lTotalRevenue, fmt.Errorf(" Error While fetching Client Basic Details%w", lErr)
 		} else {
 			return lTotalRevenue, nil
 		}
 	case ordercommon.GetCategoryRevenue:
 		// Here we fetch revenue by category
-		lCategoryRevenue, lErr := GetCategoryRevenue(log, pReqRec)
+		lCategoryRevenue, lErr := GetCategoryRevenue(pCtx, log, pReqRec)
 		if lErr != nil {
 			log.Log(common.ERROR, "CommunicateWithDB:003 -", lErr.Error()+" Error While fetching Client CRM Details")
-			return lCategoryRevenue, errors.New(" Error While fetching Client CRM Details" + lErr.Error())
+			return lCategoryRevenue, fmt.Errorf(" Error While fetching Client CRM Details%w", lErr)
 		} else {
 			return lCategoryRevenue, nil
 		}
 	case ordercommon.GetProductRevenue:
 		// Here we fetch revenue by product
-		lProductRevenue, lErr := GetProductRevenue(log, pReqRec)
+		lProductRevenue, lErr := GetProductRevenue(pCtx, log, pReqRec)
 		if lErr != nil {
 			log.Log(common.ERROR, "CommunicateWithDB:004 -", lErr.Error()+" Error While fetching Client Exchange Details")
-			return lProductRevenue, errors.New(" Error While fetching Client Exchange Details" + lErr.Error())
+			return lProductRevenue, fmt.Errorf(" Error While fetching Client Exchange Details%w", lErr)
 		} else {
 			return lProductRevenue, nil
 		}
 	case ordercommon.GetRegionRevenue:
 		// Here we fetch revenue by region
-		lRegionRevenue, lErr := GetRegionRevenue(log, pReqRec)
+		lRegionRevenue, lErr := GetRegionRevenue(pCtx, log, pReqRec)
 		if lErr != nil {
 			log.Log(common.ERROR, "CommunicateWithDB:005 -", lErr.Error()+" Error While fetching Client form stages Details")
-			return lRegionRevenue, errors.New(" Error While fetching Client Exchange Details" + lErr.Error())
+			return lRegionRevenue, fmt.Errorf(" Error While fetching Client Exchange Details%w", lErr)
 		} else {
 			return lRegionRevenue, nil
 		}
@@ -80,7 +83,7 @@ func CommunicateWithDB(log *utils.Logger, pReqRec ordercommon.RequestStruct, pKe
    Date : 11-04-2025
 */
 
-func GetTotalRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (lReqRec ordercommon.RevenueStruct, lErr error) {
+func GetTotalRevenue(pCtx context.Context, log *utils.Logger, pReqRec ordercommon.RequestStruct) (lReqRec ordercommon.RevenueStruct, lErr error) {
 	log.Log(common.INFO, "GetTotalRevenue (+)")
 
 	lCoreString := `SELECT 
@@ -89,29 +92,31 @@ func GetTotalRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (lReq
 		FROM order_items oi
 		JOIN orders o ON o.order_id = oi.order_id
 		WHERE o.date_of_sale BETWEEN ? AND ?`
-	lStmt, lErr := db.Global_DB_Instance.Prepare(lCoreString)
+	// Wait for a free analytics slot, so the reports cannot take every pooled connection
+	lRelease, lErr := db.Acquire(pCtx, db.ClassAnalytics)
 	if lErr != nil {
-		log.Log(common.ERROR, "GTR-001", lErr.Error())
-		return lReqRec, fmt.Errorf("GetTotalRevenue - (GTR-001) " + lErr.Error())
+		log.Log(common.ERROR, "GTR-006", lErr.Error())
+		return lReqRec, fmt.Errorf("GetTotalRevenue - (GTR-006) %w", lErr)
 	}
-	defer lStmt.Close()
+	defer lRelease()
 
-	lRows, lErr := lStmt.Query(pReqRec.FromDate, pReqRec.ToDate)
+	lDb, lErr := db.Reader(db.SQLDB)
+	if lErr != nil {
+		log.Log(common.ERROR, "GTR-004", lErr.Error())
+		return lReqRec, fmt.Errorf("GetTotalRevenue - (GTR-004) %w", lErr)
+	}
+	lDialect, lErr := db.DialectOf(db.SQLDB)
 	if lErr != nil {
-		log.Log(common.ERROR, "GTR-002", lErr.Error())
-		return lReqRec, fmt.Errorf("GetTotalRevenue - (GTR-002) " + lErr.Error())
+		log.Log(common.ERROR, "GTR-005", lErr.Error())
+		return lReqRec, fmt.Errorf("GetTotalRevenue - (GTR-005) %w", lErr)
 	}
-	defer lRows.Close()
+	lCtx, lCancel := db.WithTimeout(pCtx, db.ClassAnalytics)
+	defer lCancel()
 
-	for lRows.Next() {
-		lErr := lRows.Scan(&lReqRec.RevenueWithDiscount, &lReqRec.RevenueWithDiscount)
-		if lErr != nil {
-			log.Log(common.ERROR, "GTR-003", lErr.Error())
-			return lReqRec, fmt.Errorf("GetTotalRevenue - (GTR-003) " + lErr.Error())
-		} else {
-			//  Your Logic Here
-			log.Log(common.DEBUG, "GetTotalRevenue  ", "lReqId")
-		}
+	lReqRec, lErr = db.QueryOne[ordercommon.RevenueStruct](lCtx, lDb, lDialect.Rebind(lCoreString), pReqRec.FromDate, pReqRec.ToDate)
+	if lErr != nil {
+		log.Log(common.ERROR, "GTR-001", lErr.Error())
+		return lReqRec, fmt.Errorf("GetTotalRevenue - (GTR-001) %w", lErr)
 	}
 
 	log.Log(common.INFO, "GetTotalRevenue (-)")
@@ -135,9 +140,8 @@ func GetTotalRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (lReq
    Date : 11-04-2025
 */
 
-func GetCategoryRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (lReqArr []ordercommon.RevenueResp, lErr error) {
+func GetCategoryRevenue(pCtx context.Context, log *utils.Logger, pReqRec ordercommon.RequestStruct) (lReqArr []ordercommon.RevenueResp, lErr error) {
 	log.Log(common.INFO, "GetCategoryRevenue (+)")
-	var lReqRec ordercommon.RevenueResp
 
 	lCoreString := `SELECT 
 						p.category AS CatagoryName,
@@ -148,30 +152,31 @@ func GetCategoryRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (l
 					JOIN orders o ON o.order_id = oi.order_id
 					WHERE o.date_of_sale BETWEEN ? AND ?
 					GROUP BY p.category`
-	lStmt, lErr := db.Global_DB_Instance.Prepare(lCoreString)
+	// Wait for a free analytics slot, so the reports cannot take every pooled connection
+	lRelease, lErr := db.Acquire(pCtx, db.ClassAnalytics)
 	if lErr != nil {
-		log.Log(common.ERROR, "GCR-001", lErr.Error())
-		return lReqArr, fmt.Errorf("GetCategoryRevenue - (GCR-001) " + lErr.Error())
+		log.Log(common.ERROR, "GCR-006", lErr.Error())
+		return lReqArr, fmt.Errorf("GetCategoryRevenue - (GCR-006) %w", lErr)
 	}
-	defer lStmt.Close()
+	defer lRelease()
 
-	lRows, lErr := lStmt.Query(pReqRec.FromDate, pReqRec.ToDate)
+	lDb, lErr := db.Reader(db.SQLDB)
 	if lErr != nil {
-		log.Log(common.ERROR, "GCR-002", lErr.Error())
-		return lReqArr, fmt.Errorf("GetCategoryRevenue - (GCR-002) " + lErr.Error())
+		log.Log(common.ERROR, "GCR-004", lErr.Error())
+		return lReqArr, fmt.Errorf("GetCategoryRevenue - (GCR-004) %w", lErr)
 	}
-	defer lRows.Close()
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	if lErr != nil {
+		log.Log(common.ERROR, "GCR-005", lErr.Error())
+		return lReqArr, fmt.Errorf("GetCategoryRevenue - (GCR-005) %w", lErr)
+	}
+	lCtx, lCancel := db.WithTimeout(pCtx, db.ClassAnalytics)
+	defer lCancel()
 
-	for lRows.Next() {
-		lErr := lRows.Scan(&lReqRec.CatagoryName, &lReqRec.RevenueWithDiscount, &lReqRec.RevenueWithDiscount)
-		if lErr != nil {
-			log.Log(common.ERROR, "GCR-003", lErr.Error())
-			return lReqArr, fmt.Errorf("GetCategoryRevenue - (GCR-003) " + lErr.Error())
-		} else {
-			//  Your Logic Here
-			lReqArr = append(lReqArr, lReqRec)
-			log.Log(common.DEBUG, "GetCategoryRevenue  ", "lReqId")
-		}
+	lReqArr, lErr = db.QueryAll[ordercommon.RevenueResp](lCtx, lDb, lDialect.Rebind(lCoreString), pReqRec.FromDate, pReqRec.ToDate)
+	if lErr != nil {
+		log.Log(common.ERROR, "GCR-001", lErr.Error())
+		return lReqArr, fmt.Errorf("GetCategoryRevenue - (GCR-001) %w", lErr)
 	}
 
 	log.Log(common.INFO, "GetCategoryRevenue (-)")
@@ -195,9 +200,8 @@ func GetCategoryRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (l
    Date : 11-04-2025
 */
 
-func GetProductRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (lReqArr []ordercommon.RevenueResp, lErr error) {
+func GetProductRevenue(pCtx context.Context, log *utils.Logger, pReqRec ordercommon.RequestStruct) (lReqArr []ordercommon.RevenueResp, lErr error) {
 	log.Log(common.INFO, "GetProductRevenue (+)")
-	var lReqRec ordercommon.RevenueResp
 
 	lCoreString := `SELECT 
 						p.name AS ProductName,
@@ -208,30 +212,31 @@ func GetProductRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (lR
 					JOIN orders o ON o.order_id = oi.order_id
 					WHERE o.date_of_sale BETWEEN ? AND ?
 					GROUP BY p.product_id, p.name`
-	lStmt, lErr := db.Global_DB_Instance.Prepare(lCoreString)
+	// Wait for a free analytics slot, so the reports cannot take every pooled connection
+	lRelease, lErr := db.Acquire(pCtx, db.ClassAnalytics)
 	if lErr != nil {
-		log.Log(common.ERROR, "GPR-001", lErr.Error())
-		return lReqArr, fmt.Errorf("GetProductRevenue - (GPR-001) " + lErr.Error())
+		log.Log(common.ERROR, "GPR-006", lErr.Error())
+		return lReqArr, fmt.Errorf("GetProductRevenue - (GPR-006) %w", lErr)
 	}
-	defer lStmt.Close()
+	defer lRelease()
 
-	lRows, lErr := lStmt.Query(pReqRec.FromDate, pReqRec.ToDate)
+	lDb, lErr := db.Reader(db.SQLDB)
 	if lErr != nil {
-		log.Log(common.ERROR, "GPR-002", lErr.Error())
-		return lReqArr, fmt.Errorf("GetProductRevenue - (GPR-002) " + lErr.Error())
+		log.Log(common.ERROR, "GPR-004", lErr.Error())
+		return lReqArr, fmt.Errorf("GetProductRevenue - (GPR-004) %w", lErr)
 	}
-	defer lRows.Close()
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	if lErr != nil {
+		log.Log(common.ERROR, "GPR-005", lErr.Error())
+		return lReqArr, fmt.Errorf("GetProductRevenue - (GPR-005) %w", lErr)
+	}
+	lCtx, lCancel := db.WithTimeout(pCtx, db.ClassAnalytics)
+	defer lCancel()
 
-	for lRows.Next() {
-		lErr := lRows.Scan(&lReqRec.ProductName, &lReqRec.RevenueWithDiscount, &lReqRec.RevenueWithDiscount)
-		if lErr != nil {
-			log.Log(common.ERROR, "GPR-003", lErr.Error())
-			return lReqArr, fmt.Errorf("GetProductRevenue - (GPR-003) " + lErr.Error())
-		} else {
-			//  Your Logic Here
-			lReqArr = append(lReqArr, lReqRec)
-			log.Log(common.DEBUG, "GetProductRevenue  ", "lReqId")
-		}
+	lReqArr, lErr = db.QueryAll[ordercommon.RevenueResp](lCtx, lDb, lDialect.Rebind(lCoreString), pReqRec.FromDate, pReqRec.ToDate)
+	if lErr != nil {
+		log.Log(common.ERROR, "GPR-001", lErr.Error())
+		return lReqArr, fmt.Errorf("GetProductRevenue - (GPR-001) %w", lErr)
 	}
 
 	log.Log(common.INFO, "GetProductRevenue (-)")
@@ -255,9 +260,8 @@ func GetProductRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (lR
    Date : 11-04-2025
 */
 
-func GetRegionRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (lReqArr []ordercommon.RevenueResp, lErr error) {
-	log.Log(common.INFO, "GetProductRevenue (+)")
-	var lReqRec ordercommon.RevenueResp
+func GetRegionRevenue(pCtx context.Context, log *utils.Logger, pReqRec ordercommon.RequestStruct) (lReqArr []ordercommon.RevenueResp, lErr error) {
+	log.Log(common.INFO, "GetRegionRevenue (+)")
 
 	lCoreString := `SELECT 
 						o.region AS RegionName,
@@ -268,32 +272,33 @@ func GetRegionRevenue(log *utils.Logger, pReqRec ordercommon.RequestStruct) (lRe
 					JOIN orders o ON o.order_id = oi.order_id
 					WHERE o.date_of_sale BETWEEN ? AND ?
 					GROUP BY o.region`
-	lStmt, lErr := db.Global_DB_Instance.Prepare(lCoreString)
+	// Wait for a free analytics slot, so the reports cannot take every pooled connection
+	lRelease, lErr := db.Acquire(pCtx, db.ClassAnalytics)
 	if lErr != nil {
-		log.Log(common.ERROR, "GRR-001", lErr.Error())
-		return lReqArr, fmt.Errorf("GetProductRevenue - (GRR-001) " + lErr.Error())
+		log.Log(common.ERROR, "GRR-006", lErr.Error())
+		return lReqArr, fmt.Errorf("GetRegionRevenue - (GRR-006) %w", lErr)
 	}
-	defer lStmt.Close()
+	defer lRelease()
 
-	lRows, lErr := lStmt.Query(pReqRec.FromDate, pReqRec.ToDate)
+	lDb, lErr := db.Reader(db.SQLDB)
 	if lErr != nil {
-		log.Log(common.ERROR, "GRR-002", lErr.Error())
-		return lReqArr, fmt.Errorf("GetProductRevenue - (GRR-002) " + lErr.Error())
+		log.Log(common.ERROR, "GRR-004", lErr.Error())
+		return lReqArr, fmt.Errorf("GetRegionRevenue - (GRR-004) %w", lErr)
 	}
-	defer lRows.Close()
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	if lErr != nil {
+		log.Log(common.ERROR, "GRR-005", lErr.Error())
+		return lReqArr, fmt.Errorf("GetRegionRevenue - (GRR-005) %w", lErr)
+	}
+	lCtx, lCancel := db.WithTimeout(pCtx, db.ClassAnalytics)
+	defer lCancel()
 
-	for lRows.Next() {
-		lErr := lRows.Scan(&lReqRec.RegionName, &lReqRec.RevenueWithDiscount, &lReqRec.RevenueWithDiscount)
-		if lErr != nil {
-			log.Log(common.ERROR, "GRR-003", lErr.Error())
-			return lReqArr, fmt.Errorf("GetProductRevenue - (GRR-003) " + lErr.Error())
-		} else {
-			//  Your Logic Here
-			lReqArr = append(lReqArr, lReqRec)
-			log.Log(common.DEBUG, "GetProductRevenue  ", "lReqId")
-		}
+	lReqArr, lErr = db.QueryAll[ordercommon.RevenueResp](lCtx, lDb, lDialect.Rebind(lCoreString), pReqRec.FromDate, pReqRec.ToDate)
+	if lErr != nil {
+		log.Log(common.ERROR, "GRR-001", lErr.Error())
+		return lReqArr, fmt.Errorf("GetRegionRevenue - (GRR-001) %w", lErr)
 	}
 
-	log.Log(common.INFO, "GetProductRevenue (-)")
+	log.Log(common.INFO, "GetRegionRevenue (-)")
 	return lReqArr, nil
 }
@@ -0,0 +1,139 @@
+package ordermanagement
+
+import (
+	"context"
+	scheduler "lumelpkg/apps/orderManagement/Scheduler"
+	ordercommon "lumelpkg/apps/orderManagement/common"
+	"lumelpkg/config"
+	"lumelpkg/db"
+	"lumelpkg/migrations"
+	"lumelpkg/utils"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testDBConfig runs the order database in memory with the shipped pool limits
+const testDBConfig = `
+[Databases.localDB]
+DBType = "sqlite"
+Database = ":memory:"
+
+[DBConnectionPool]
+DbConMaxIdleTime=3
+DbConMaxOpenConns=3
+DbConMaxIdleConns=3
+
+[Migrations]
+Database="localDB"
+`
+
+// testOrdersCSV has one order outside 2024, a returning customer and a product sold twice
+const testOrdersCSV = `Order ID,Product ID,Customer ID,Product Name,Category,Region,Date of Sale,Quantity Sold,Unit Price,Discount,Shipping Cost,Payment Method,Customer Name,Customer Email,Customer Address
+1001,P1,C1,Running Shoes,Shoes,North America,2023-12-15,2,100.00,0.5,10.00,Credit Card,John Smith,john@example.com,"1 Main St, Anytown"
+1002,P2,C2,Phone,Electronics,Europe,2024-01-03,1,1000.00,0.25,15.00,PayPal,Emily Davis,emily@example.com,"2 Elm St, Otherville"
+1003,P3,C1,Jeans,Clothing,Asia,2024-02-28,4,50.00,0.5,5.00,Debit Card,John Smith,john@example.com,"1 Main St, Anytown"
+1004,P1,C3,Running Shoes,Shoes,South America,2024-03-10,2,100.00,0,8.00,Credit Card,Sarah Johnson,sarah@example.com,"3 Oak St, New City"
+`
+
+// TestRevenueOnSQLite runs the CSV-load-then-query flow on an in-memory SQLite database:
+// migrations, two loads of the same file through the upserts, then the revenue queries.
+func TestRevenueOnSQLite(t *testing.T) {
+	log := new(utils.Logger)
+	lCtx := utils.WithLogger(context.Background(), log)
+
+	lFolder := t.TempDir()
+	if lErr := os.WriteFile(filepath.Join(lFolder, "dbconfig.toml"), []byte(testDBConfig), 0o600); lErr != nil {
+		t.Fatal(lErr)
+	}
+	lCsvPath := filepath.Join(lFolder, "OrderDetails.csv")
+	if lErr := os.WriteFile(lCsvPath, []byte(testOrdersCSV), 0o600); lErr != nil {
+		t.Fatal(lErr)
+	}
+
+	t.Setenv(config.ProfileEnv, "")
+	if lErr := config.LoadAllTOMLConfigs(lFolder); lErr != nil {
+		t.Fatal(lErr)
+	}
+	if lErr := db.GlobalDBInit(log); lErr != nil {
+		t.Fatal(lErr)
+	}
+	t.Cleanup(db.CloseAll)
+
+	lDb, lErr := db.Writer(db.SQLDB)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	lMigrator, lErr := migrations.New(lDb, lDialect)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	if _, lErr := lMigrator.Up(lCtx, log, 0); lErr != nil {
+		t.Fatalf("migrate up: %v", lErr)
+	}
+
+	// The second load updates the same rows instead of failing on the primary keys
+	for i := 0; i < 2; i++ {
+		if lErr := scheduler.LoadCSVFile(lCtx, lCsvPath, ','); lErr != nil {
+			t.Fatalf("load %d: %v", i+1, lErr)
+		}
+	}
+
+	lRange := ordercommon.RequestStruct{FromDate: "2024-01-01", ToDate: "2024-12-31"}
+
+	lTotal, lErr := GetTotalRevenue(lCtx, log, lRange)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	if lWant := revenue("1050", "1400"); lTotal != lWant {
+		t.Errorf("total revenue = %+v, want %+v", lTotal, lWant)
+	}
+
+	lByProduct, lErr := GetProductRevenue(lCtx, log, lRange)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	sort.Slice(lByProduct, func(i, j int) bool { return lByProduct[i].ProductName < lByProduct[j].ProductName })
+	lWantProducts := []ordercommon.RevenueResp{
+		{ProductName: "Jeans", RevenueStruct: revenue("100", "200")},
+		{ProductName: "Phone", RevenueStruct: revenue("750", "1000")},
+		{ProductName: "Running Shoes", RevenueStruct: revenue("200", "200")},
+	}
+	if !reflect.DeepEqual(lByProduct, lWantProducts) {
+		t.Errorf("revenue by product = %+v\nwant %+v", lByProduct, lWantProducts)
+	}
+
+	lByCategory, lErr := GetCategoryRevenue(lCtx, log, lRange)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	sort.Slice(lByCategory, func(i, j int) bool { return lByCategory[i].CatagoryName < lByCategory[j].CatagoryName })
+	lWantCategories := []ordercommon.RevenueResp{
+		{CatagoryName: "Clothing", RevenueStruct: revenue("100", "200")},
+		{CatagoryName: "Electronics", RevenueStruct: revenue("750", "1000")},
+		{CatagoryName: "Shoes", RevenueStruct: revenue("200", "200")},
+	}
+	if !reflect.DeepEqual(lByCategory, lWantCategories) {
+		t.Errorf("revenue by category = %+v\nwant %+v", lByCategory, lWantCategories)
+	}
+
+	// The 2023 order is only counted when the range covers it
+	lTotal, lErr = GetTotalRevenue(lCtx, log, ordercommon.RequestStruct{FromDate: "2023-01-01", ToDate: "2024-12-31"})
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	if lWant := revenue("1150", "1600"); lTotal != lWant {
+		t.Errorf("total revenue with 2023 = %+v, want %+v", lTotal, lWant)
+	}
+}
+
+// revenue builds the expected revenue with and without discount.
+func revenue(pWithDiscount, pWithoutDiscount string) ordercommon.RevenueStruct {
+	return ordercommon.RevenueStruct{RevenueWithDiscount: pWithDiscount, RevenueWithoutDiscount: pWithoutDiscount}
+}
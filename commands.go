@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"lumelpkg/apps/appscommon"
+	scheduler "lumelpkg/apps/orderManagement/Scheduler"
+	"lumelpkg/common"
+	"lumelpkg/config"
+	"lumelpkg/db"
+	"lumelpkg/migrations"
+	"lumelpkg/utils"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCommand executes a sub-command instead of starting the server and returns the exit code.
+func runCommand(pArgs []string) int {
+	switch pArgs[0] {
+	case "encrypt-secret":
+		return encryptSecretCommand()
+	case "validate-config":
+		return validateConfigCommand(pArgs[1:])
+	case "migrate":
+		return migrateCommand(pArgs[1:])
+	case "logs":
+		return logsCommand(pArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", pArgs[0])
+		fmt.Fprintln(os.Stderr, "usage: lumelpkg [encrypt-secret | validate-config [folder] | migrate [status | up [version] | down [steps] | baseline version] | logs [flags]]")
+		return 2
+	}
+}
+
+// registerConfigSchemas declares every config section the service expects.
+// It must run before config.Init and before validate-config.
+func registerConfigSchemas() {
+	config.RegisterConfigSchemas()
+	db.RegisterConfigSchemas()
+	migrations.RegisterConfigSchemas()
+	scheduler.RegisterConfigSchemas()
+	config.RegisterOptionalSchema[utils.LogSettings]("appconfig", "Logger")
+	config.RegisterSchema[appscommon.AdminSettings]("appconfig", "Admin")
+}
+
+// validateConfigCommand checks a config folder (./toml by default) against the registered
+// schemas and prints every problem found. LUMEL_PROFILE and LUMEL_ overrides apply as on start.
+func validateConfigCommand(pArgs []string) int {
+	lFolder := config.ConfigFolder
+	if len(pArgs) > 0 {
+		lFolder = pArgs[0]
+	}
+
+	registerConfigSchemas()
+	if lErr := config.ValidateFolder(lFolder); lErr != nil {
+		fmt.Fprintf(os.Stderr, "config folder %s is invalid:\n%v\n", lFolder, lErr)
+		return 1
+	}
+	fmt.Printf("config folder %s is valid\n", lFolder)
+	return 0
+}
+
+// encryptSecretCommand reads a plaintext from stdin and prints its "enc:" reference.
+// Reading from stdin keeps the secret out of the shell history.
+func encryptSecretCommand() int {
+	lPlain, lErr := bufio.NewReader(os.Stdin).ReadString('\n')
+	if lErr != nil && lPlain == "" {
+		fmt.Fprintln(os.Stderr, "encrypt-secret: reading stdin:", lErr)
+		return 1
+	}
+
+	lEncrypted, lErr := config.EncryptSecret(strings.TrimRight(lPlain, "\r\n"))
+	if lErr != nil {
+		fmt.Fprintln(os.Stderr, "encrypt-secret:", lErr)
+		return 1
+	}
+	fmt.Println(lEncrypted)
+	return 0
+}
+
+// migrateCommand shows or changes the schema version of the [Migrations] database:
+//
+//	migrate status            applied and pending versions (default)
+//	migrate up [version]      apply pending migrations, all or up to version
+//	migrate down [steps]      revert the latest migrations, one by default
+//	migrate baseline version  record migrations up to version as applied without running them
+func migrateCommand(pArgs []string) int {
+	lAction := "status"
+	if len(pArgs) > 0 {
+		lAction = pArgs[0]
+	}
+	lNumber := 0
+	if len(pArgs) > 1 {
+		var lErr error
+		if lNumber, lErr = strconv.Atoi(pArgs[1]); lErr != nil || lNumber < 0 {
+			fmt.Fprintf(os.Stderr, "migrate: invalid number %q\n", pArgs[1])
+			return 2
+		}
+	}
+
+	registerConfigSchemas()
+	if lErr := config.LoadAllTOMLConfigs(config.ConfigFolder); lErr != nil {
+		fmt.Fprintf(os.Stderr, "migrate: config folder %s is invalid:\n%v\n", config.ConfigFolder, lErr)
+		return 1
+	}
+
+	var lSettings migrations.Settings
+	var lDBType string
+	if lErr := config.GetAndAssignTomlValue("dbconfig", "Migrations", &lSettings); lErr != nil {
+		fmt.Fprintln(os.Stderr, "migrate: reading Migrations settings:", lErr)
+		return 1
+	}
+	if lErr := config.GetAndAssignTomlValue("dbconfig", "Databases."+lSettings.Database+".DBType", &lDBType); lErr != nil {
+		fmt.Fprintf(os.Stderr, "migrate: database %s: %v\n", lSettings.Database, lErr)
+		return 1
+	}
+	lDialect, lErr := db.DialectFor(lDBType)
+	if lErr != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", lErr)
+		return 1
+	}
+	log := new(utils.Logger)
+	log.SetReqID()
+	lDb, lErr := db.LocalDbConnect(log, lSettings.Database)
+	if lErr != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", lErr)
+		return 1
+	}
+	defer lDb.Close()
+
+	lMigrator, lErr := migrations.New(lDb, lDialect)
+	if lErr != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", lErr)
+		return 1
+	}
+
+	lCtx := utils.WithLogger(context.Background(), log)
+	switch lAction {
+	case "status":
+		lStatus, lErr := lMigrator.Status(lCtx)
+		if lErr != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", lErr)
+			return 1
+		}
+		fmt.Printf("%s (%s) is at version %d\n", lSettings.Database, lDBType, lStatus.Current)
+		for _, lMigration := range lStatus.Pending {
+			fmt.Printf("  pending %04d_%s\n", lMigration.Version, lMigration.Name)
+		}
+		for _, lVersion := range lStatus.Unknown {
+			fmt.Printf("  unknown %04d (no migration file in this build)\n", lVersion)
+		}
+		for _, lMigration := range lStatus.Changed {
+			fmt.Printf("  changed %04d_%s (file differs from the applied version)\n", lMigration.Version, lMigration.Name)
+		}
+	case "up":
+		lCount, lErr := lMigrator.Up(lCtx, log, lNumber)
+		fmt.Printf("%d migrations applied\n", lCount)
+		if lErr != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", lErr)
+			return 1
+		}
+	case "down":
+		if lNumber == 0 {
+			lNumber = 1
+		}
+		lCount, lErr := lMigrator.Down(lCtx, log, lNumber)
+		fmt.Printf("%d migrations reverted\n", lCount)
+		if lErr != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", lErr)
+			return 1
+		}
+	case "baseline":
+		lCount, lErr := lMigrator.Baseline(lCtx, log, lNumber)
+		fmt.Printf("%d migrations recorded as applied\n", lCount)
+		if lErr != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", lErr)
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "migrate: unknown action %q, use status, up, down or baseline\n", lAction)
+		return 2
+	}
+	return 0
+}
+
+// logsCommand searches the log folder, rotated and gzipped files included, and prints the
+// matching entries oldest first:
+//
+//	logs -reqid 3f6c8911-...          every entry of one request
+//	logs -level ERROR -since 2h       errors of the last two hours
+//	logs -step LoadCSV -format json   entries whose step contains LoadCSV, as JSON lines
+//	logs -follow                      keep printing new entries until Ctrl+C
+func logsCommand(pArgs []string) int {
+	lFlags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	lDir := lFlags.String("dir", "", "log folder, [Logger.Rotation] Dir or ./log by default")
+	lReqID := lFlags.String("reqid", "", "request ID")
+	lLevel := lFlags.String("level", "", "minimum level: DEBUG, INFO or ERROR")
+	lStep := lFlags.String("step", "", "substring of the step, case-insensitive")
+	lSince := lFlags.String("since", "", "entries from this time: RFC 3339, \"2006-01-02 15:04:05\", 2006-01-02 or a duration ago like 2h")
+	lUntil := lFlags.String("until", "", "entries before this time, same formats as -since")
+	lLimit := lFlags.Int("limit", 0, "stop after this many entries, 0 for all")
+	lFormat := lFlags.String("format", "text", "output format: text or json")
+	lFollow := lFlags.Bool("follow", false, "keep printing new entries until interrupted")
+	if lErr := lFlags.Parse(pArgs); lErr != nil {
+		return 2
+	}
+
+	lQuery := utils.LogQuery{ReqID: *lReqID, Level: strings.ToUpper(*lLevel), Step: *lStep, Limit: *lLimit, Follow: *lFollow}
+	switch lQuery.Level {
+	case "", common.DEBUG, common.INFO, common.ERROR:
+	default:
+		fmt.Fprintf(os.Stderr, "logs: invalid level %q, use DEBUG, INFO or ERROR\n", *lLevel)
+		return 2
+	}
+	if *lFormat != "text" && *lFormat != "json" {
+		fmt.Fprintf(os.Stderr, "logs: invalid format %q, use text or json\n", *lFormat)
+		return 2
+	}
+	var lErr error
+	lNow := time.Now()
+	if lQuery.Since, lErr = utils.ParseLogTime(*lSince, lNow); lErr != nil {
+		fmt.Fprintln(os.Stderr, "logs: -since:", lErr)
+		return 2
+	}
+	if lQuery.Until, lErr = utils.ParseLogTime(*lUntil, lNow); lErr != nil {
+		fmt.Fprintln(os.Stderr, "logs: -until:", lErr)
+		return 2
+	}
+	if *lDir == "" {
+		*lDir = configuredLogDir()
+	}
+
+	lCtx, lStop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer lStop()
+
+	lOut := bufio.NewWriter(os.Stdout)
+	defer lOut.Flush()
+	lErr = utils.SearchLogs(lCtx, *lDir, lQuery, func(pRecord utils.LogRecord) error {
+		if *lFormat == "json" {
+			lLine, lErr := json.Marshal(pRecord)
+			if lErr != nil {
+				return lErr
+			}
+			lOut.Write(lLine)
+			lOut.WriteByte('\n')
+		} else {
+			lOut.WriteString(pRecord.Text() + "\n")
+		}
+		if lQuery.Follow {
+			return lOut.Flush()
+		}
+		return nil
+	})
+	if lErr != nil {
+		lOut.Flush()
+		fmt.Fprintln(os.Stderr, "logs:", lErr)
+		return 1
+	}
+	return 0
+}
+
+// configuredLogDir returns [Logger.Rotation] Dir when the config folder loads, else ./log.
+func configuredLogDir() string {
+	registerConfigSchemas()
+	var lRotation utils.LogRotation
+	if config.LoadAllTOMLConfigs(config.ConfigFolder) == nil &&
+		config.GetAndAssignTomlValue("appconfig", "Logger.Rotation", &lRotation) == nil && lRotation.Dir != "" {
+		return lRotation.Dir
+	}
+	return "./log"
+}
@@ -15,10 +15,20 @@ const (
 	UPDATE = "UPDATE"
 
 	DateLayout = "2006-01-02"
+
+	// Error classes of CommonResp.ErrClass
+	ErrClassInvalid     = "invalid"     // 400, the request failed validation
+	ErrClassInternal    = "internal"    // 500
+	ErrClassUnavailable = "unavailable" // 503, the database is down
+	ErrClassRejected    = "rejected"    // 503, a circuit breaker or bulkhead turned the request away
+	ErrClassTimeout     = "timeout"     // 504, a query ran past its timeout
 )
 
 type CommonResp struct {
 	DetailsArr any    `json:"respData"`
 	Status     string `json:"status"`
 	ErrMsg     string `json:"errMsg"`
+	ErrClass   string `json:"errClass,omitempty"` // one of the ErrClass constants
+	ErrCode    int    `json:"errCode,omitempty"`  // HTTP status of an error response, 200 when unset
+	ReqID      string `json:"reqId"`
 }
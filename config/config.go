@@ -1,66 +1,162 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"lumelpkg/common"
 	"lumelpkg/utils"
+	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
-
-	"github.com/BurntSushi/toml"
+	"time"
 )
 
+// ConfigFolder is the folder scanned for TOML files on start and on every reload
+const ConfigFolder = "./toml"
+
 func Init(logger *utils.Logger) {
 	logger.Log(common.DEBUG, "3", "LoadTOMLFile (+) ")
 	// Load configs from the directory on server start
-	LoadAllTOMLConfigs("./toml")
+	if lErr := LoadAllTOMLConfigs(ConfigFolder); lErr != nil {
+		log.Fatalf("Invalid config in folder %s:\n%v", ConfigFolder, lErr)
+	}
 	logger.Log(common.DEBUG, "3", "LoadTOMLFile (-) ")
 }
 
 var (
-	// ConfigMap stores all TOML configs with the filename (without .toml) as key
+	// ConfigMap stores all configs with the filename (without extension) as key
 	ConfigMap = make(map[string]map[string]any)
 
-	// mu ensures thread-safe access to ConfigMap
-	mu sync.RWMutex
+	// loadedSources records where each leaf value of ConfigMap came from
+	loadedSources = make(map[string]string)
+
+	// loadedFiles lists the files behind ConfigMap with their content hash
+	loadedFiles []LoadedFile
+
+	// loadedProfile is the profile ConfigMap was loaded with
+	loadedProfile string
+
+	// lastReload is when ConfigMap was last swapped in
+	lastReload time.Time
 
-	// once ensures config is loaded only once
-	once sync.Once
+	// mu ensures thread-safe access to ConfigMap and its load details
+	mu sync.RWMutex
 )
 
-// LoadAllTOMLConfigs loads all .toml files from the given folder into ConfigMap
-func LoadAllTOMLConfigs(folderPath string) {
-	once.Do(func() {
-		err := filepath.WalkDir(folderPath, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
-			if d.IsDir() {
-				return nil
-			}
-			if strings.HasSuffix(d.Name(), ".toml") {
-				var data map[string]any
-				if _, err := toml.DecodeFile(path, &data); err != nil {
-					log.Fatalf("Failed to decode TOML file %s: %v", path, err)
-				}
+// LoadedFile describes one config file that contributed to ConfigMap.
+type LoadedFile struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Layer  string `json:"layer"`
+	SHA256 string `json:"sha256"`
+}
 
-				filename := strings.TrimSuffix(d.Name(), ".toml")
+// configSet is the result of one load: the merged values plus where each came from.
+type configSet struct {
+	values  map[string]map[string]any
+	sources map[string]string // e.g. "dbconfig.Databases.localDB.Server" -> "base:toml/dbconfig.toml"
+	files   []LoadedFile
+	profile string // LUMEL_PROFILE at load time, "" for none
+}
 
-				mu.Lock()
-				ConfigMap[filename] = data
-				mu.Unlock()
+// LoadAllTOMLConfigs loads all config files (.toml, .yaml/.yml, .json, .env) from the
+// given folder into ConfigMap.
+// The active profile overlay and LUMEL_ environment overrides are merged on top and
+// the result is checked against the registered schemas.
+// Every file is parsed first and ConfigMap is only replaced, in one step, when all of
+// them decode successfully. On error the previously loaded config stays in place.
+func LoadAllTOMLConfigs(folderPath string) error {
+	lSet, lErr := loadConfigSet(folderPath)
+	if lErr != nil {
+		return lErr
+	}
+	if lErr := validateConfigSet(lSet.values); lErr != nil {
+		return lErr
+	}
+
+	// enc: values of the new config are decrypted with the key file as it is now
+	reloadSecretKey()
+
+	mu.Lock()
+	ConfigMap = lSet.values
+	loadedSources = lSet.sources
+	loadedFiles = lSet.files
+	loadedProfile = lSet.profile
+	lastReload = time.Now()
+	mu.Unlock()
+
+	// Tell subscribers about every watched key whose value changed
+	notifySubscribers(lSet.values)
+	return nil
+}
+
+// parseConfigFolder decodes every supported config file directly inside folderPath into a
+// fresh map without touching ConfigMap. The file name without extension is the map key and
+// the extension picks the loader (see loaders). Sub-folders hold profile overlays and are skipped.
+// Decode failures are collected so every broken file is reported at once.
+// pLayer ("base" or "profile") is recorded on every returned LoadedFile.
+func parseConfigFolder(folderPath, pLayer string) (map[string]map[string]any, []LoadedFile, error) {
+	lConfigs := make(map[string]map[string]any)
+	lSeen := make(map[string]string)
+	var lFiles []LoadedFile
+	var lDecodeErrs []error
+
+	err := filepath.WalkDir(folderPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != folderPath {
+				return fs.SkipDir
 			}
 			return nil
-		})
+		}
 
+		loader, filename, ok := loaderFor(d.Name())
+		if !ok {
+			return nil
+		}
+		if previous, exists := lSeen[filename]; exists {
+			lDecodeErrs = append(lDecodeErrs, fmt.Errorf("config %s defined twice: %s and %s", filename, previous, path))
+			return nil
+		}
+		lSeen[filename] = path
+
+		content, err := os.ReadFile(path)
 		if err != nil {
-			log.Fatalf("Error reading TOML config files from folder %s: %v", folderPath, err)
+			return err
 		}
+
+		data, err := loader(content)
+		if err != nil {
+			lDecodeErrs = append(lDecodeErrs, fmt.Errorf("failed to decode config file %s: %w", path, err))
+			return nil
+		}
+		lConfigs[filename] = data
+
+		sum := sha256.Sum256(content)
+		lFiles = append(lFiles, LoadedFile{
+			Name:   filename,
+			Path:   path,
+			Layer:  pLayer,
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+		return nil
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(lDecodeErrs) > 0 {
+		return nil, nil, errors.Join(lDecodeErrs...)
+	}
+	return lConfigs, lFiles, nil
 }
 
 // GetConfig returns the entire config map for a given TOML filename (without extension)
@@ -97,10 +193,15 @@ Example usage:
 
   var creds struct {
       Username string
-      Password string
+      Password string `secret:"true"`
   }
   err := GetAndAssignTomlValue("app", "database.credentials", &creds)
 
+Secret references in fields tagged `secret:"true"` are resolved after assigning, so a
+password stored as
+  password = "env:DB_PASS"
+is returned as the value of the DB_PASS environment variable. See resolveSecretFields.
+
 Returns:
   - nil on success
   - error if file/key not found or type mismatch
@@ -112,9 +213,21 @@ func GetAndAssignTomlValue(filename, key string, out any) error {
 	mu.RLock()
 	defer mu.RUnlock()
 
-	data, ok := ConfigMap[filename]
+	current, err := lookupValue(ConfigMap, filename, key)
+	if err != nil {
+		return err
+	}
+	return assignValue(current, out)
+}
+
+// errNotFound is wrapped by lookupValue when the file or one of the keys does not exist
+var errNotFound = errors.New("not found")
+
+// lookupValue walks a dot-separated key inside one file of the given config set.
+func lookupValue(configs map[string]map[string]any, filename, key string) (any, error) {
+	data, ok := configs[filename]
 	if !ok {
-		return fmt.Errorf("config file not found: %s", filename)
+		return nil, fmt.Errorf("config file %w: %s", errNotFound, filename)
 	}
 
 	keys := strings.Split(key, ".")
@@ -123,15 +236,30 @@ func GetAndAssignTomlValue(filename, key string, out any) error {
 	for _, k := range keys {
 		m, ok := current.(map[string]any)
 		if !ok {
-			return fmt.Errorf("intermediate value is not a map at key: %s", k)
+			return nil, fmt.Errorf("intermediate value is not a map at key: %s", k)
 		}
 		current, ok = m[k]
 		if !ok {
-			return fmt.Errorf("key not found: %s", k)
+			return nil, fmt.Errorf("key %w: %s", errNotFound, k)
 		}
 	}
+	return current, nil
+}
+
+// assignValue converts a raw config value into out (a pointer) using JSON marshal/unmarshal.
+// Secret references (env:, file:, enc:) in fields tagged `secret:"true"` are resolved afterwards.
+func assignValue(current, out any) error {
+	if err := decodeValue(current, out); err != nil {
+		return err
+	}
+	if err := resolveSecretFields(reflect.ValueOf(out), false); err != nil {
+		return fmt.Errorf("secret error: %w", err)
+	}
+	return nil
+}
 
-	// Convert to desired type using JSON marshal/unmarshal
+// decodeValue converts a raw config value into out without resolving secrets.
+func decodeValue(current, out any) error {
 	bytes, err := json.Marshal(current)
 	if err != nil {
 		return fmt.Errorf("marshal error: %w", err)
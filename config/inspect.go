@@ -0,0 +1,107 @@
+package config
+
+import (
+	"lumelpkg/utils"
+	"sort"
+	"time"
+)
+
+// maskedValue replaces every value whose key looks sensitive
+const maskedValue = "******"
+
+// InspectedValue is one leaf of the effective config together with its origin.
+type InspectedValue struct {
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+// Inspection is a redacted view of the effective configuration for admin endpoints.
+type Inspection struct {
+	Profile    string                    `json:"profile"`
+	LastReload time.Time                 `json:"lastReload"`
+	Files      []LoadedFile              `json:"files"`
+	Values     map[string]map[string]any `json:"values"`
+}
+
+// Inspect returns the effective ConfigMap with the source of every value, the last reload
+// time and the content hash of each file. Values under keys the log redacts as well
+// (see utils.SensitiveKey) are masked.
+func Inspect() Inspection {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	lInspection := Inspection{
+		Profile:    loadedProfile,
+		LastReload: lastReload,
+		Files:      append([]LoadedFile(nil), loadedFiles...),
+		Values:     make(map[string]map[string]any, len(ConfigMap)),
+	}
+	sort.Slice(lInspection.Files, func(i, j int) bool {
+		return lInspection.Files[i].Path < lInspection.Files[j].Path
+	})
+
+	for lFile, lData := range ConfigMap {
+		lInspection.Values[lFile] = inspectTable(lFile, lData, "", false)
+	}
+	return lInspection
+}
+
+// inspectTable copies a table, wrapping each leaf with its source and masking sensitive ones.
+// pMask is set once any enclosing key was sensitive, so whole secret tables are hidden.
+// pSource is the source of an enclosing array of tables, whose leaves have none of their own.
+func inspectTable(pPath string, pData map[string]any, pSource string, pMask bool) map[string]any {
+	lResult := make(map[string]any, len(pData))
+	for lKey, lValue := range pData {
+		lResult[lKey] = inspectValue(pPath+"."+lKey, lValue, pSource, pMask || utils.SensitiveKey(lKey))
+	}
+	return lResult
+}
+
+// inspectValue descends into tables and arrays of tables and wraps everything else as one leaf.
+func inspectValue(pPath string, pValue any, pSource string, pMask bool) any {
+	if lTable, ok := pValue.(map[string]any); ok {
+		return inspectTable(pPath, lTable, pSource, pMask)
+	}
+
+	// The loaders record an array under its own path, its elements share that source
+	if pSource == "" {
+		pSource = loadedSources[pPath]
+	}
+	switch lArray := pValue.(type) {
+	case []map[string]any:
+		lItems := make([]any, len(lArray))
+		for i, lTable := range lArray {
+			lItems[i] = inspectTable(pPath, lTable, pSource, pMask)
+		}
+		return lItems
+	case []any:
+		if containsTable(lArray) {
+			lItems := make([]any, len(lArray))
+			for i, lItem := range lArray {
+				lItems[i] = inspectValue(pPath, lItem, pSource, pMask)
+			}
+			return lItems
+		}
+	}
+
+	lInspected := InspectedValue{Value: pValue, Source: pSource}
+	if pMask {
+		lInspected.Value = maskedValue
+	}
+	return lInspected
+}
+
+// containsTable reports whether an array holds a table at any depth.
+func containsTable(pArray []any) bool {
+	for _, lItem := range pArray {
+		switch lValue := lItem.(type) {
+		case map[string]any, []map[string]any:
+			return true
+		case []any:
+			if containsTable(lValue) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testUpstreams holds secrets in an array of tables, a sub-table of an element and an inline array
+const testUpstreams = `
+[[Upstreams]]
+Name = "primary"
+Password = "hunter2"
+
+[[Upstreams]]
+Name = "fallback"
+[Upstreams.Auth]
+ApiKey = "k-123"
+
+[Hooks]
+Inline = [{ Name = "audit", Token = "t-456" }]
+Ports = [80, 443]
+`
+
+func TestInspectMasksArraysOfTables(t *testing.T) {
+	lFolder := t.TempDir()
+	writeTestConfig(t, lFolder, "upstreams.toml", testUpstreams)
+	loadTestConfig(t, lFolder)
+
+	lValues := Inspect().Values["upstreams"]
+	tests := []struct {
+		path []any
+		want string
+	}{
+		{[]any{"Upstreams", 0, "Name"}, "primary"},
+		{[]any{"Upstreams", 0, "Password"}, maskedValue},
+		{[]any{"Upstreams", 1, "Name"}, "fallback"},
+		{[]any{"Upstreams", 1, "Auth", "ApiKey"}, maskedValue},
+		{[]any{"Hooks", "Inline", 0, "Name"}, "audit"},
+		{[]any{"Hooks", "Inline", 0, "Token"}, maskedValue},
+		{[]any{"Hooks", "Ports"}, "[80 443]"},
+	}
+	for _, tt := range tests {
+		lLeaf, ok := lookupInspected(lValues, tt.path)
+		if !ok {
+			t.Errorf("%v is not an inspected value in %v", tt.path, lValues)
+			continue
+		}
+		if lGot := fmt.Sprint(lLeaf.Value); lGot != tt.want {
+			t.Errorf("%v = %q, want %q", tt.path, lGot, tt.want)
+		}
+		if !strings.HasPrefix(lLeaf.Source, "base:") {
+			t.Errorf("%v has source %q", tt.path, lLeaf.Source)
+		}
+	}
+
+	lJSON, lErr := json.Marshal(lValues)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	for _, lSecret := range []string{"hunter2", "k-123", "t-456"} {
+		if strings.Contains(string(lJSON), lSecret) {
+			t.Errorf("inspection leaks %q: %s", lSecret, lJSON)
+		}
+	}
+}
+
+// lookupInspected follows table keys and array indexes down to one inspected value.
+func lookupInspected(pValue any, pPath []any) (InspectedValue, bool) {
+	for _, lStep := range pPath {
+		switch lKey := lStep.(type) {
+		case string:
+			lTable, ok := pValue.(map[string]any)
+			if !ok {
+				return InspectedValue{}, false
+			}
+			pValue = lTable[lKey]
+		case int:
+			lArray, ok := pValue.([]any)
+			if !ok || lKey >= len(lArray) {
+				return InspectedValue{}, false
+			}
+			pValue = lArray[lKey]
+		}
+	}
+	lLeaf, ok := pValue.(InspectedValue)
+	return lLeaf, ok
+}
+
+// writeTestConfig writes one config file into pFolder.
+func writeTestConfig(t *testing.T, pFolder, pName, pContent string) {
+	t.Helper()
+	if lErr := os.WriteFile(filepath.Join(pFolder, pName), []byte(pContent), 0o600); lErr != nil {
+		t.Fatal(lErr)
+	}
+}
+
+// loadTestConfig loads pFolder as the active config without a profile.
+func loadTestConfig(t *testing.T, pFolder string) {
+	t.Helper()
+	t.Setenv(ProfileEnv, "")
+	if lErr := LoadAllTOMLConfigs(pFolder); lErr != nil {
+		t.Fatal(lErr)
+	}
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Loader decodes the content of one config file into the table stored in ConfigMap.
+// Loaders must return nested tables as map[string]any, integers as int64 and
+// other numbers as float64, the same shapes the TOML decoder produces.
+type Loader func(pContent []byte) (map[string]any, error)
+
+var (
+	// loaders maps a lower-case file extension to its decoder
+	loaders = map[string]Loader{
+		".toml": loadTOML,
+		".yaml": loadYAML,
+		".yml":  loadYAML,
+		".json": loadJSON,
+		".env":  loadDotEnv,
+	}
+
+	// loaderMu guards loaders
+	loaderMu sync.RWMutex
+)
+
+// RegisterLoader adds or replaces the loader used for files with the given extension, e.g. ".ini".
+func RegisterLoader(pExt string, pLoader Loader) {
+	loaderMu.Lock()
+	defer loaderMu.Unlock()
+	loaders[strings.ToLower(pExt)] = pLoader
+}
+
+// loaderFor returns the loader and the ConfigMap key for a file name.
+// A bare ".env" file is stored under "env".
+func loaderFor(pName string) (Loader, string, bool) {
+	lExt := strings.ToLower(filepath.Ext(pName))
+
+	loaderMu.RLock()
+	lLoader, ok := loaders[lExt]
+	loaderMu.RUnlock()
+	if !ok {
+		return nil, "", false
+	}
+
+	lFilename := strings.TrimSuffix(pName, filepath.Ext(pName))
+	if lFilename == "" {
+		lFilename = strings.TrimPrefix(lExt, ".")
+	}
+	return lLoader, lFilename, true
+}
+
+func loadTOML(pContent []byte) (map[string]any, error) {
+	var lData map[string]any
+	if _, lErr := toml.Decode(string(pContent), &lData); lErr != nil {
+		return nil, lErr
+	}
+	return lData, nil
+}
+
+func loadYAML(pContent []byte) (map[string]any, error) {
+	var lData map[string]any
+	if lErr := yaml.Unmarshal(pContent, &lData); lErr != nil {
+		return nil, lErr
+	}
+	lNormalized, lErr := normalizeValue(lData)
+	if lErr != nil {
+		return nil, lErr
+	}
+	lTable, _ := lNormalized.(map[string]any)
+	return lTable, nil
+}
+
+func loadJSON(pContent []byte) (map[string]any, error) {
+	lDecoder := json.NewDecoder(bytes.NewReader(pContent))
+	lDecoder.UseNumber()
+
+	var lData map[string]any
+	if lErr := lDecoder.Decode(&lData); lErr != nil {
+		return nil, lErr
+	}
+	lNormalized, lErr := normalizeValue(lData)
+	if lErr != nil {
+		return nil, lErr
+	}
+	lTable, _ := lNormalized.(map[string]any)
+	return lTable, nil
+}
+
+// loadDotEnv reads KEY=VALUE lines. As with environment overrides, "__" inside a key
+// nests it, so DBNAME__SERVER=x becomes the table DBNAME with key SERVER.
+// Values are typed like environment overrides; surrounding quotes are removed.
+func loadDotEnv(pContent []byte) (map[string]any, error) {
+	lData := make(map[string]any)
+	lScanner := bufio.NewScanner(bytes.NewReader(pContent))
+
+	for lLineNo := 1; lScanner.Scan(); lLineNo++ {
+		lLine := strings.TrimSpace(lScanner.Text())
+		if lLine == "" || strings.HasPrefix(lLine, "#") {
+			continue
+		}
+		lLine = strings.TrimPrefix(lLine, "export ")
+
+		lKey, lValue, ok := strings.Cut(lLine, "=")
+		lKey = strings.TrimSpace(lKey)
+		if !ok || lKey == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lLineNo)
+		}
+
+		lValue = strings.TrimSpace(lValue)
+		lQuoted := len(lValue) >= 2 && (lValue[0] == '"' || lValue[0] == '\'') && lValue[len(lValue)-1] == lValue[0]
+		if lQuoted {
+			lValue = lValue[1 : len(lValue)-1]
+		}
+
+		lParts := strings.Split(lKey, envKeySeparator)
+		lCurrent := lData
+		for _, lPart := range lParts[:len(lParts)-1] {
+			lNext, ok := lCurrent[lPart].(map[string]any)
+			if !ok {
+				if _, exists := lCurrent[lPart]; exists {
+					return nil, fmt.Errorf("line %d: %s is not a table", lLineNo, lPart)
+				}
+				lNext = make(map[string]any)
+				lCurrent[lPart] = lNext
+			}
+			lCurrent = lNext
+		}
+
+		lLeaf := lParts[len(lParts)-1]
+		if lQuoted {
+			lCurrent[lLeaf] = lValue
+		} else {
+			lCurrent[lLeaf] = convertEnvValue(nil, lValue)
+		}
+	}
+	if lErr := lScanner.Err(); lErr != nil {
+		return nil, lErr
+	}
+	return lData, nil
+}
+
+// normalizeValue converts decoder specific shapes into the TOML ones: nested maps become
+// map[string]any, integers int64 and other numbers float64.
+func normalizeValue(pValue any) (any, error) {
+	switch lValue := pValue.(type) {
+	case map[string]any:
+		for lKey, lItem := range lValue {
+			lNormalized, lErr := normalizeValue(lItem)
+			if lErr != nil {
+				return nil, lErr
+			}
+			lValue[lKey] = lNormalized
+		}
+		return lValue, nil
+	case map[any]any:
+		lTable := make(map[string]any, len(lValue))
+		for lKey, lItem := range lValue {
+			lNormalized, lErr := normalizeValue(lItem)
+			if lErr != nil {
+				return nil, lErr
+			}
+			lTable[fmt.Sprint(lKey)] = lNormalized
+		}
+		return lTable, nil
+	case []any:
+		for lIdx, lItem := range lValue {
+			lNormalized, lErr := normalizeValue(lItem)
+			if lErr != nil {
+				return nil, lErr
+			}
+			lValue[lIdx] = lNormalized
+		}
+		return lValue, nil
+	case json.Number:
+		if lInt, lErr := lValue.Int64(); lErr == nil {
+			return lInt, nil
+		}
+		return lValue.Float64()
+	case int:
+		return int64(lValue), nil
+	case uint64:
+		return int64(lValue), nil
+	}
+	return pValue, nil
+}
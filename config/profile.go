@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ProfileEnv names the environment variable holding the active profile, e.g. "prod".
+	// The profile overlay is read from a sub-folder of the config folder with that name.
+	ProfileEnv = "LUMEL_PROFILE"
+
+	// EnvPrefix marks environment variables that override config values.
+	// LUMEL_DBCONFIG__DATABASES__LOCALDB__SERVER overrides key Databases.localDB.Server of dbconfig.toml.
+	EnvPrefix = "LUMEL_"
+
+	// envKeySeparator splits the file name and key path inside an override variable
+	envKeySeparator = "__"
+)
+
+// ActiveProfile returns the profile selected through LUMEL_PROFILE, or "" for none.
+func ActiveProfile() string {
+	return strings.TrimSpace(os.Getenv(ProfileEnv))
+}
+
+// loadConfigSet builds the effective config: the base folder, then the profile
+// overlay deep-merged on top, then environment overrides. The layer that set each
+// leaf value is recorded in the returned sources.
+func loadConfigSet(folderPath string) (*configSet, error) {
+	lConfigs, lFiles, lErr := parseConfigFolder(folderPath, "base")
+	if lErr != nil {
+		return nil, lErr
+	}
+
+	lSet := &configSet{
+		values:  lConfigs,
+		sources: make(map[string]string),
+		files:   lFiles,
+	}
+	for _, lFile := range lFiles {
+		markSources(lSet.sources, lFile.Name, lConfigs[lFile.Name], "base:"+lFile.Path)
+	}
+
+	lSet.profile = ActiveProfile()
+	if lProfile := lSet.profile; lProfile != "" {
+		lOverlayPath := filepath.Join(folderPath, lProfile)
+		if lInfo, lErr := os.Stat(lOverlayPath); lErr != nil || !lInfo.IsDir() {
+			return nil, fmt.Errorf("profile folder not found for %s=%s: %s", ProfileEnv, lProfile, lOverlayPath)
+		}
+
+		lOverlay, lOverlayFiles, lErr := parseConfigFolder(lOverlayPath, "profile")
+		if lErr != nil {
+			return nil, lErr
+		}
+		for _, lFile := range lOverlayFiles {
+			lConfigs[lFile.Name] = mergeMaps(lConfigs[lFile.Name], lOverlay[lFile.Name])
+			markSources(lSet.sources, lFile.Name, lOverlay[lFile.Name], "profile:"+lFile.Path)
+		}
+		lSet.files = append(lSet.files, lOverlayFiles...)
+	}
+
+	if lErr := applyEnvOverrides(lSet, os.Environ()); lErr != nil {
+		return nil, lErr
+	}
+	return lSet, nil
+}
+
+// markSources records pSource for every leaf value of pData under the pPrefix path.
+func markSources(pSources map[string]string, pPrefix string, pData map[string]any, pSource string) {
+	for lKey, lValue := range pData {
+		lPath := pPrefix + "." + lKey
+		if lTable, ok := lValue.(map[string]any); ok {
+			markSources(pSources, lPath, lTable, pSource)
+			continue
+		}
+		pSources[lPath] = pSource
+	}
+}
+
+// mergeMaps deep-merges pOverlay into pBase. Nested tables are merged key by key,
+// any other value in the overlay replaces the base value.
+func mergeMaps(pBase, pOverlay map[string]any) map[string]any {
+	if pBase == nil {
+		pBase = make(map[string]any)
+	}
+	for lKey, lValue := range pOverlay {
+		lOverlayMap, lIsMap := lValue.(map[string]any)
+		lBaseMap, lBaseIsMap := pBase[lKey].(map[string]any)
+		if lIsMap && lBaseIsMap {
+			pBase[lKey] = mergeMaps(lBaseMap, lOverlayMap)
+		} else {
+			pBase[lKey] = lValue
+		}
+	}
+	return pBase
+}
+
+// applyEnvOverrides sets every LUMEL_<FILE>__<KEY>[__<SUBKEY>...] variable into pSet.
+// File and key names match case-insensitively; missing tables and keys are created.
+func applyEnvOverrides(pSet *configSet, pEnviron []string) error {
+	pConfigs := pSet.values
+	for _, lEntry := range pEnviron {
+		lName, lValue, ok := strings.Cut(lEntry, "=")
+		if !ok || !strings.HasPrefix(lName, EnvPrefix) {
+			continue
+		}
+		lParts := strings.Split(strings.TrimPrefix(lName, EnvPrefix), envKeySeparator)
+		if len(lParts) < 2 {
+			// Not an override, e.g. LUMEL_PROFILE
+			continue
+		}
+
+		lFile := matchKey(pConfigs, lParts[0])
+		if pConfigs[lFile] == nil {
+			pConfigs[lFile] = make(map[string]any)
+		}
+
+		lCurrent := pConfigs[lFile]
+		lPath := lFile
+		for _, lPart := range lParts[1 : len(lParts)-1] {
+			lKey := matchMapKey(lCurrent, lPart)
+			lNext, ok := lCurrent[lKey].(map[string]any)
+			if !ok {
+				if _, exists := lCurrent[lKey]; exists {
+					return fmt.Errorf("env override %s: %s is not a table", lName, lKey)
+				}
+				lNext = make(map[string]any)
+				lCurrent[lKey] = lNext
+			}
+			lCurrent = lNext
+			lPath += "." + lKey
+		}
+
+		lLeaf := matchMapKey(lCurrent, lParts[len(lParts)-1])
+		lCurrent[lLeaf] = convertEnvValue(lCurrent[lLeaf], lValue)
+		pSet.sources[lPath+"."+lLeaf] = "env:" + lName
+	}
+	return nil
+}
+
+// matchKey finds the loaded file name matching pName case-insensitively.
+func matchKey(pConfigs map[string]map[string]any, pName string) string {
+	for lFile := range pConfigs {
+		if strings.EqualFold(lFile, pName) {
+			return lFile
+		}
+	}
+	return strings.ToLower(pName)
+}
+
+// matchMapKey finds the existing key matching pName case-insensitively.
+func matchMapKey(pData map[string]any, pName string) string {
+	for lKey := range pData {
+		if strings.EqualFold(lKey, pName) {
+			return lKey
+		}
+	}
+	return pName
+}
+
+// convertEnvValue parses an override into the type of the value it replaces.
+// New keys are parsed as integer, float or bool when possible, otherwise kept as string.
+func convertEnvValue(pExisting any, pValue string) any {
+	switch pExisting.(type) {
+	case string:
+		return pValue
+	case int64:
+		if lInt, lErr := strconv.ParseInt(pValue, 10, 64); lErr == nil {
+			return lInt
+		}
+	case float64:
+		if lFloat, lErr := strconv.ParseFloat(pValue, 64); lErr == nil {
+			return lFloat
+		}
+	case bool:
+		if lBool, lErr := strconv.ParseBool(pValue); lErr == nil {
+			return lBool
+		}
+	case nil:
+		if lInt, lErr := strconv.ParseInt(pValue, 10, 64); lErr == nil {
+			return lInt
+		}
+		if lFloat, lErr := strconv.ParseFloat(pValue, 64); lErr == nil {
+			return lFloat
+		}
+		if lBool, lErr := strconv.ParseBool(pValue); lErr == nil {
+			return lBool
+		}
+	}
+	return pValue
+}
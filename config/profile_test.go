@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOverridePrecedence(t *testing.T) {
+	lFolder := t.TempDir()
+	writeTestConfig(t, lFolder, "dbconfig.toml", `
+[Databases.localDB]
+Server = "base-host"
+Port = 3306
+User = "base-user"
+Database = "orders"
+
+[DBConnectionPool]
+DbConMaxOpenConns = 3
+`)
+	lProfileFolder := filepath.Join(lFolder, "prod")
+	if lErr := os.Mkdir(lProfileFolder, 0o700); lErr != nil {
+		t.Fatal(lErr)
+	}
+	writeTestConfig(t, lProfileFolder, "dbconfig.toml", `
+[Databases.localDB]
+Server = "prod-host"
+User = "prod-user"
+`)
+	t.Setenv(ProfileEnv, "prod")
+	t.Setenv("LUMEL_DBCONFIG__DATABASES__LOCALDB__SERVER", "env-host")
+	t.Setenv("LUMEL_DBCONFIG__DATABASES__LOCALDB__PORT", "5432")
+	t.Setenv("LUMEL_DBCONFIG__REPLICAS__ENABLED", "true")
+
+	lSet, lErr := loadConfigSet(lFolder)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	tests := []struct {
+		key        string
+		want       any
+		wantSource string
+	}{
+		{"Databases.localDB.Server", "env-host", "env:LUMEL_DBCONFIG__DATABASES__LOCALDB__SERVER"},
+		{"Databases.localDB.Port", int64(5432), "env:LUMEL_DBCONFIG__DATABASES__LOCALDB__PORT"},
+		{"Databases.localDB.User", "prod-user", "profile:"},
+		{"Databases.localDB.Database", "orders", "base:"},
+		{"DBConnectionPool.DbConMaxOpenConns", int64(3), "base:"},
+		{"REPLICAS.ENABLED", true, "env:LUMEL_DBCONFIG__REPLICAS__ENABLED"},
+	}
+	for _, tt := range tests {
+		lGot, lErr := lookupValue(lSet.values, "dbconfig", tt.key)
+		if lErr != nil || !reflect.DeepEqual(lGot, tt.want) {
+			t.Errorf("%s = %#v, %v, want %#v", tt.key, lGot, lErr, tt.want)
+		}
+		if lSource := lSet.sources["dbconfig."+tt.key]; !strings.HasPrefix(lSource, tt.wantSource) {
+			t.Errorf("%s comes from %q, want %q", tt.key, lSource, tt.wantSource)
+		}
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		want    map[string]map[string]any
+		wantErr string
+	}{
+		{"keys match case-insensitively",
+			[]string{"LUMEL_APPCONFIG__server__port=9090"},
+			map[string]map[string]any{"appconfig": {"Server": map[string]any{"Port": int64(9090), "Name": "api"}}}, ""},
+		{"string keeps its type",
+			[]string{"LUMEL_APPCONFIG__SERVER__NAME=42"},
+			map[string]map[string]any{"appconfig": {"Server": map[string]any{"Port": int64(8080), "Name": "42"}}}, ""},
+		{"unparsable number stays a string",
+			[]string{"LUMEL_APPCONFIG__SERVER__PORT=http"},
+			map[string]map[string]any{"appconfig": {"Server": map[string]any{"Port": "http", "Name": "api"}}}, ""},
+		{"new file and table",
+			[]string{"LUMEL_LOGCONFIG__LEVEL__DEFAULT=DEBUG"},
+			map[string]map[string]any{
+				"appconfig": {"Server": map[string]any{"Port": int64(8080), "Name": "api"}},
+				"logconfig": {"LEVEL": map[string]any{"DEFAULT": "DEBUG"}},
+			}, ""},
+		{"not overrides",
+			[]string{"LUMEL_PROFILE=prod", "LUMEL_SECRET_KEY_FILE=/k", "OTHER__X=1"},
+			map[string]map[string]any{"appconfig": {"Server": map[string]any{"Port": int64(8080), "Name": "api"}}}, ""},
+		{"value is not a table",
+			[]string{"LUMEL_APPCONFIG__SERVER__PORT__X=1"}, nil, "Port is not a table"},
+	}
+	for _, tt := range tests {
+		lSet := &configSet{
+			values:  map[string]map[string]any{"appconfig": {"Server": map[string]any{"Port": int64(8080), "Name": "api"}}},
+			sources: make(map[string]string),
+		}
+		lErr := applyEnvOverrides(lSet, tt.environ)
+		if tt.wantErr != "" {
+			if lErr == nil || !strings.Contains(lErr.Error(), tt.wantErr) {
+				t.Errorf("%s: applyEnvOverrides() = %v, want %q", tt.name, lErr, tt.wantErr)
+			}
+			continue
+		}
+		if lErr != nil {
+			t.Errorf("%s: applyEnvOverrides() = %v", tt.name, lErr)
+			continue
+		}
+		if !reflect.DeepEqual(lSet.values, tt.want) {
+			t.Errorf("%s: values = %v, want %v", tt.name, lSet.values, tt.want)
+		}
+	}
+}
+
+func TestMissingProfileFolder(t *testing.T) {
+	lFolder := t.TempDir()
+	writeTestConfig(t, lFolder, "appconfig.toml", "[Server]\nPort = 8080\n")
+	t.Setenv(ProfileEnv, "staging")
+	if _, lErr := loadConfigSet(lFolder); lErr == nil || !strings.Contains(lErr.Error(), "profile folder not found") {
+		t.Errorf("loadConfigSet() with a missing profile folder = %v", lErr)
+	}
+}
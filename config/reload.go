@@ -0,0 +1,138 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"lumelpkg/common"
+	"lumelpkg/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultPollInterval is used when appconfig.toml has no usable ConfigReload section
+const defaultPollInterval = 30 * time.Second
+
+// ReloadSettings controls how the config folder is watched for changes.
+type ReloadSettings struct {
+	PollIntervalSec int `validate:"gte=0"` // 0 disables polling; the admin endpoint still works
+}
+
+// RegisterConfigSchemas declares the appconfig.toml sections owned by this package.
+func RegisterConfigSchemas() {
+	RegisterOptionalSchema[ReloadSettings]("appconfig", "ConfigReload")
+}
+
+// reloadMu serialises reloads coming from the watcher and the admin endpoint
+var reloadMu sync.Mutex
+
+/*
+Purpose : This method is used to re-read every file in the config folder and swap ConfigMap.
+Parameter : logger - *utils.Logger
+Response :
+
+On Success:
+===========
+ConfigMap holds the freshly parsed configuration.
+
+On Error:
+===========
+The previous ConfigMap is kept untouched and the parse error is returned.
+
+Author : VIJAY
+Date : 18-10-2026
+*/
+func Reload(logger *utils.Logger) error {
+	logger.Log(common.INFO, "Reload", "(+)")
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if lErr := LoadAllTOMLConfigs(ConfigFolder); lErr != nil {
+		logger.Log(common.ERROR, "CRL-001", lErr.Error())
+		return fmt.Errorf("Reload - (CRL-001) %w", lErr)
+	}
+
+	logger.Log(common.INFO, "Reload", "(-)")
+	return nil
+}
+
+// WatchConfigFolder polls the config folder and reloads ConfigMap whenever a file
+// is added, removed or modified. It never returns, so run it in its own goroutine.
+func WatchConfigFolder(logger *utils.Logger) {
+	logger.Log(common.INFO, "WatchConfigFolder", "Started")
+
+	lFingerprint, lErr := folderFingerprint(ConfigFolder)
+	if lErr != nil {
+		logger.Log(common.ERROR, "CWF-001", lErr.Error())
+	}
+
+	for {
+		lInterval, lEnabled := pollInterval()
+		time.Sleep(lInterval)
+		if !lEnabled {
+			continue
+		}
+
+		lCurrent, lErr := folderFingerprint(ConfigFolder)
+		if lErr != nil {
+			logger.Log(common.ERROR, "CWF-002", lErr.Error())
+			continue
+		}
+		if lCurrent == lFingerprint {
+			continue
+		}
+
+		// Remember the new state even when the reload fails, so a broken file is
+		// reported once and retried only after it changes again
+		lFingerprint = lCurrent
+		logger.Log(common.INFO, "WatchConfigFolder", "Change detected, reloading")
+		if lErr := Reload(logger); lErr != nil {
+			logger.Log(common.ERROR, "CWF-003", "Keeping previous config: "+lErr.Error())
+		}
+	}
+}
+
+// pollInterval reads the watcher interval from appconfig.toml, falling back to the default.
+func pollInterval() (time.Duration, bool) {
+	var lSettings ReloadSettings
+	if lErr := GetAndAssignTomlValue("appconfig", "ConfigReload", &lSettings); lErr != nil {
+		return defaultPollInterval, true
+	}
+	if lSettings.PollIntervalSec <= 0 {
+		return defaultPollInterval, false
+	}
+	return time.Duration(lSettings.PollIntervalSec) * time.Second, true
+}
+
+// folderFingerprint returns a hash over the names and contents of every file in the folder.
+func folderFingerprint(folderPath string) (string, error) {
+	var lPaths []string
+	err := filepath.WalkDir(folderPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			lPaths = append(lPaths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(lPaths)
+
+	lHash := sha256.New()
+	for _, lPath := range lPaths {
+		lData, lErr := os.ReadFile(lPath)
+		if lErr != nil {
+			return "", lErr
+		}
+		fmt.Fprintf(lHash, "%s:%d\n", lPath, len(lData))
+		lHash.Write(lData)
+	}
+	return hex.EncodeToString(lHash.Sum(nil)), nil
+}
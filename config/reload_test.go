@@ -0,0 +1,46 @@
+package config
+
+import "testing"
+
+func TestLoadKeepsPreviousConfigOnError(t *testing.T) {
+	lFolder := t.TempDir()
+	writeTestConfig(t, lFolder, "appconfig.toml", "[Server]\nPort = 8080\n")
+	writeTestConfig(t, lFolder, "dbconfig.toml", "[DBConnectionPool]\nDbConMaxOpenConns = 3\n")
+	loadTestConfig(t, lFolder)
+
+	// Each step rewrites one file and loads the folder again
+	tests := []struct {
+		step     string
+		file     string
+		content  string
+		wantErr  bool
+		wantPort int
+		wantOpen int
+	}{
+		{"value changes", "appconfig.toml", "[Server]\nPort = 9090\n", false, 9090, 3},
+		{"broken file", "dbconfig.toml", "[DBConnectionPool\nDbConMaxOpenConns = 5\n", true, 9090, 3},
+		{"file fixed", "dbconfig.toml", "[DBConnectionPool]\nDbConMaxOpenConns = 5\n", false, 9090, 5},
+		{"other file broken", "appconfig.toml", "[Server]\nPort = \n", true, 9090, 5},
+	}
+	for _, tt := range tests {
+		lBefore, lErr := folderFingerprint(lFolder)
+		if lErr != nil {
+			t.Fatal(lErr)
+		}
+		writeTestConfig(t, lFolder, tt.file, tt.content)
+		if lAfter, _ := folderFingerprint(lFolder); lAfter == lBefore {
+			t.Errorf("%s: folder fingerprint did not change", tt.step)
+		}
+
+		if lErr := LoadAllTOMLConfigs(lFolder); (lErr != nil) != tt.wantErr {
+			t.Errorf("%s: LoadAllTOMLConfigs() = %v, want error %v", tt.step, lErr, tt.wantErr)
+		}
+		var lPort, lOpen int
+		if lErr := GetAndAssignTomlValue("appconfig", "Server.Port", &lPort); lErr != nil || lPort != tt.wantPort {
+			t.Errorf("%s: Server.Port = %d, %v, want %d", tt.step, lPort, lErr, tt.wantPort)
+		}
+		if lErr := GetAndAssignTomlValue("dbconfig", "DBConnectionPool.DbConMaxOpenConns", &lOpen); lErr != nil || lOpen != tt.wantOpen {
+			t.Errorf("%s: DbConMaxOpenConns = %d, %v, want %d", tt.step, lOpen, lErr, tt.wantOpen)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// schema is the Go type expected at one file/key of the config.
+type schema struct {
+	filename string
+	key      string
+	newValue func() any
+	optional bool // the key may be left out, its reader falls back to defaults
+}
+
+var (
+	// schemas holds every type registered through RegisterSchema
+	schemas []schema
+
+	// schemaMu guards schemas
+	schemaMu sync.Mutex
+
+	// schemaValidator checks the `validate` tags of registered structs
+	schemaValidator = validator.New()
+)
+
+/*
+RegisterSchema declares that filename/key must decode into T. When T is a struct its
+go-playground/validator `validate` tags are checked as well. Register schemas before
+config.Init so the very first load is validated.
+
+Example usage:
+
+	config.RegisterSchema[db.DBConnectionPool]("dbconfig", "DBConnectionPool")
+*/
+func RegisterSchema[T any](filename, key string) {
+	registerSchema[T](filename, key, false)
+}
+
+/*
+RegisterOptionalSchema is RegisterSchema for a section that may be left out of the config,
+because the code reading it falls back to defaults. It is only validated when present.
+
+Example usage:
+
+	config.RegisterOptionalSchema[db.HealthCheck]("dbconfig", "HealthCheck")
+*/
+func RegisterOptionalSchema[T any](filename, key string) {
+	registerSchema[T](filename, key, true)
+}
+
+// registerSchema appends one schema to schemas.
+func registerSchema[T any](filename, key string, optional bool) {
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+
+	schemas = append(schemas, schema{
+		filename: filename,
+		key:      key,
+		newValue: func() any { return new(T) },
+		optional: optional,
+	})
+}
+
+// ValidateFolder loads a config folder the same way LoadAllTOMLConfigs does, including
+// profile overlay and env overrides, and returns every problem found without touching ConfigMap.
+func ValidateFolder(folderPath string) error {
+	lSet, lErr := loadConfigSet(folderPath)
+	if lErr != nil {
+		return lErr
+	}
+	return validateConfigSet(lSet.values)
+}
+
+// validateConfigSet checks every registered schema against pConfigs and joins all
+// missing required keys, decode errors and failed validation rules into one error.
+// Secret references are not resolved here, so a folder can be checked without its secrets.
+func validateConfigSet(pConfigs map[string]map[string]any) error {
+	schemaMu.Lock()
+	lSchemas := make([]schema, len(schemas))
+	copy(lSchemas, schemas)
+	schemaMu.Unlock()
+
+	var lErrs []error
+	for _, lSchema := range lSchemas {
+		lPath := lSchema.filename + "." + lSchema.key
+
+		lRaw, lErr := lookupValue(pConfigs, lSchema.filename, lSchema.key)
+		if lErr != nil && lSchema.optional && errors.Is(lErr, errNotFound) {
+			continue
+		}
+		if lErr != nil {
+			lErrs = append(lErrs, fmt.Errorf("%s: %w", lPath, lErr))
+			continue
+		}
+
+		lValue := lSchema.newValue()
+		if lErr := decodeValue(lRaw, lValue); lErr != nil {
+			lErrs = append(lErrs, fmt.Errorf("%s: %w", lPath, lErr))
+			continue
+		}
+
+		// Structs are validated directly, maps of structs entry by entry
+		lElem := reflect.ValueOf(lValue).Elem()
+		switch lElem.Kind() {
+		case reflect.Struct:
+			lErrs = append(lErrs, validateStruct(lPath, lValue)...)
+		case reflect.Map:
+			lIter := lElem.MapRange()
+			for lIter.Next() {
+				if reflect.Indirect(lIter.Value()).Kind() == reflect.Struct {
+					lErrs = append(lErrs, validateStruct(fmt.Sprintf("%s.%v", lPath, lIter.Key()), lIter.Value().Interface())...)
+				}
+			}
+		}
+	}
+	return errors.Join(lErrs...)
+}
+
+// validateStruct runs the validator on one struct and returns one error per failed rule.
+func validateStruct(pPath string, pValue any) []error {
+	lErr := schemaValidator.Struct(pValue)
+	if lErr == nil {
+		return nil
+	}
+
+	var lFieldErrs validator.ValidationErrors
+	if !errors.As(lErr, &lFieldErrs) {
+		return []error{fmt.Errorf("%s: %w", pPath, lErr)}
+	}
+
+	lErrs := make([]error, 0, len(lFieldErrs))
+	for _, lFieldErr := range lFieldErrs {
+		lErrs = append(lErrs, fmt.Errorf("%s.%s: %s", pPath, fieldPath(lFieldErr), ruleText(lFieldErr)))
+	}
+	return lErrs
+}
+
+// fieldPath drops the struct type name from the validator namespace.
+func fieldPath(pErr validator.FieldError) string {
+	_, lField, ok := strings.Cut(pErr.StructNamespace(), ".")
+	if !ok {
+		return pErr.StructField()
+	}
+	return lField
+}
+
+// ruleText describes which validation rule a field failed. The value is left out on
+// purpose, the field may hold a secret.
+func ruleText(pErr validator.FieldError) string {
+	if pErr.Param() != "" {
+		return fmt.Sprintf("failed '%s' rule with parameter '%s'", pErr.ActualTag(), pErr.Param())
+	}
+	return fmt.Sprintf("failed '%s' rule", pErr.ActualTag())
+}
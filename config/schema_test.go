@@ -0,0 +1,134 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+type testPool struct {
+	MaxOpen int `validate:"gte=1"`
+	MaxIdle int `validate:"gte=0,ltefield=MaxOpen"`
+}
+
+type testDatabase struct {
+	Server   string `validate:"required"`
+	Password string `secret:"true"`
+	DBType   string `validate:"oneof=mysql sqlite"`
+}
+
+type testReload struct {
+	PollIntervalSec int `validate:"gte=0"`
+}
+
+func TestValidateConfigSet(t *testing.T) {
+	useTestSchemas(t)
+	RegisterSchema[testPool]("dbconfig", "Pool")
+	RegisterSchema[map[string]testDatabase]("dbconfig", "Databases")
+	RegisterOptionalSchema[testReload]("appconfig", "Reload")
+
+	// lValid returns a config that passes every schema, edit changes it per case
+	lValid := func() map[string]map[string]any {
+		return map[string]map[string]any{
+			"dbconfig": {
+				"Pool":      map[string]any{"MaxOpen": int64(3), "MaxIdle": int64(2)},
+				"Databases": map[string]any{"localDB": map[string]any{"Server": "db", "DBType": "mysql", "Password": "env:DB_PASS"}},
+			},
+			"appconfig": {},
+		}
+	}
+	tests := []struct {
+		name     string
+		edit     func(map[string]map[string]any)
+		wantErrs []string
+	}{
+		{"valid", func(map[string]map[string]any) {}, nil},
+		{"optional section present and valid",
+			func(pConfigs map[string]map[string]any) {
+				pConfigs["appconfig"]["Reload"] = map[string]any{"PollIntervalSec": int64(5)}
+			}, nil},
+		{"optional section present and invalid",
+			func(pConfigs map[string]map[string]any) {
+				pConfigs["appconfig"]["Reload"] = map[string]any{"PollIntervalSec": int64(-1)}
+			},
+			[]string{"appconfig.Reload.PollIntervalSec: failed 'gte' rule with parameter '0'"}},
+		{"required section missing",
+			func(pConfigs map[string]map[string]any) { delete(pConfigs["dbconfig"], "Pool") },
+			[]string{"dbconfig.Pool: "}},
+		{"required file missing",
+			func(pConfigs map[string]map[string]any) { delete(pConfigs, "dbconfig") },
+			[]string{"dbconfig.Pool: ", "dbconfig.Databases: "}},
+		{"wrong type",
+			func(pConfigs map[string]map[string]any) {
+				pConfigs["dbconfig"]["Pool"].(map[string]any)["MaxOpen"] = "three"
+			},
+			[]string{"dbconfig.Pool: "}},
+		{"cross-field rule",
+			func(pConfigs map[string]map[string]any) {
+				pConfigs["dbconfig"]["Pool"].(map[string]any)["MaxIdle"] = int64(4)
+			},
+			[]string{"dbconfig.Pool.MaxIdle: failed 'ltefield' rule with parameter 'MaxOpen'"}},
+		{"map entries validated one by one",
+			func(pConfigs map[string]map[string]any) {
+				pConfigs["dbconfig"]["Databases"].(map[string]any)["replica"] = map[string]any{"DBType": "oracle", "Password": "hunter2"}
+			},
+			[]string{"dbconfig.Databases.replica.Server: failed 'required' rule", "dbconfig.Databases.replica.DBType: failed 'oneof' rule"}},
+	}
+	for _, tt := range tests {
+		lConfigs := lValid()
+		tt.edit(lConfigs)
+		lErr := validateConfigSet(lConfigs)
+		if tt.wantErrs == nil {
+			if lErr != nil {
+				t.Errorf("%s: validateConfigSet() = %v", tt.name, lErr)
+			}
+			continue
+		}
+		if lErr == nil {
+			t.Errorf("%s: validateConfigSet() = nil, want %q", tt.name, tt.wantErrs)
+			continue
+		}
+		for _, lWant := range tt.wantErrs {
+			if !strings.Contains(lErr.Error(), lWant) {
+				t.Errorf("%s: validateConfigSet() = %v, want %q", tt.name, lErr, lWant)
+			}
+		}
+		// Failed rules never print the value, which may be a secret
+		if strings.Contains(lErr.Error(), "hunter2") || strings.Contains(lErr.Error(), "oracle") {
+			t.Errorf("%s: error shows a value: %v", tt.name, lErr)
+		}
+	}
+}
+
+func TestInvalidConfigIsNotLoaded(t *testing.T) {
+	useTestSchemas(t)
+	RegisterSchema[testPool]("dbconfig", "Pool")
+
+	lFolder := t.TempDir()
+	writeTestConfig(t, lFolder, "dbconfig.toml", "[Pool]\nMaxOpen = 3\nMaxIdle = 1\n")
+	loadTestConfig(t, lFolder)
+
+	writeTestConfig(t, lFolder, "dbconfig.toml", "[Pool]\nMaxOpen = 0\nMaxIdle = 1\n")
+	if lErr := ValidateFolder(lFolder); lErr == nil {
+		t.Error("ValidateFolder() accepted MaxOpen = 0")
+	}
+	if lErr := LoadAllTOMLConfigs(lFolder); lErr == nil {
+		t.Error("LoadAllTOMLConfigs() accepted MaxOpen = 0")
+	}
+	var lPool testPool
+	if lErr := GetAndAssignTomlValue("dbconfig", "Pool", &lPool); lErr != nil || lPool.MaxOpen != 3 {
+		t.Errorf("Pool after the rejected load = %+v, %v", lPool, lErr)
+	}
+}
+
+// useTestSchemas starts the test with no registered schemas and restores them afterwards.
+func useTestSchemas(t *testing.T) {
+	schemaMu.Lock()
+	lPrevious := schemas
+	schemas = nil
+	schemaMu.Unlock()
+	t.Cleanup(func() {
+		schemaMu.Lock()
+		schemas = lPrevious
+		schemaMu.Unlock()
+	})
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	// SecretKeyFileEnv overrides the location of the key used for "enc:" values
+	SecretKeyFileEnv = "LUMEL_SECRET_KEY_FILE"
+
+	// DefaultSecretKeyFile holds a base64 encoded 32 byte AES key
+	DefaultSecretKeyFile = "./secrets/config.key"
+
+	secretEnvPrefix  = "env:"
+	secretFilePrefix = "file:"
+	secretEncPrefix  = "enc:"
+
+	// secretTag marks the config fields that may hold a secret reference, e.g.
+	//
+	//	Password string `secret:"true"`
+	secretTag = "secret"
+)
+
+var (
+	// secretGCM caches the cipher built from the key file, see secretCipher
+	secretGCM cipher.AEAD
+
+	// secretMu guards secretGCM
+	secretMu sync.Mutex
+)
+
+/*
+resolveSecretFields replaces the secret references in every field tagged `secret:"true"`
+under pValue. Supported references:
+
+	env:DB_PASS              value of the DB_PASS environment variable
+	file:/run/secrets/db     content of the file, trailing newline trimmed
+	enc:<base64>             AES-256-GCM ciphertext decrypted with the local key file
+
+Structs, pointers, maps and slices are walked recursively; every string below a tagged
+field is resolved, so a tagged map[string]string such as HTTP headers resolves all its
+values. Untagged strings are left alone, so a SQLite path like "file:./lumel.db" is never
+read as a secret. ConfigMap itself keeps the references, so resolved secrets never end up
+in the shared map.
+*/
+func resolveSecretFields(pValue reflect.Value, pSecret bool) error {
+	switch pValue.Kind() {
+	case reflect.Pointer:
+		if pValue.IsNil() {
+			return nil
+		}
+		return resolveSecretFields(pValue.Elem(), pSecret)
+
+	case reflect.String:
+		if !pSecret || !pValue.CanSet() {
+			return nil
+		}
+		lSecret, lErr := resolveSecret(pValue.String())
+		if lErr != nil {
+			return lErr
+		}
+		pValue.SetString(lSecret)
+
+	case reflect.Struct:
+		lType := pValue.Type()
+		for i := 0; i < lType.NumField(); i++ {
+			lField := lType.Field(i)
+			if !lField.IsExported() {
+				continue
+			}
+			lTagged := pSecret || lField.Tag.Get(secretTag) == "true"
+			if lErr := resolveSecretFields(pValue.Field(i), lTagged); lErr != nil {
+				return fmt.Errorf("%s: %w", lField.Name, lErr)
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < pValue.Len(); i++ {
+			if lErr := resolveSecretFields(pValue.Index(i), pSecret); lErr != nil {
+				return fmt.Errorf("[%d]: %w", i, lErr)
+			}
+		}
+
+	case reflect.Map:
+		// Map entries are not addressable: resolve a copy and store it back
+		lIter := pValue.MapRange()
+		for lIter.Next() {
+			lItem := reflect.New(pValue.Type().Elem()).Elem()
+			lItem.Set(lIter.Value())
+			if lErr := resolveSecretFields(lItem, pSecret); lErr != nil {
+				return fmt.Errorf("%v: %w", lIter.Key(), lErr)
+			}
+			pValue.SetMapIndex(lIter.Key(), lItem)
+		}
+	}
+	return nil
+}
+
+// resolveSecret resolves a single string. Errors never include the secret itself.
+func resolveSecret(pValue string) (string, error) {
+	switch {
+	case strings.HasPrefix(pValue, secretEnvPrefix):
+		lName := strings.TrimPrefix(pValue, secretEnvPrefix)
+		lSecret, ok := os.LookupEnv(lName)
+		if !ok {
+			return "", fmt.Errorf("secret environment variable %s is not set", lName)
+		}
+		return lSecret, nil
+
+	case strings.HasPrefix(pValue, secretFilePrefix):
+		lPath := strings.TrimPrefix(pValue, secretFilePrefix)
+		lData, lErr := os.ReadFile(lPath)
+		if lErr != nil {
+			return "", fmt.Errorf("reading secret file %s: %w", lPath, lErr)
+		}
+		return strings.TrimRight(string(lData), "\r\n"), nil
+
+	case strings.HasPrefix(pValue, secretEncPrefix):
+		return DecryptSecret(strings.TrimPrefix(pValue, secretEncPrefix))
+	}
+	return pValue, nil
+}
+
+// IsSecretReference reports whether a config string is an env:, file: or enc: reference.
+func IsSecretReference(pValue string) bool {
+	return strings.HasPrefix(pValue, secretEnvPrefix) ||
+		strings.HasPrefix(pValue, secretFilePrefix) ||
+		strings.HasPrefix(pValue, secretEncPrefix)
+}
+
+// EncryptSecret encrypts a plaintext with the local key file and returns the
+// "enc:<base64>" reference to paste into a config file.
+func EncryptSecret(pPlaintext string) (string, error) {
+	lGCM, lErr := secretCipher()
+	if lErr != nil {
+		return "", lErr
+	}
+
+	lNonce := make([]byte, lGCM.NonceSize())
+	if _, lErr := rand.Read(lNonce); lErr != nil {
+		return "", fmt.Errorf("generating nonce: %w", lErr)
+	}
+
+	lSealed := lGCM.Seal(lNonce, lNonce, []byte(pPlaintext), nil)
+	return secretEncPrefix + base64.StdEncoding.EncodeToString(lSealed), nil
+}
+
+// DecryptSecret decrypts the base64 part of an "enc:" reference.
+func DecryptSecret(pEncoded string) (string, error) {
+	lSealed, lErr := base64.StdEncoding.DecodeString(strings.TrimSpace(pEncoded))
+	if lErr != nil {
+		return "", fmt.Errorf("decoding encrypted secret: %w", lErr)
+	}
+
+	lGCM, lErr := secretCipher()
+	if lErr != nil {
+		return "", lErr
+	}
+	if len(lSealed) < lGCM.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+
+	lNonce, lCiphertext := lSealed[:lGCM.NonceSize()], lSealed[lGCM.NonceSize():]
+	lPlain, lErr := lGCM.Open(nil, lNonce, lCiphertext, nil)
+	if lErr != nil {
+		return "", errors.New("decrypting secret failed: wrong key or corrupted value")
+	}
+	return string(lPlain), nil
+}
+
+// secretCipher returns the GCM cipher of the key file. The file is read on first use and
+// again after reloadSecretKey, not on every lookup.
+func secretCipher() (cipher.AEAD, error) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+
+	if secretGCM != nil {
+		return secretGCM, nil
+	}
+	lGCM, lErr := loadSecretCipher()
+	if lErr != nil {
+		return nil, lErr
+	}
+	secretGCM = lGCM
+	return lGCM, nil
+}
+
+// reloadSecretKey drops the cached cipher so the key file is read again on the next
+// enc: lookup. LoadAllTOMLConfigs calls it on every load, so a rotated key is picked up
+// together with the values encrypted with it.
+func reloadSecretKey() {
+	secretMu.Lock()
+	secretGCM = nil
+	secretMu.Unlock()
+}
+
+// loadSecretCipher reads the AES key from the key file and builds the GCM cipher.
+func loadSecretCipher() (cipher.AEAD, error) {
+	lPath := os.Getenv(SecretKeyFileEnv)
+	if lPath == "" {
+		lPath = DefaultSecretKeyFile
+	}
+
+	lData, lErr := os.ReadFile(lPath)
+	if lErr != nil {
+		return nil, fmt.Errorf("reading secret key file %s: %w", lPath, lErr)
+	}
+	lKey, lErr := base64.StdEncoding.DecodeString(strings.TrimSpace(string(lData)))
+	if lErr != nil || len(lKey) != 32 {
+		return nil, fmt.Errorf("secret key file %s must hold a base64 encoded 32 byte key", lPath)
+	}
+
+	lBlock, lErr := aes.NewCipher(lKey)
+	if lErr != nil {
+		return nil, lErr
+	}
+	return cipher.NewGCM(lBlock)
+}
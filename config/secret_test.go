@@ -0,0 +1,119 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptSecretRoundTrip(t *testing.T) {
+	useTestSecretKey(t)
+	for _, lPlain := range []string{"", "s3cret", `p@ss:w/rd?&x=1 'q' "d" \b`, "pässwörd 🔑", strings.Repeat("x", 4096)} {
+		lEncrypted, lErr := EncryptSecret(lPlain)
+		if lErr != nil {
+			t.Fatal(lErr)
+		}
+		if !strings.HasPrefix(lEncrypted, "enc:") || (lPlain != "" && strings.Contains(lEncrypted, lPlain)) {
+			t.Errorf("EncryptSecret(%q) = %q", lPlain, lEncrypted)
+		}
+		if lAgain, _ := EncryptSecret(lPlain); lAgain == lEncrypted {
+			t.Errorf("EncryptSecret(%q) returned the same ciphertext twice", lPlain)
+		}
+		if lGot, lErr := resolveSecret(lEncrypted); lErr != nil || lGot != lPlain {
+			t.Errorf("resolveSecret(EncryptSecret(%q)) = %q, %v", lPlain, lGot, lErr)
+		}
+	}
+}
+
+func TestDecryptSecretErrors(t *testing.T) {
+	useTestSecretKey(t)
+	lEncrypted, lErr := EncryptSecret("s3cret")
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	lEncoded := strings.TrimPrefix(lEncrypted, "enc:")
+	lSealed, _ := base64.StdEncoding.DecodeString(lEncoded)
+	lSealed[len(lSealed)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr string
+	}{
+		{"not base64", "%%%", "decoding encrypted secret"},
+		{"too short", base64.StdEncoding.EncodeToString([]byte("abc")), "too short"},
+		{"tampered", base64.StdEncoding.EncodeToString(lSealed), "wrong key or corrupted value"},
+	}
+	for _, tt := range tests {
+		lGot, lErr := DecryptSecret(tt.encoded)
+		if lErr == nil || !strings.Contains(lErr.Error(), tt.wantErr) {
+			t.Errorf("%s: DecryptSecret() = %q, %v, want %q", tt.name, lGot, lErr, tt.wantErr)
+		}
+	}
+
+	// A rotated key is read on the next load, values of the old key no longer decrypt
+	useTestSecretKey(t)
+	if _, lErr := DecryptSecret(lEncoded); lErr == nil {
+		t.Error("DecryptSecret() succeeded with a rotated key")
+	}
+}
+
+func TestResolveTaggedSecrets(t *testing.T) {
+	useTestSecretKey(t)
+	lEncrypted, lErr := EncryptSecret("enc-pass")
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	lSecretFile := filepath.Join(t.TempDir(), "token")
+	if lErr := os.WriteFile(lSecretFile, []byte("file-token\n"), 0o600); lErr != nil {
+		t.Fatal(lErr)
+	}
+	t.Setenv("TEST_API_KEY", "env-key")
+	lFolder := t.TempDir()
+	writeTestConfig(t, lFolder, "appconfig.toml", `
+[Upstream]
+Password = "`+lEncrypted+`"
+Token = "file:`+lSecretFile+`"
+Path = "file:./lumel.db"
+[Upstream.Headers]
+X-Api-Key = "env:TEST_API_KEY"
+`)
+	loadTestConfig(t, lFolder)
+
+	var lUpstream struct {
+		Password string            `secret:"true"`
+		Token    string            `secret:"true"`
+		Path     string            // untagged, never read as a reference
+		Headers  map[string]string `secret:"true"`
+	}
+	if lErr := GetAndAssignTomlValue("appconfig", "Upstream", &lUpstream); lErr != nil {
+		t.Fatal(lErr)
+	}
+	if lUpstream.Password != "enc-pass" || lUpstream.Token != "file-token" ||
+		lUpstream.Path != "file:./lumel.db" || lUpstream.Headers["X-Api-Key"] != "env-key" {
+		t.Errorf("resolved %+v", lUpstream)
+	}
+
+	// ConfigMap keeps the reference
+	var lRaw string
+	if lErr := GetAndAssignTomlValue("appconfig", "Upstream.Password", &lRaw); lErr != nil || lRaw != lEncrypted {
+		t.Errorf("raw Password = %q, %v", lRaw, lErr)
+	}
+}
+
+// useTestSecretKey points the enc: key file at a fresh random key for the test.
+func useTestSecretKey(t *testing.T) {
+	t.Helper()
+	lKey := make([]byte, 32)
+	if _, lErr := rand.Read(lKey); lErr != nil {
+		t.Fatal(lErr)
+	}
+	lFolder := t.TempDir()
+	writeTestConfig(t, lFolder, "config.key", base64.StdEncoding.EncodeToString(lKey)+"\n")
+	t.Setenv(SecretKeyFileEnv, filepath.Join(lFolder, "config.key"))
+	reloadSecretKey()
+	t.Cleanup(reloadSecretKey)
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"lumelpkg/common"
+	"lumelpkg/utils"
+	"reflect"
+	"sync"
+)
+
+// subscription is one registered interest in a file/key pair.
+type subscription struct {
+	filename string
+	key      string
+	notify   func(pNew any)
+}
+
+var (
+	// subscriptions holds every watcher registered through Watch
+	subscriptions []subscription
+
+	// subMu guards subscriptions
+	subMu sync.Mutex
+)
+
+/*
+Watch registers fn to be called after a reload changes the value at filename/key.
+The old and new values are decoded into T the same way GetAndAssignTomlValue does,
+secrets included, and compared after decoding: a changed secret fires fn even when the
+env:/file: reference itself did not change. A key that is missing on either side is
+passed as the zero value of T.
+
+Watch only reports changes; read the current value with GetAndAssignTomlValue
+when subscribing if it must also be applied at startup.
+
+Example usage:
+
+	config.Watch("dbconfig", "DBConnectionPool", func(pOld, pNew db.DBConnectionPool) {
+		// apply pNew
+	})
+*/
+func Watch[T any](filename, key string, fn func(pOld, pNew T)) {
+	log := new(utils.Logger)
+
+	// lLast is the value fn saw last, starting with the one loaded now
+	var lLast T
+	var lLastMu sync.Mutex
+	mu.RLock()
+	if lRaw, lErr := lookupValue(ConfigMap, filename, key); lErr == nil {
+		if lErr := assignValue(lRaw, &lLast); lErr != nil {
+			log.Log(common.ERROR, "Watch", fmt.Sprintf("%s.%s: decoding current value: %v", filename, key, lErr))
+		}
+	}
+	mu.RUnlock()
+
+	subMu.Lock()
+	defer subMu.Unlock()
+
+	subscriptions = append(subscriptions, subscription{
+		filename: filename,
+		key:      key,
+		notify: func(pNew any) {
+			var lNew T
+			if pNew != nil {
+				if lErr := assignValue(pNew, &lNew); lErr != nil {
+					log.Log(common.ERROR, "Watch", fmt.Sprintf("%s.%s: decoding new value: %v", filename, key, lErr))
+					return
+				}
+			}
+
+			lLastMu.Lock()
+			lOld := lLast
+			if reflect.DeepEqual(lOld, lNew) {
+				lLastMu.Unlock()
+				return
+			}
+			lLast = lNew
+			lLastMu.Unlock()
+
+			fn(lOld, lNew)
+		},
+	})
+}
+
+// notifySubscribers hands the new value of each watched key to its subscriber, which calls
+// back only when the resolved value differs from the one it saw last.
+func notifySubscribers(pNew map[string]map[string]any) {
+	subMu.Lock()
+	lSubs := make([]subscription, len(subscriptions))
+	copy(lSubs, subscriptions)
+	subMu.Unlock()
+
+	for _, lSub := range lSubs {
+		lNewValue, _ := lookupValue(pNew, lSub.filename, lSub.key)
+		callSubscriber(lSub, lNewValue)
+	}
+}
+
+// callSubscriber runs one subscriber, so a panicking callback cannot break the reload.
+func callSubscriber(pSub subscription, pNew any) {
+	defer func() {
+		if lRecovered := recover(); lRecovered != nil {
+			log := new(utils.Logger)
+			log.Log(common.ERROR, "Watch", fmt.Sprintf("%s.%s: subscriber panicked: %v", pSub.filename, pSub.key, lRecovered))
+		}
+	}()
+	pSub.notify(pNew)
+}
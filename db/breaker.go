@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// CircuitBreaker is the [CircuitBreaker] section of dbconfig.toml
+type CircuitBreaker struct {
+	FailureThreshold int `validate:"gte=0"` // consecutive failed statements that open the circuit, 0 disables it
+	OpenSec          int `validate:"gte=1"` // how long an open circuit rejects requests before a trial
+}
+
+// RejectedError is returned when a request is turned away before reaching the database,
+// by an open circuit or a full bulkhead. It wraps ErrDBUnavailable, so handlers answer
+// 503; RetryAfter is the hint sent in the Retry-After header.
+type RejectedError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Reason, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RejectedError) Unwrap() error { return ErrDBUnavailable }
+
+// breakerState is the state of one circuit
+type breakerState int
+
+const (
+	// breakerClosed lets every request through and counts consecutive failures
+	breakerClosed breakerState = iota
+	// breakerOpen rejects every request until OpenSec has passed
+	breakerOpen
+	// breakerHalfOpen lets one trial request through; its result closes or reopens the circuit
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuit is the breaker of one logical database
+type circuit struct {
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trialAt  time.Time // when the half-open trial was let through, zero when none is running
+}
+
+var (
+	// circuits holds the breaker of every logical database that ran a statement
+	circuits = make(map[string]*circuit)
+
+	// circuitMu guards circuits
+	circuitMu sync.Mutex
+)
+
+// BreakerState reports the circuit state of a logical database: closed, open or half-open.
+func BreakerState(pName string) string {
+	circuitMu.Lock()
+	defer circuitMu.Unlock()
+	if lCircuit, ok := circuits[pName]; ok {
+		return lCircuit.state.String()
+	}
+	return breakerClosed.String()
+}
+
+// admitCircuit decides whether a request may use database pName. An open circuit turns
+// into half-open once OpenSec has passed and admits a single trial, reported through
+// lTrial; while that trial runs, and for at most OpenSec, further requests are rejected.
+// Statements call it with pTrial set; with pTrial false the check has no side effect
+// (used by GetDB and to pick replicas).
+func admitCircuit(pName string, pTrial bool) (lTrial bool, lErr error) {
+	lSettings := circuitBreakerSettings()
+	lOpen := time.Duration(lSettings.OpenSec) * time.Second
+
+	circuitMu.Lock()
+	defer circuitMu.Unlock()
+	lCircuit, ok := circuits[pName]
+	if !ok || lCircuit.state == breakerClosed || lSettings.FailureThreshold == 0 {
+		return false, nil
+	}
+
+	lSince := lCircuit.openedAt
+	if lCircuit.state == breakerHalfOpen {
+		lSince = lCircuit.trialAt
+	}
+	if lWait := lOpen - time.Since(lSince); lWait > 0 && (lCircuit.state == breakerOpen || !lCircuit.trialAt.IsZero()) {
+		return false, &RejectedError{
+			Reason:     fmt.Sprintf("circuit of database %s is %s", pName, lCircuit.state),
+			RetryAfter: lWait,
+		}
+	}
+	if !pTrial {
+		return false, nil
+	}
+	lCircuit.state = breakerHalfOpen
+	lCircuit.trialAt = time.Now()
+	return true, nil
+}
+
+// circuitAdmits reports whether the circuit of pName would let a request through now.
+func circuitAdmits(pName string) bool {
+	_, lErr := admitCircuit(pName, false)
+	return lErr == nil
+}
+
+// releaseTrial gives up a half-open trial that never reached the database, so the next
+// statement can take it.
+func releaseTrial(pName string) {
+	circuitMu.Lock()
+	defer circuitMu.Unlock()
+	if lCircuit, ok := circuits[pName]; ok && lCircuit.state == breakerHalfOpen {
+		lCircuit.trialAt = time.Time{}
+	}
+}
+
+// recordOutcome feeds a finished statement into the circuit of pName and returns the
+// state change it caused, if any. Only the trial (pTrial) decides a half-open circuit;
+// statements that were already running when the circuit opened cannot close it.
+func recordOutcome(pCtx context.Context, pName string, pTrial bool, pErr error) (breakerState, breakerState, bool) {
+	lThreshold := circuitBreakerSettings().FailureThreshold
+	lFailed := isOutage(pCtx, pErr)
+
+	circuitMu.Lock()
+	defer circuitMu.Unlock()
+	lCircuit, ok := circuits[pName]
+	if !ok {
+		lCircuit = new(circuit)
+		circuits[pName] = lCircuit
+	}
+	lFrom := lCircuit.state
+
+	switch lCircuit.state {
+	case breakerClosed:
+		if !lFailed {
+			lCircuit.failures = 0
+			break
+		}
+		lCircuit.failures++
+		if lThreshold > 0 && lCircuit.failures >= lThreshold {
+			lCircuit.state = breakerOpen
+			lCircuit.openedAt = time.Now()
+		}
+	case breakerOpen:
+		if pTrial && lFailed {
+			lCircuit.openedAt = time.Now()
+		}
+	case breakerHalfOpen:
+		if !pTrial {
+			break
+		}
+		if lFailed {
+			lCircuit.state = breakerOpen
+			lCircuit.openedAt = time.Now()
+		} else {
+			lCircuit.state = breakerClosed
+			lCircuit.failures = 0
+		}
+		lCircuit.trialAt = time.Time{}
+	}
+	return lFrom, lCircuit.state, lFrom != lCircuit.state
+}
+
+// isOutage reports whether a statement error points at a sick database rather than at the
+// statement itself: broken or refused connections, and statements cut off by their class
+// timeout (see WithTimeout) while the caller was still waiting. A cancelled client request,
+// a deadline of the caller's own or a constraint violation does not count.
+func isOutage(pCtx context.Context, pErr error) bool {
+	if pErr == nil {
+		return false
+	}
+	if pCtx.Err() != nil || errors.Is(pErr, context.Canceled) || errors.Is(pErr, context.DeadlineExceeded) {
+		// The cause is the parent's when the request ended first
+		return errors.Is(context.Cause(pCtx), errQueryTimeout)
+	}
+	var lNetErr net.Error
+	return errors.Is(pErr, driver.ErrBadConn) || errors.Is(pErr, mysql.ErrInvalidConn) ||
+		errors.Is(pErr, io.ErrUnexpectedEOF) || errors.As(pErr, &lNetErr)
+}
+
+// breakerSettings caches [CircuitBreaker], 5 failures / 15s when not configured
+var breakerSettings = newSettingsCache("CircuitBreaker", CircuitBreaker{FailureThreshold: 5, OpenSec: 15}, func(pSettings *CircuitBreaker) {
+	if pSettings.OpenSec <= 0 {
+		pSettings.OpenSec = 15
+	}
+})
+
+// circuitBreakerSettings returns the breaker settings.
+func circuitBreakerSettings() CircuitBreaker {
+	return breakerSettings.get()
+}
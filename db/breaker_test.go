@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsOutage(t *testing.T) {
+	lCancelled, lCancel := context.WithCancel(context.Background())
+	lCancel()
+	lOwnDeadline, lCancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer lCancel()
+	<-lOwnDeadline.Done()
+
+	setTestSettings(t, queryTimeoutSettings, QueryTimeouts{DefaultMs: 1})
+	lTimedOut, lCancel := WithTimeout(context.Background(), ClassAnalytics)
+	defer lCancel()
+	<-lTimedOut.Done()
+	lClientGone, lCancel := WithTimeout(lCancelled, ClassAnalytics)
+	defer lCancel()
+	lCallerDeadline, lCancel := WithTimeout(lOwnDeadline, ClassAnalytics)
+	defer lCancel()
+
+	lDriverCancel := errors.New("pq: canceling statement due to user request")
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"success", context.Background(), nil, false},
+		{"bad connection", context.Background(), driver.ErrBadConn, true},
+		{"constraint violation", context.Background(), errors.New("UNIQUE constraint failed"), false},
+		{"class timeout", lTimedOut, ContextErr(lTimedOut, lDriverCancel), true},
+		{"class timeout, bare driver error", lTimedOut, lDriverCancel, true},
+		{"client cancelled", lClientGone, ContextErr(lClientGone, lDriverCancel), false},
+		{"caller's own deadline", lCallerDeadline, ContextErr(lCallerDeadline, lDriverCancel), false},
+		{"deadline without WithTimeout", lOwnDeadline, context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := isOutage(tt.ctx, tt.err); got != tt.want {
+			t.Errorf("%s: isOutage() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBreakerOpensOnQueryTimeouts(t *testing.T) {
+	setTestSettings(t, breakerSettings, CircuitBreaker{FailureThreshold: 3, OpenSec: 15})
+	setTestSettings(t, queryTimeoutSettings, QueryTimeouts{DefaultMs: 1})
+	lName := testCircuit(t)
+
+	for i := 1; i <= 3; i++ {
+		lCtx, lCancel := WithTimeout(context.Background(), ClassAnalytics)
+		<-lCtx.Done()
+		recordOutcome(lCtx, lName, false, ContextErr(lCtx, errors.New("statement cancelled")))
+		lCancel()
+
+		lWant := "closed"
+		if i == 3 {
+			lWant = "open"
+		}
+		if lState := BreakerState(lName); lState != lWant {
+			t.Fatalf("after %d timeouts the circuit is %s, want %s", i, lState, lWant)
+		}
+	}
+
+	var lRejected *RejectedError
+	if _, lErr := admitCircuit(lName, true); !errors.As(lErr, &lRejected) || !errors.Is(lErr, ErrDBUnavailable) {
+		t.Errorf("admitCircuit() on an open circuit = %v, want a RejectedError", lErr)
+	}
+}
+
+func TestBreakerCycle(t *testing.T) {
+	setTestSettings(t, breakerSettings, CircuitBreaker{FailureThreshold: 2, OpenSec: 15})
+	lName := testCircuit(t)
+	lCtx := context.Background()
+
+	// Each step feeds one statement, or asks for admission, and checks the state after it
+	tests := []struct {
+		step    string
+		run     func() error
+		want    string
+		wantErr bool
+	}{
+		{"success", record(lCtx, lName, false, nil), "closed", false},
+		{"first failure", record(lCtx, lName, false, driver.ErrBadConn), "closed", false},
+		{"success resets the count", record(lCtx, lName, false, nil), "closed", false},
+		{"failure", record(lCtx, lName, false, driver.ErrBadConn), "closed", false},
+		{"second failure in a row", record(lCtx, lName, false, driver.ErrBadConn), "open", false},
+		{"open rejects", admit(lName, true), "open", true},
+		{"OpenSec passes", elapse(lName, 16*time.Second), "open", false},
+		{"check without trial", admit(lName, false), "open", false},
+		{"trial admitted", admit(lName, true), "half-open", false},
+		{"second trial rejected", admit(lName, true), "half-open", true},
+		{"old statement cannot close", record(lCtx, lName, false, nil), "half-open", false},
+		{"trial fails", record(lCtx, lName, true, driver.ErrBadConn), "open", false},
+		{"reopened rejects", admit(lName, false), "open", true},
+		{"OpenSec passes again", elapse(lName, 16*time.Second), "open", false},
+		{"next trial admitted", admit(lName, true), "half-open", false},
+		{"trial succeeds", record(lCtx, lName, true, nil), "closed", false},
+		{"closed admits", admit(lName, true), "closed", false},
+	}
+	for _, tt := range tests {
+		lErr := tt.run()
+		if (lErr != nil) != tt.wantErr {
+			t.Fatalf("%s: error = %v, want error %v", tt.step, lErr, tt.wantErr)
+		}
+		if lState := BreakerState(lName); lState != tt.want {
+			t.Fatalf("%s: circuit is %s, want %s", tt.step, lState, tt.want)
+		}
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	setTestSettings(t, breakerSettings, CircuitBreaker{FailureThreshold: 0, OpenSec: 15})
+	lName := testCircuit(t)
+	for i := 0; i < 10; i++ {
+		recordOutcome(context.Background(), lName, false, driver.ErrBadConn)
+	}
+	if lState := BreakerState(lName); lState != "closed" {
+		t.Errorf("disabled breaker is %s", lState)
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	setTestSettings(t, bulkheadLimits, Bulkhead{MaxWaitMs: 20, Classes: map[string]int{"analytics": 1}})
+	lCtx := context.Background()
+
+	lRelease, lErr := Acquire(lCtx, ClassAnalytics)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	lStart := time.Now()
+	var lRejected *RejectedError
+	if _, lErr := Acquire(lCtx, ClassAnalytics); !errors.As(lErr, &lRejected) || lRejected.RetryAfter < time.Second {
+		t.Fatalf("second analytics Acquire() = %v, want a RejectedError", lErr)
+	}
+	if lWaited := time.Since(lStart); lWaited < 20*time.Millisecond {
+		t.Errorf("rejected after %s, want MaxWaitMs", lWaited)
+	}
+
+	// Other classes are unlimited by default
+	lOther, lErr := Acquire(lCtx, ClassIngestion)
+	if lErr != nil {
+		t.Fatalf("ingestion Acquire() = %v", lErr)
+	}
+	lOther()
+
+	lCancelled, lCancel := context.WithCancel(lCtx)
+	lCancel()
+	setTestSettings(t, bulkheadLimits, Bulkhead{MaxWaitMs: 1000, Classes: map[string]int{"analytics": 1}})
+	if _, lErr := Acquire(lCancelled, ClassAnalytics); !errors.Is(lErr, context.Canceled) {
+		t.Errorf("Acquire() with a cancelled context = %v", lErr)
+	}
+
+	lRelease()
+	lRelease, lErr = Acquire(lCtx, ClassAnalytics)
+	if lErr != nil {
+		t.Fatalf("Acquire() after release = %v", lErr)
+	}
+	lRelease()
+}
+
+// setTestSettings replaces the cached settings of c for the duration of the test.
+func setTestSettings[T any](t *testing.T, c *settingsCache[T], pSettings T) {
+	t.Helper()
+	lPrevious := c.current.Load()
+	c.current.Store(&pSettings)
+	t.Cleanup(func() { c.current.Store(lPrevious) })
+}
+
+// testCircuit returns a database name of its own for the test and drops its circuit afterwards.
+func testCircuit(t *testing.T) string {
+	lName := "test-" + t.Name()
+	t.Cleanup(func() {
+		circuitMu.Lock()
+		delete(circuits, lName)
+		circuitMu.Unlock()
+	})
+	return lName
+}
+
+// record feeds one finished statement into the circuit.
+func record(pCtx context.Context, pName string, pTrial bool, pErr error) func() error {
+	return func() error {
+		recordOutcome(pCtx, pName, pTrial, pErr)
+		return nil
+	}
+}
+
+// admit asks the circuit for admission.
+func admit(pName string, pTrial bool) func() error {
+	return func() error {
+		_, lErr := admitCircuit(pName, pTrial)
+		return lErr
+	}
+}
+
+// elapse moves the circuit's clock back by pBy, as if that much time had passed.
+func elapse(pName string, pBy time.Duration) func() error {
+	return func() error {
+		circuitMu.Lock()
+		defer circuitMu.Unlock()
+		lCircuit := circuits[pName]
+		lCircuit.openedAt = lCircuit.openedAt.Add(-pBy)
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bulkhead is the [Bulkhead] section of dbconfig.toml. Classes maps a QueryClass to the
+// number of units of work that may run at once; classes not listed use DefaultLimit.
+// 0 means unlimited.
+type Bulkhead struct {
+	DefaultLimit int            `validate:"gte=0"`
+	Classes      map[string]int `validate:"dive,gte=0"`
+	MaxWaitMs    int            `validate:"gte=0"` // how long Acquire waits for a free slot before rejecting
+}
+
+var (
+	// bulkheads holds one semaphore per query class, sized from the config
+	bulkheads = make(map[QueryClass]chan struct{})
+
+	// bulkheadMu guards bulkheads
+	bulkheadMu sync.Mutex
+)
+
+// Acquire takes a slot in the bulkhead of pClass, so one class of queries cannot use up
+// every pooled connection and starve the others. It waits up to MaxWaitMs and then
+// returns a *RejectedError (a 503 for handlers). The returned release must be called
+// when the work is done.
+//
+//	lRelease, lErr := db.Acquire(pCtx, db.ClassAnalytics)
+//	if lErr != nil {
+//	    return lErr
+//	}
+//	defer lRelease()
+func Acquire(pCtx context.Context, pClass QueryClass) (func(), error) {
+	lSettings := bulkheadSettings()
+	lSlots := bulkheadFor(pClass, lSettings)
+	if lSlots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case lSlots <- struct{}{}:
+		return func() { <-lSlots }, nil
+	default:
+	}
+
+	lWait := time.Duration(lSettings.MaxWaitMs) * time.Millisecond
+	lTimer := time.NewTimer(lWait)
+	defer lTimer.Stop()
+
+	select {
+	case lSlots <- struct{}{}:
+		return func() { <-lSlots }, nil
+	case <-lTimer.C:
+		return nil, &RejectedError{
+			Reason:     fmt.Sprintf("all %d %s slots are busy", cap(lSlots), pClass),
+			RetryAfter: max(lWait, time.Second),
+		}
+	case <-pCtx.Done():
+		return nil, pCtx.Err()
+	}
+}
+
+// bulkheadFor returns the semaphore of pClass, nil when the class is unlimited. A changed
+// limit replaces the semaphore; work holding a slot of the old one releases it there.
+func bulkheadFor(pClass QueryClass, pSettings Bulkhead) chan struct{} {
+	lLimit, ok := pSettings.Classes[string(pClass)]
+	if !ok {
+		lLimit = pSettings.DefaultLimit
+	}
+
+	bulkheadMu.Lock()
+	defer bulkheadMu.Unlock()
+	if lLimit <= 0 {
+		delete(bulkheads, pClass)
+		return nil
+	}
+	lSlots, ok := bulkheads[pClass]
+	if !ok || cap(lSlots) != lLimit {
+		lSlots = make(chan struct{}, lLimit)
+		bulkheads[pClass] = lSlots
+	}
+	return lSlots
+}
+
+// bulkheadLimits caches [Bulkhead], unlimited with a 100ms wait when not configured
+var bulkheadLimits = newSettingsCache("Bulkhead", Bulkhead{MaxWaitMs: 100}, nil)
+
+// bulkheadSettings returns the bulkhead limits.
+func bulkheadSettings() Bulkhead {
+	return bulkheadLimits.get()
+}
@@ -6,45 +6,84 @@ import (
 	"lumelpkg/common"
 	"lumelpkg/config"
 	"lumelpkg/utils"
+	"reflect"
 	"time"
 
 	_ "github.com/denisenkom/go-mssqldb"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 // DatabaseType holds individual DB connection details.
+// It is one [Databases.<name>] section of dbconfig.toml; the section name is the logical DB name.
 type DatabaseType struct {
-	Server   string
-	Port     int
-	User     string
-	Password string
-	Database string
-	DBType   string // Database driver type, e.g., "mssql", "mysql", "postgres"
-	DB       string // Logical DB name identifier
+	Server   string            `validate:"required_unless=DBType sqlite"`
+	Port     int               `validate:"required_unless=DBType sqlite,max=65535"`
+	User     string            `validate:"required_unless=DBType sqlite"`
+	Password string            `secret:"true"`                                         // env:, file: or enc: reference, see config.resolveSecretFields
+	Database string            `validate:"required"`                                   // Database name, for sqlite a file path or ":memory:"
+	DBType   string            `validate:"required,oneof=mssql mysql postgres sqlite"` // Database driver type, e.g., "mssql", "mysql", "postgres", "sqlite"
+	Pool     *DBConnectionPool // Optional pool limits, DBConnectionPool is used when absent
+	Replicas []string          // Logical names of read replicas of this database, see Reader
+	Options  DSNOptions        // TLS, timeouts and driver parameters, see dsn.go
 }
+
+// String describes the connection with the password masked, so the struct is
+// safe to pass to fmt and the logger.
+func (pDb DatabaseType) String() string {
+	lPassword := ""
+	if pDb.Password != "" {
+		lPassword = "******"
+	}
+	return fmt.Sprintf("{Server:%s Port:%d User:%s Password:%s Database:%s DBType:%s TLSMode:%s}",
+		pDb.Server, pDb.Port, pDb.User, lPassword, pDb.Database, pDb.DBType, pDb.Options.TLSMode)
+}
+
+// EffectivePool returns the database's own pool limits, or pDefault when it has none.
+// An in-memory SQLite database never closes idle connections.
+func (pDb DatabaseType) EffectivePool(pDefault DBConnectionPool) DBConnectionPool {
+	lPool := pDefault
+	if pDb.Pool != nil {
+		lPool = *pDb.Pool
+	}
+	if pDb.inMemory() {
+		lPool.DbConMaxIdleTime = 0
+	}
+	return lPool
+}
+
+// inMemory reports whether the database is an in-memory SQLite database, which only lives
+// as long as one of its connections is open.
+func (pDb DatabaseType) inMemory() bool {
+	return pDb.DBType == "sqlite" && pDb.Database == ":memory:"
+}
+
+// sameConnection reports whether two configs point at the same database with the
+// same credentials and options, ignoring pool limits and replicas which can change on a live handle.
+func (pDb DatabaseType) sameConnection(pOther DatabaseType) bool {
+	return pDb.Server == pOther.Server && pDb.Port == pOther.Port &&
+		pDb.User == pOther.User && pDb.Password == pOther.Password &&
+		pDb.Database == pOther.Database && pDb.DBType == pOther.DBType &&
+		reflect.DeepEqual(pDb.Options, pOther.Options)
+}
+
 type DBConnectionPool struct {
-	DbConMaxIdleTime  int
-	DbConMaxOpenConns int
-	DbConMaxIdleConns int
+	DbConMaxIdleTime  int `validate:"gte=0"`
+	DbConMaxOpenConns int `validate:"gte=1"`
+	DbConMaxIdleConns int `validate:"gte=0,ltefield=DbConMaxOpenConns"`
 }
 
-// AllUsedDatabases groups all database configurations used by the program.
+// AllUsedDatabases groups all database configurations used by the program, keyed by logical name.
 type AllUsedDatabases struct {
-	DbName DatabaseType
+	Databases map[string]DatabaseType
 }
 
-// Global_DB_Instance is a global variable holding the active DB connection.
-var Global_DB_Instance *sql.DB
-
-// LocalDbConnect opens a database connection based on the requested DB type.
+// LocalDbConnect opens a connection to the logical database pDbName from dbconfig.toml.
 // It reads DB connection limits from config, sets up connection pooling parameters,
 // and returns the opened *sql.DB or an error.
-// Logs detailed debug and error information using the custom logger.
-func LocalDbConnect(pDbName string) (*sql.DB, error) {
-	// Initialize logger with a unique request ID for tracing
-	log := new(utils.Logger)
-	log.SetReqID()
+// Logs detailed debug and error information with the caller's logger.
+func LocalDbConnect(log *utils.Logger, pDbName string) (*sql.DB, error) {
 	log.Log(common.DEBUG, "LocalDbConnect", "Started")
 
 	// Load all DB configurations
@@ -53,37 +92,20 @@ func LocalDbConnect(pDbName string) (*sql.DB, error) {
 		log.Log(common.ERROR, "LocalDbConnect", fmt.Sprintf("Failed to init DB details: %v", lErr))
 		return nil, lErr
 	}
-	fmt.Printf("%+v\n", lDbDetails)
-	var lConnString string
-	var lDBtype string
-	var lDataBaseConnection DatabaseType
-
-	// Match the requested DB type with loaded configuration
-	if pDbName == lDbDetails.DbName.DB {
-		lDataBaseConnection = lDbDetails.DbName
-		lDBtype = lDbDetails.DbName.DBType
+
+	// Match the requested DB name with loaded configuration
+	lDataBaseConnection, ok := lDbDetails.Databases[pDbName]
+	if !ok {
+		log.Log(common.ERROR, "LocalDbConnect", "Database not configured: "+pDbName)
+		return nil, fmt.Errorf("database %s is not configured in dbconfig", pDbName)
 	}
-	fmt.Println("lDBtype", lDBtype)
-	// Build the connection string based on DB driver type
-	switch lDBtype {
-	case "mssql":
-		lConnString = fmt.Sprintf("server=%s;user id=%s;password=%s;port=%d;database=%s;",
-			lDataBaseConnection.Server, lDataBaseConnection.User, lDataBaseConnection.Password,
-			lDataBaseConnection.Port, lDataBaseConnection.Database)
-
-	case "mysql":
-		lConnString = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-			lDataBaseConnection.User, lDataBaseConnection.Password, lDataBaseConnection.Server,
-			lDataBaseConnection.Port, lDataBaseConnection.Database)
-
-	case "postgres":
-		lConnString = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=require",
-			lDataBaseConnection.Server, lDataBaseConnection.Port, lDataBaseConnection.User,
-			lDataBaseConnection.Password, lDataBaseConnection.Database)
-
-	default:
-		// Unsupported or missing DB type in config
-		return nil, fmt.Errorf("unsupported DB type: %s", lDBtype)
+	lDBtype := lDataBaseConnection.DBType
+	log.Log(common.DEBUG, "LocalDbConnect", "Using DB details "+lDataBaseConnection.String())
+	// Build the connection string based on DB driver type and options
+	lConnString, lErr := buildDSN(pDbName, lDataBaseConnection)
+	if lErr != nil {
+		log.Log(common.ERROR, "LocalDbConnect", lErr.Error())
+		return nil, lErr
 	}
 
 	// Read connection pooling limits from configuration
@@ -92,18 +114,26 @@ func LocalDbConnect(pDbName string) (*sql.DB, error) {
 		log.Log(common.ERROR, "LocalDbConnect", fmt.Sprintf("Error reading DbConMaxIdleTime: %v", lErr))
 	}
 
-	// Attempt to open the database connection
-	lDb, lErr := sql.Open(lDBtype, lConnString)
+	// Attempt to open the database connection, every statement is timed (see instrument.go)
+	lDb, lErr := openInstrumented(pDbName, lDBtype, lConnString, lDataBaseConnection.inMemory())
 	if lErr != nil {
 		log.Log(common.ERROR, "LocalDbConnect", fmt.Sprintf("Failed to open DB connection: %v", lErr))
 		return nil, lErr
 	}
 
 	// Configure connection pooling parameters
-	lDb.SetMaxOpenConns(lDBConnectionPool.DbConMaxOpenConns)
-	lDb.SetMaxIdleConns(lDBConnectionPool.DbConMaxIdleConns)
-	lDb.SetConnMaxIdleTime(time.Second * time.Duration(lDBConnectionPool.DbConMaxIdleTime))
+	ApplyConnectionPool(lDb, lDataBaseConnection.EffectivePool(lDBConnectionPool))
 
 	log.Log(common.DEBUG, "LocalDbConnect", "Finished successfully")
 	return lDb, nil
 }
+
+// ApplyConnectionPool sets the pooling limits on an open DB handle.
+// database/sql applies these on a live pool, so it is safe to call after a config reload.
+// Connections have no maximum lifetime.
+func ApplyConnectionPool(pDb *sql.DB, pPool DBConnectionPool) {
+	pDb.SetMaxOpenConns(pPool.DbConMaxOpenConns)
+	pDb.SetMaxIdleConns(pPool.DbConMaxIdleConns)
+	pDb.SetConnMaxIdleTime(time.Second * time.Duration(pPool.DbConMaxIdleTime))
+	pDb.SetConnMaxLifetime(0)
+}
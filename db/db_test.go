@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestMemorySQLiteOutlivesIdleConnections(t *testing.T) {
+	lName := "test-" + t.Name()
+	lDetails := DatabaseType{DBType: "sqlite", Database: ":memory:"}
+	// No idle connections: every connection is closed as soon as it is returned
+	lPool := lDetails.EffectivePool(DBConnectionPool{DbConMaxIdleTime: 3, DbConMaxOpenConns: 2, DbConMaxIdleConns: 0})
+	if lPool.DbConMaxIdleTime != 0 {
+		t.Errorf("in-memory DbConMaxIdleTime = %d, want 0", lPool.DbConMaxIdleTime)
+	}
+
+	lFirst := openTestMemoryDB(t, lName, lPool)
+	if _, lErr := lFirst.Exec(`CREATE TABLE t (v INTEGER)`); lErr != nil {
+		t.Fatal(lErr)
+	}
+	if _, lErr := lFirst.Exec(`INSERT INTO t (v) VALUES (42)`); lErr != nil {
+		t.Fatal(lErr)
+	}
+	if lStats := lFirst.Stats(); lStats.OpenConnections != 0 {
+		t.Fatalf("%d pooled connections still open, the test needs none", lStats.OpenConnections)
+	}
+
+	// A reconnect opens the new pool before the old one is closed
+	lSecond := openTestMemoryDB(t, lName, lPool)
+	lFirst.Close()
+	var lValue int
+	if lErr := lSecond.QueryRow(`SELECT v FROM t`).Scan(&lValue); lErr != nil || lValue != 42 {
+		t.Fatalf("after reconnect: v = %d, %v", lValue, lErr)
+	}
+
+	// Closing the last pool releases the database
+	lSecond.Close()
+	lThird := openTestMemoryDB(t, lName, lPool)
+	if _, lErr := lThird.Exec(`SELECT v FROM t`); lErr == nil {
+		t.Error("table t survived the close of every pool")
+	}
+}
+
+// openTestMemoryDB opens a pool on the in-memory SQLite database pName the way LocalDbConnect does.
+func openTestMemoryDB(t *testing.T, pName string, pPool DBConnectionPool) *sql.DB {
+	t.Helper()
+	lDb, lErr := openInstrumented(pName, "sqlite", sqliteDSN(pName, ":memory:", nil), true)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	ApplyConnectionPool(lDb, pPool)
+	t.Cleanup(func() { lDb.Close() })
+	return lDb
+}
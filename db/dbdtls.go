@@ -8,16 +8,30 @@ import (
 )
 
 const (
+	// SQLDB is the logical name of the order management database in dbconfig.toml
 	SQLDB = "localDB"
 )
 
 // Init loads the database configurations from the toml config file.
 // It logs errors and returns an error if loading fails.
 func (pDb *AllUsedDatabases) Init(log *utils.Logger) error {
-	if lErr := config.GetAndAssignTomlValue("dbconfig", "DbName", &pDb.DbName); lErr != nil {
-		log.Log(common.ERROR, "Init", fmt.Sprintf("loading lDbName failed: %v", lErr))
-		return fmt.Errorf("loading lDbName: %w", lErr)
+	if lErr := config.GetAndAssignTomlValue("dbconfig", "Databases", &pDb.Databases); lErr != nil {
+		log.Log(common.ERROR, "Init", fmt.Sprintf("loading Databases failed: %v", lErr))
+		return fmt.Errorf("loading Databases: %w", lErr)
 	}
-	log.Log(common.INFO, "Init", "lDbName loaded successfully")
+	log.Log(common.INFO, "Init", fmt.Sprintf("%d databases loaded successfully", len(pDb.Databases)))
 	return nil
 }
+
+// RegisterConfigSchemas declares the dbconfig.toml sections this package expects,
+// so they are validated on every config load.
+func RegisterConfigSchemas() {
+	config.RegisterSchema[map[string]DatabaseType]("dbconfig", "Databases")
+	config.RegisterSchema[DBConnectionPool]("dbconfig", "DBConnectionPool")
+	config.RegisterOptionalSchema[HealthCheck]("dbconfig", "HealthCheck")
+	config.RegisterOptionalSchema[ConnectRetry]("dbconfig", "ConnectRetry")
+	config.RegisterOptionalSchema[QueryTimeouts]("dbconfig", "QueryTimeouts")
+	config.RegisterOptionalSchema[QueryLog]("dbconfig", "QueryLog")
+	config.RegisterOptionalSchema[CircuitBreaker]("dbconfig", "CircuitBreaker")
+	config.RegisterOptionalSchema[Bulkhead]("dbconfig", "Bulkhead")
+}
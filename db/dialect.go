@@ -0,0 +1,292 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DatePart names a calendar part for Dialect.DatePart.
+type DatePart string
+
+const (
+	Year    DatePart = "YEAR"
+	Quarter DatePart = "QUARTER"
+	Month   DatePart = "MONTH"
+	Day     DatePart = "DAY"
+)
+
+/*
+Dialect hides the SQL differences between the supported drivers. Queries are written
+once with MySQL style `?` placeholders and passed through the dialect of the database
+they run on.
+
+Example usage:
+
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	lQuery := lDialect.Rebind(`SELECT name FROM products WHERE product_id = ?`)
+*/
+type Dialect interface {
+	// Name is the DBType the dialect belongs to, e.g. "mysql"
+	Name() string
+
+	// Rebind converts `?` placeholders into the driver's form ($1 or @p1).
+	// Question marks inside quoted literals are left alone.
+	Rebind(pQuery string) string
+
+	// Upsert returns an insert-or-update statement for one row of pColumns, using pKeys
+	// to detect an existing row. Placeholders are already in the driver's form.
+	Upsert(pTable string, pColumns, pKeys []string) string
+
+	// Limit restricts a SELECT to its first pN rows (LIMIT n or TOP n).
+	Limit(pQuery string, pN int) string
+
+	// DatePart extracts a calendar part of a date expression as an integer.
+	DatePart(pPart DatePart, pExpr string) string
+
+	// CurrentDate is today's date without a time part.
+	CurrentDate() string
+}
+
+var (
+	// dialects maps a DBType to its dialect
+	dialects = map[string]Dialect{
+		"mysql":    mysqlDialect{},
+		"postgres": postgresDialect{},
+		"mssql":    mssqlDialect{},
+		"sqlite":   sqliteDialect{},
+	}
+
+	// dialectMu guards dialects
+	dialectMu sync.RWMutex
+)
+
+// RegisterDialect adds or replaces the dialect used for a DBType.
+func RegisterDialect(pDBType string, pDialect Dialect) {
+	dialectMu.Lock()
+	defer dialectMu.Unlock()
+	dialects[pDBType] = pDialect
+}
+
+// DialectFor returns the dialect of a DBType such as "postgres".
+func DialectFor(pDBType string) (Dialect, error) {
+	dialectMu.RLock()
+	defer dialectMu.RUnlock()
+
+	lDialect, ok := dialects[pDBType]
+	if !ok {
+		return nil, fmt.Errorf("no SQL dialect for DB type %q", pDBType)
+	}
+	return lDialect, nil
+}
+
+// DialectOf returns the dialect of a connected logical database.
+func DialectOf(pName string) (Dialect, error) {
+	registryMu.RLock()
+	lEntry, ok := registry[pName]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("database %s is not connected: %w", pName, ErrDBUnavailable)
+	}
+	return DialectFor(lEntry.details.DBType)
+}
+
+// rebind replaces every `?` outside quoted literals with the placeholder built by pFormat.
+func rebind(pQuery string, pFormat func(pIndex int) string) string {
+	var lBuilder strings.Builder
+	lBuilder.Grow(len(pQuery) + 16)
+
+	lIndex := 0
+	var lQuote byte
+	for i := 0; i < len(pQuery); i++ {
+		lChar := pQuery[i]
+		switch {
+		case lQuote != 0:
+			if lChar == lQuote {
+				lQuote = 0
+			}
+		case lChar == '\'' || lChar == '"' || lChar == '`':
+			lQuote = lChar
+		case lChar == '?':
+			lIndex++
+			lBuilder.WriteString(pFormat(lIndex))
+			continue
+		}
+		lBuilder.WriteByte(lChar)
+	}
+	return lBuilder.String()
+}
+
+// placeholders returns n comma separated `?`.
+func placeholders(pN int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", pN), ", ")
+}
+
+// nonKeyColumns returns the columns that are not part of the key.
+func nonKeyColumns(pColumns, pKeys []string) []string {
+	lKeys := make(map[string]bool, len(pKeys))
+	for _, lKey := range pKeys {
+		lKeys[lKey] = true
+	}
+	var lResult []string
+	for _, lColumn := range pColumns {
+		if !lKeys[lColumn] {
+			lResult = append(lResult, lColumn)
+		}
+	}
+	return lResult
+}
+
+// mysqlDialect: ? placeholders, ON DUPLICATE KEY UPDATE, LIMIT
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) Rebind(pQuery string) string { return pQuery }
+
+func (mysqlDialect) Upsert(pTable string, pColumns, pKeys []string) string {
+	lUpdates := make([]string, 0, len(pColumns))
+	for _, lColumn := range nonKeyColumns(pColumns, pKeys) {
+		lUpdates = append(lUpdates, fmt.Sprintf("%s=VALUES(%s)", lColumn, lColumn))
+	}
+	if len(lUpdates) == 0 {
+		// Nothing to update, keep the statement valid
+		lUpdates = append(lUpdates, fmt.Sprintf("%s=%s", pKeys[0], pKeys[0]))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s",
+		pTable, strings.Join(pColumns, ", "), placeholders(len(pColumns)), strings.Join(lUpdates, ", "))
+}
+
+func (mysqlDialect) Limit(pQuery string, pN int) string {
+	return fmt.Sprintf("%s LIMIT %d", strings.TrimRight(pQuery, "; \n\t"), pN)
+}
+
+func (mysqlDialect) DatePart(pPart DatePart, pExpr string) string {
+	return fmt.Sprintf("%s(%s)", pPart, pExpr)
+}
+
+func (mysqlDialect) CurrentDate() string { return "CURRENT_DATE" }
+
+// postgresDialect: $n placeholders, ON CONFLICT DO UPDATE, LIMIT
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) Rebind(pQuery string) string {
+	return rebind(pQuery, func(pIndex int) string { return "$" + strconv.Itoa(pIndex) })
+}
+
+func (d postgresDialect) Upsert(pTable string, pColumns, pKeys []string) string {
+	lUpdates := make([]string, 0, len(pColumns))
+	for _, lColumn := range nonKeyColumns(pColumns, pKeys) {
+		lUpdates = append(lUpdates, fmt.Sprintf("%s=EXCLUDED.%s", lColumn, lColumn))
+	}
+	lAction := "DO NOTHING"
+	if len(lUpdates) > 0 {
+		lAction = "DO UPDATE SET " + strings.Join(lUpdates, ", ")
+	}
+	return d.Rebind(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) %s",
+		pTable, strings.Join(pColumns, ", "), placeholders(len(pColumns)), strings.Join(pKeys, ", "), lAction))
+}
+
+func (postgresDialect) Limit(pQuery string, pN int) string {
+	return fmt.Sprintf("%s LIMIT %d", strings.TrimRight(pQuery, "; \n\t"), pN)
+}
+
+func (postgresDialect) DatePart(pPart DatePart, pExpr string) string {
+	return fmt.Sprintf("CAST(EXTRACT(%s FROM %s) AS INTEGER)", pPart, pExpr)
+}
+
+func (postgresDialect) CurrentDate() string { return "CURRENT_DATE" }
+
+// mssqlDialect: @pn placeholders, MERGE, TOP
+type mssqlDialect struct{}
+
+func (mssqlDialect) Name() string { return "mssql" }
+
+func (mssqlDialect) Rebind(pQuery string) string {
+	return rebind(pQuery, func(pIndex int) string { return "@p" + strconv.Itoa(pIndex) })
+}
+
+func (d mssqlDialect) Upsert(pTable string, pColumns, pKeys []string) string {
+	lOn := make([]string, 0, len(pKeys))
+	for _, lKey := range pKeys {
+		lOn = append(lOn, fmt.Sprintf("t.%s = s.%s", lKey, lKey))
+	}
+	lUpdates := make([]string, 0, len(pColumns))
+	for _, lColumn := range nonKeyColumns(pColumns, pKeys) {
+		lUpdates = append(lUpdates, fmt.Sprintf("t.%s = s.%s", lColumn, lColumn))
+	}
+	lSource := make([]string, 0, len(pColumns))
+	for _, lColumn := range pColumns {
+		lSource = append(lSource, "s."+lColumn)
+	}
+
+	lColumns := strings.Join(pColumns, ", ")
+	lQuery := fmt.Sprintf("MERGE INTO %s AS t USING (VALUES (%s)) AS s (%s) ON %s",
+		pTable, placeholders(len(pColumns)), lColumns, strings.Join(lOn, " AND "))
+	if len(lUpdates) > 0 {
+		lQuery += " WHEN MATCHED THEN UPDATE SET " + strings.Join(lUpdates, ", ")
+	}
+	lQuery += fmt.Sprintf(" WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s);", lColumns, strings.Join(lSource, ", "))
+	return d.Rebind(lQuery)
+}
+
+func (mssqlDialect) Limit(pQuery string, pN int) string {
+	lTrimmed := strings.TrimLeft(pQuery, " \n\t")
+	if len(lTrimmed) < 6 || !strings.EqualFold(lTrimmed[:6], "SELECT") {
+		return pQuery
+	}
+	lRest := lTrimmed[6:]
+	if lAfter := strings.TrimLeft(lRest, " \n\t"); len(lAfter) >= 8 && strings.EqualFold(lAfter[:8], "DISTINCT") {
+		return fmt.Sprintf("SELECT DISTINCT TOP %d%s", pN, lAfter[8:])
+	}
+	return fmt.Sprintf("SELECT TOP %d%s", pN, lRest)
+}
+
+func (mssqlDialect) DatePart(pPart DatePart, pExpr string) string {
+	return fmt.Sprintf("DATEPART(%s, %s)", strings.ToLower(string(pPart)), pExpr)
+}
+
+func (mssqlDialect) CurrentDate() string { return "CAST(GETDATE() AS DATE)" }
+
+// sqliteDialect: ? placeholders, ON CONFLICT DO UPDATE, LIMIT, strftime for dates
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) Rebind(pQuery string) string { return pQuery }
+
+func (sqliteDialect) Upsert(pTable string, pColumns, pKeys []string) string {
+	lUpdates := make([]string, 0, len(pColumns))
+	for _, lColumn := range nonKeyColumns(pColumns, pKeys) {
+		lUpdates = append(lUpdates, fmt.Sprintf("%s=excluded.%s", lColumn, lColumn))
+	}
+	lAction := "DO NOTHING"
+	if len(lUpdates) > 0 {
+		lAction = "DO UPDATE SET " + strings.Join(lUpdates, ", ")
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) %s",
+		pTable, strings.Join(pColumns, ", "), placeholders(len(pColumns)), strings.Join(pKeys, ", "), lAction)
+}
+
+func (sqliteDialect) Limit(pQuery string, pN int) string {
+	return fmt.Sprintf("%s LIMIT %d", strings.TrimRight(pQuery, "; \n\t"), pN)
+}
+
+func (sqliteDialect) DatePart(pPart DatePart, pExpr string) string {
+	switch pPart {
+	case Year:
+		return fmt.Sprintf("CAST(strftime('%%Y', %s) AS INTEGER)", pExpr)
+	case Quarter:
+		return fmt.Sprintf("((CAST(strftime('%%m', %s) AS INTEGER) + 2) / 3)", pExpr)
+	case Month:
+		return fmt.Sprintf("CAST(strftime('%%m', %s) AS INTEGER)", pExpr)
+	default:
+		return fmt.Sprintf("CAST(strftime('%%d', %s) AS INTEGER)", pExpr)
+	}
+}
+
+func (sqliteDialect) CurrentDate() string { return "DATE('now')" }
@@ -0,0 +1,103 @@
+package db
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		dbType string
+		query  string
+		want   string
+	}{
+		{"mysql", "SELECT a FROM t WHERE b = ? AND c = ?", "SELECT a FROM t WHERE b = ? AND c = ?"},
+		{"sqlite", "SELECT a FROM t WHERE b = ?", "SELECT a FROM t WHERE b = ?"},
+		{"postgres", "SELECT a FROM t WHERE b = ? AND c = ?", "SELECT a FROM t WHERE b = $1 AND c = $2"},
+		{"mssql", "SELECT a FROM t WHERE b = ? AND c = ?", "SELECT a FROM t WHERE b = @p1 AND c = @p2"},
+		{"postgres", "SELECT '?' AS q, \"a?\" FROM t WHERE b = ?", "SELECT '?' AS q, \"a?\" FROM t WHERE b = $1"},
+		{"postgres", "SELECT `a?b` FROM t WHERE c LIKE 'x?' AND d = ?", "SELECT `a?b` FROM t WHERE c LIKE 'x?' AND d = $1"},
+		{"mssql", "UPDATE t SET a = 'it''s?' WHERE b = ?", "UPDATE t SET a = 'it''s?' WHERE b = @p1"},
+		{"postgres", "SELECT 1", "SELECT 1"},
+	}
+	for _, tt := range tests {
+		lDialect, lErr := DialectFor(tt.dbType)
+		if lErr != nil {
+			t.Fatal(lErr)
+		}
+		if got := lDialect.Rebind(tt.query); got != tt.want {
+			t.Errorf("%s Rebind(%q) = %q, want %q", tt.dbType, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	tests := []struct {
+		dbType  string
+		columns []string
+		keys    []string
+		want    string
+	}{
+		{"mysql", []string{"id", "name", "email"}, []string{"id"},
+			"INSERT INTO customers (id, name, email) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE name=VALUES(name), email=VALUES(email)"},
+		{"mysql", []string{"id"}, []string{"id"},
+			"INSERT INTO customers (id) VALUES (?) ON DUPLICATE KEY UPDATE id=id"},
+		{"postgres", []string{"id", "name", "email"}, []string{"id"},
+			"INSERT INTO customers (id, name, email) VALUES ($1, $2, $3) ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name, email=EXCLUDED.email"},
+		{"postgres", []string{"id"}, []string{"id"},
+			"INSERT INTO customers (id) VALUES ($1) ON CONFLICT (id) DO NOTHING"},
+		{"sqlite", []string{"id", "name", "email"}, []string{"id"},
+			"INSERT INTO customers (id, name, email) VALUES (?, ?, ?) ON CONFLICT (id) DO UPDATE SET name=excluded.name, email=excluded.email"},
+		{"sqlite", []string{"order_id", "product_id", "qty"}, []string{"order_id", "product_id"},
+			"INSERT INTO customers (order_id, product_id, qty) VALUES (?, ?, ?) ON CONFLICT (order_id, product_id) DO UPDATE SET qty=excluded.qty"},
+		{"mssql", []string{"id", "name"}, []string{"id"},
+			"MERGE INTO customers AS t USING (VALUES (@p1, @p2)) AS s (id, name) ON t.id = s.id" +
+				" WHEN MATCHED THEN UPDATE SET t.name = s.name WHEN NOT MATCHED THEN INSERT (id, name) VALUES (s.id, s.name);"},
+		{"mssql", []string{"a", "b"}, []string{"a", "b"},
+			"MERGE INTO customers AS t USING (VALUES (@p1, @p2)) AS s (a, b) ON t.a = s.a AND t.b = s.b" +
+				" WHEN NOT MATCHED THEN INSERT (a, b) VALUES (s.a, s.b);"},
+	}
+	for _, tt := range tests {
+		lDialect, lErr := DialectFor(tt.dbType)
+		if lErr != nil {
+			t.Fatal(lErr)
+		}
+		if got := lDialect.Upsert("customers", tt.columns, tt.keys); got != tt.want {
+			t.Errorf("%s Upsert(%v, %v) =\n%q\nwant\n%q", tt.dbType, tt.columns, tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		dbType string
+		query  string
+		want   string
+	}{
+		{"mysql", "SELECT a FROM t;", "SELECT a FROM t LIMIT 5"},
+		{"postgres", "SELECT a FROM t\n", "SELECT a FROM t LIMIT 5"},
+		{"sqlite", "SELECT a FROM t ORDER BY a", "SELECT a FROM t ORDER BY a LIMIT 5"},
+		{"mssql", "SELECT a FROM t", "SELECT TOP 5 a FROM t"},
+		{"mssql", "  select distinct a FROM t", "SELECT DISTINCT TOP 5 a FROM t"},
+		{"mssql", "\n\tSELECT\n a FROM t", "SELECT TOP 5\n a FROM t"},
+		{"mssql", "WITH x AS (SELECT 1) SELECT * FROM x", "WITH x AS (SELECT 1) SELECT * FROM x"},
+	}
+	for _, tt := range tests {
+		lDialect, lErr := DialectFor(tt.dbType)
+		if lErr != nil {
+			t.Fatal(lErr)
+		}
+		if got := lDialect.Limit(tt.query, 5); got != tt.want {
+			t.Errorf("%s Limit(%q) = %q, want %q", tt.dbType, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestDialectFor(t *testing.T) {
+	if _, lErr := DialectFor("oracle"); lErr == nil {
+		t.Error("DialectFor(oracle) returned no error")
+	}
+	for _, lType := range []string{"mysql", "postgres", "mssql", "sqlite"} {
+		lDialect, lErr := DialectFor(lType)
+		if lErr != nil || lDialect.Name() != lType {
+			t.Errorf("DialectFor(%s) = %v, %v", lType, lDialect, lErr)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TLS modes of DSNOptions.TLSMode, named after the postgres sslmode values.
+const (
+	TLSDisable    = "disable"     // plain connection
+	TLSPrefer     = "prefer"      // TLS when the server offers it (mysql, mssql)
+	TLSRequire    = "require"     // TLS, server certificate not verified
+	TLSVerifyCA   = "verify-ca"   // TLS, certificate signed by CAFile (mysql, postgres)
+	TLSVerifyFull = "verify-full" // TLS, certificate signed by CAFile and matching Server
+)
+
+// DSNOptions is the optional [Databases.<name>.Options] table. Empty fields keep the
+// driver's default, except that postgres defaults to TLSMode "require" as before.
+type DSNOptions struct {
+	TLSMode           string            `validate:"omitempty,oneof=disable prefer require verify-ca verify-full"`
+	CAFile            string            // PEM file of the CA that signed the server certificate
+	CertFile          string            `validate:"required_with=KeyFile"` // PEM client certificate
+	KeyFile           string            `validate:"required_with=CertFile"`
+	ConnectTimeoutSec int               `validate:"gte=0"`
+	ReadTimeoutSec    int               `validate:"gte=0"` // mysql only
+	WriteTimeoutSec   int               `validate:"gte=0"` // mysql only
+	Charset           string            // mysql charset, postgres client_encoding
+	AppName           string            // reported to the server, e.g. in pg_stat_activity
+	Params            map[string]string // further driver parameters, added to the DSN as is
+}
+
+// buildDSN returns the driver DSN for the logical database pName. Every value is escaped
+// for its driver, so passwords may contain any character.
+func buildDSN(pName string, pDb DatabaseType) (string, error) {
+	if lErr := checkOptions(pDb); lErr != nil {
+		return "", fmt.Errorf("database %s: %w", pName, lErr)
+	}
+
+	switch pDb.DBType {
+	case "mssql":
+		return mssqlDSN(pDb), nil
+	case "mysql":
+		return mysqlDSN(pName, pDb)
+	case "postgres":
+		return postgresDSN(pDb), nil
+	case "sqlite":
+		return sqliteDSN(pName, pDb.Database, pDb.Options.Params), nil
+	default:
+		// Unsupported or missing DB type in config
+		return "", fmt.Errorf("unsupported DB type: %s", pDb.DBType)
+	}
+}
+
+// checkOptions rejects options the database's driver cannot honour, instead of
+// silently connecting with weaker settings than configured.
+func checkOptions(pDb DatabaseType) error {
+	lOpts := pDb.Options
+	var lUnsupported []string
+	lReject := func(pSet bool, pOption string) {
+		if pSet {
+			lUnsupported = append(lUnsupported, pOption)
+		}
+	}
+
+	switch pDb.DBType {
+	case "mssql":
+		lReject(lOpts.TLSMode == TLSVerifyCA, "TLSMode verify-ca")
+		lReject(lOpts.CertFile != "", "CertFile/KeyFile")
+		lReject(lOpts.ReadTimeoutSec > 0, "ReadTimeoutSec")
+		lReject(lOpts.WriteTimeoutSec > 0, "WriteTimeoutSec")
+		lReject(lOpts.Charset != "", "Charset")
+	case "postgres":
+		lReject(lOpts.TLSMode == TLSPrefer, "TLSMode prefer")
+		lReject(lOpts.ReadTimeoutSec > 0, "ReadTimeoutSec")
+		lReject(lOpts.WriteTimeoutSec > 0, "WriteTimeoutSec")
+	case "mysql":
+		lReject(lOpts.TLSMode == TLSPrefer && (lOpts.CAFile != "" || lOpts.CertFile != ""), "TLSMode prefer with certificate files")
+	case "sqlite":
+		lReject(lOpts.TLSMode != "" || lOpts.CAFile != "" || lOpts.CertFile != "", "TLS options")
+		lReject(lOpts.ConnectTimeoutSec > 0 || lOpts.ReadTimeoutSec > 0 || lOpts.WriteTimeoutSec > 0, "timeouts")
+		lReject(lOpts.Charset != "" || lOpts.AppName != "", "Charset/AppName")
+	}
+	if len(lUnsupported) > 0 {
+		return fmt.Errorf("options not supported by %s: %s", pDb.DBType, strings.Join(lUnsupported, ", "))
+	}
+	return nil
+}
+
+// mssqlDSN builds a sqlserver:// URL; url.URL escapes the credentials and parameters.
+func mssqlDSN(pDb DatabaseType) string {
+	lOpts := pDb.Options
+	lQuery := url.Values{}
+	lQuery.Set("database", pDb.Database)
+
+	switch lOpts.TLSMode {
+	case TLSDisable:
+		lQuery.Set("encrypt", "disable")
+	case TLSPrefer:
+		lQuery.Set("encrypt", "false")
+		lQuery.Set("TrustServerCertificate", "true")
+	case TLSRequire:
+		lQuery.Set("encrypt", "true")
+		lQuery.Set("TrustServerCertificate", "true")
+	case TLSVerifyFull:
+		lQuery.Set("encrypt", "true")
+		lQuery.Set("TrustServerCertificate", "false")
+	}
+	if lOpts.CAFile != "" {
+		lQuery.Set("certificate", lOpts.CAFile)
+	}
+	if lOpts.ConnectTimeoutSec > 0 {
+		lQuery.Set("dial timeout", strconv.Itoa(lOpts.ConnectTimeoutSec))
+	}
+	if lOpts.AppName != "" {
+		lQuery.Set("app name", lOpts.AppName)
+	}
+	for lKey, lValue := range lOpts.Params {
+		lQuery.Set(lKey, lValue)
+	}
+
+	lURL := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(pDb.User, pDb.Password),
+		Host:     net.JoinHostPort(pDb.Server, strconv.Itoa(pDb.Port)),
+		RawQuery: lQuery.Encode(),
+	}
+	return lURL.String()
+}
+
+// mysqlDSN builds the DSN with mysql.Config, which escapes every part. Dates are read
+// as time.Time in UTC. TLS settings needing certificates are registered with the driver
+// under "lumel-<name>".
+func mysqlDSN(pName string, pDb DatabaseType) (string, error) {
+	lOpts := pDb.Options
+	lCfg := mysql.NewConfig()
+	lCfg.User = pDb.User
+	lCfg.Passwd = pDb.Password
+	lCfg.Net = "tcp"
+	lCfg.Addr = net.JoinHostPort(pDb.Server, strconv.Itoa(pDb.Port))
+	lCfg.DBName = pDb.Database
+	lCfg.ParseTime = true
+	lCfg.Loc = time.UTC
+	lCfg.Timeout = time.Duration(lOpts.ConnectTimeoutSec) * time.Second
+	lCfg.ReadTimeout = time.Duration(lOpts.ReadTimeoutSec) * time.Second
+	lCfg.WriteTimeout = time.Duration(lOpts.WriteTimeoutSec) * time.Second
+	if lOpts.AppName != "" {
+		lCfg.ConnectionAttributes = "program_name:" + lOpts.AppName
+	}
+	lCfg.Params = maps.Clone(lOpts.Params)
+	if lOpts.Charset != "" {
+		if lCfg.Params == nil {
+			lCfg.Params = make(map[string]string)
+		}
+		lCfg.Params["charset"] = lOpts.Charset
+	}
+
+	lTLS, lErr := tlsConfig(pDb)
+	if lErr != nil {
+		return "", lErr
+	}
+	switch {
+	case lTLS != nil:
+		lCfg.TLSConfig = "lumel-" + pName
+		if lErr := mysql.RegisterTLSConfig(lCfg.TLSConfig, lTLS); lErr != nil {
+			return "", lErr
+		}
+	case lOpts.TLSMode == TLSDisable:
+		lCfg.TLSConfig = "false"
+	case lOpts.TLSMode == TLSPrefer:
+		lCfg.TLSConfig = "preferred"
+	case lOpts.TLSMode == TLSRequire:
+		lCfg.TLSConfig = "skip-verify"
+	}
+	return lCfg.FormatDSN(), nil
+}
+
+// tlsConfig builds the mysql TLS configuration when the mode verifies certificates or
+// client certificates are used. It returns nil when a built-in driver mode suffices.
+func tlsConfig(pDb DatabaseType) (*tls.Config, error) {
+	lOpts := pDb.Options
+	lVerify := lOpts.TLSMode == TLSVerifyCA || lOpts.TLSMode == TLSVerifyFull
+	if !lVerify && !(lOpts.TLSMode == TLSRequire && lOpts.CertFile != "") {
+		return nil, nil
+	}
+
+	lTLS := &tls.Config{ServerName: pDb.Server, MinVersion: tls.VersionTLS12}
+	if lOpts.CertFile != "" {
+		lCert, lErr := tls.LoadX509KeyPair(lOpts.CertFile, lOpts.KeyFile)
+		if lErr != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", lErr)
+		}
+		lTLS.Certificates = []tls.Certificate{lCert}
+	}
+	if lOpts.CAFile != "" {
+		lPem, lErr := os.ReadFile(lOpts.CAFile)
+		if lErr != nil {
+			return nil, fmt.Errorf("reading CAFile: %w", lErr)
+		}
+		lTLS.RootCAs = x509.NewCertPool()
+		if !lTLS.RootCAs.AppendCertsFromPEM(lPem) {
+			return nil, fmt.Errorf("CAFile %s holds no PEM certificate", lOpts.CAFile)
+		}
+	}
+
+	switch lOpts.TLSMode {
+	case TLSRequire:
+		lTLS.InsecureSkipVerify = true
+	case TLSVerifyCA:
+		// Verify the chain ourselves, without the host name check of verify-full
+		lRoots := lTLS.RootCAs
+		lTLS.InsecureSkipVerify = true
+		lTLS.VerifyPeerCertificate = func(pRaw [][]byte, _ [][]*x509.Certificate) error {
+			if len(pRaw) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			lCerts := make([]*x509.Certificate, len(pRaw))
+			for i, lRaw := range pRaw {
+				lCert, lErr := x509.ParseCertificate(lRaw)
+				if lErr != nil {
+					return lErr
+				}
+				lCerts[i] = lCert
+			}
+			lIntermediates := x509.NewCertPool()
+			for _, lCert := range lCerts[1:] {
+				lIntermediates.AddCert(lCert)
+			}
+			_, lErr := lCerts[0].Verify(x509.VerifyOptions{Roots: lRoots, Intermediates: lIntermediates})
+			return lErr
+		}
+	}
+	return lTLS, nil
+}
+
+// postgresDSN builds a lib/pq key=value DSN with every value quoted.
+func postgresDSN(pDb DatabaseType) string {
+	lOpts := pDb.Options
+	lMode := lOpts.TLSMode
+	if lMode == "" {
+		lMode = TLSRequire
+	}
+
+	lPairs := map[string]string{
+		"host":     pDb.Server,
+		"port":     strconv.Itoa(pDb.Port),
+		"user":     pDb.User,
+		"password": pDb.Password,
+		"dbname":   pDb.Database,
+		"sslmode":  lMode,
+	}
+	lOptional := map[string]string{
+		"sslrootcert":      lOpts.CAFile,
+		"sslcert":          lOpts.CertFile,
+		"sslkey":           lOpts.KeyFile,
+		"client_encoding":  lOpts.Charset,
+		"application_name": lOpts.AppName,
+	}
+	if lOpts.ConnectTimeoutSec > 0 {
+		lOptional["connect_timeout"] = strconv.Itoa(lOpts.ConnectTimeoutSec)
+	}
+	for lKey, lValue := range lOptional {
+		if lValue != "" {
+			lPairs[lKey] = lValue
+		}
+	}
+	for lKey, lValue := range lOpts.Params {
+		lPairs[lKey] = lValue
+	}
+
+	lParts := make([]string, 0, len(lPairs))
+	for _, lKey := range slices.Sorted(maps.Keys(lPairs)) {
+		lParts = append(lParts, lKey+"="+quotePostgres(lPairs[lKey]))
+	}
+	return strings.Join(lParts, " ")
+}
+
+// quotePostgres quotes a key=value DSN value, escaping backslashes and single quotes.
+func quotePostgres(pValue string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(pValue) + "'"
+}
+
+// sqliteDSN builds the modernc.org/sqlite DSN for a database file, or a named in-memory
+// database shared by all connections of the pool when pDatabase is ":memory:".
+// Foreign keys are enforced and writers wait for locks instead of failing at once.
+// pParams are appended as further query parameters, e.g. "_txlock" = "immediate".
+func sqliteDSN(pName, pDatabase string, pParams map[string]string) string {
+	lPragmas := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	if len(pParams) > 0 {
+		lExtra := url.Values{}
+		for lKey, lValue := range pParams {
+			lExtra.Set(lKey, lValue)
+		}
+		lPragmas += "&" + lExtra.Encode()
+	}
+	if pDatabase == ":memory:" {
+		return fmt.Sprintf("file:%s?mode=memory&cache=shared&%s", url.PathEscape(pName), lPragmas)
+	}
+	return fmt.Sprintf("file:%s?%s", pDatabase, lPragmas)
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// awkwardPassword holds every character a DSN format treats specially
+const awkwardPassword = `p@ss:w/rd?&x=1 'q' "d" \b%20;#`
+
+func TestMySQLDSNEscaping(t *testing.T) {
+	lDSN, lErr := buildDSN("orders", DatabaseType{
+		Server: "db.local", Port: 3306, User: "app@svc", Password: awkwardPassword,
+		Database: "orders", DBType: "mysql",
+		Options: DSNOptions{TLSMode: TLSRequire, Charset: "utf8mb4", ConnectTimeoutSec: 5},
+	})
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+
+	// The driver must read back exactly what was configured
+	lCfg, lErr := mysql.ParseDSN(lDSN)
+	if lErr != nil {
+		t.Fatalf("ParseDSN(%q): %v", lDSN, lErr)
+	}
+	if lCfg.User != "app@svc" || lCfg.Passwd != awkwardPassword {
+		t.Errorf("credentials = %q / %q", lCfg.User, lCfg.Passwd)
+	}
+	if lCfg.Addr != "db.local:3306" || lCfg.DBName != "orders" || lCfg.TLSConfig != "skip-verify" {
+		t.Errorf("addr = %q, db = %q, tls = %q", lCfg.Addr, lCfg.DBName, lCfg.TLSConfig)
+	}
+	// The driver keeps charset to itself once parsed, so look for it in the DSN
+	if !lCfg.ParseTime || !strings.Contains(lDSN, "charset=utf8mb4") || lCfg.Timeout.Seconds() != 5 {
+		t.Errorf("parseTime = %v, dsn = %q, timeout = %s", lCfg.ParseTime, lDSN, lCfg.Timeout)
+	}
+}
+
+func TestPostgresDSNEscaping(t *testing.T) {
+	lDSN, lErr := buildDSN("orders", DatabaseType{
+		Server: "db.local", Port: 5432, User: "app", Password: `it's a \secret`,
+		Database: "my orders", DBType: "postgres",
+		Options: DSNOptions{AppName: "lumelpkg", Params: map[string]string{"search_path": "sales"}},
+	})
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	lWant := `application_name='lumelpkg' dbname='my orders' host='db.local' password='it\'s a \\secret' ` +
+		`port='5432' search_path='sales' sslmode='require' user='app'`
+	if lDSN != lWant {
+		t.Errorf("postgresDSN =\n%s\nwant\n%s", lDSN, lWant)
+	}
+}
+
+func TestMSSQLDSNEscaping(t *testing.T) {
+	lDSN, lErr := buildDSN("orders", DatabaseType{
+		Server: "db.local", Port: 1433, User: `DOMAIN\app`, Password: awkwardPassword,
+		Database: "orders & returns", DBType: "mssql",
+		Options: DSNOptions{TLSMode: TLSVerifyFull, AppName: "lumel pkg"},
+	})
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+
+	lURL, lErr := url.Parse(lDSN)
+	if lErr != nil {
+		t.Fatalf("url.Parse(%q): %v", lDSN, lErr)
+	}
+	lPassword, _ := lURL.User.Password()
+	if lURL.Scheme != "sqlserver" || lURL.Host != "db.local:1433" || lURL.User.Username() != `DOMAIN\app` || lPassword != awkwardPassword {
+		t.Errorf("parsed %q as scheme %q host %q user %q password %q", lDSN, lURL.Scheme, lURL.Host, lURL.User.Username(), lPassword)
+	}
+	lQuery := lURL.Query()
+	for lKey, lWant := range map[string]string{
+		"database": "orders & returns", "encrypt": "true", "TrustServerCertificate": "false", "app name": "lumel pkg",
+	} {
+		if lGot := lQuery.Get(lKey); lGot != lWant {
+			t.Errorf("%s = %q, want %q", lKey, lGot, lWant)
+		}
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string
+		params   map[string]string
+		want     string
+	}{
+		{"orders", "./lumel.db", nil, "file:./lumel.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"},
+		{"orders", ":memory:", nil, "file:orders?mode=memory&cache=shared&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"},
+		{"my orders/2", ":memory:", nil, "file:my%20orders%2F2?mode=memory&cache=shared&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"},
+		{"orders", "./lumel.db", map[string]string{"_txlock": "immediate", "a&b": "c d"},
+			"file:./lumel.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate&a%26b=c+d"},
+	}
+	for _, tt := range tests {
+		if got := sqliteDSN(tt.name, tt.database, tt.params); got != tt.want {
+			t.Errorf("sqliteDSN(%q, %q, %v) = %q, want %q", tt.name, tt.database, tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOptions(t *testing.T) {
+	tests := []struct {
+		db      DatabaseType
+		wantErr string
+	}{
+		{DatabaseType{DBType: "postgres", Options: DSNOptions{TLSMode: TLSVerifyFull}}, ""},
+		{DatabaseType{DBType: "postgres", Options: DSNOptions{TLSMode: TLSPrefer}}, "TLSMode prefer"},
+		{DatabaseType{DBType: "mssql", Options: DSNOptions{TLSMode: TLSVerifyCA, Charset: "utf8"}}, "TLSMode verify-ca, Charset"},
+		{DatabaseType{DBType: "sqlite", Options: DSNOptions{Params: map[string]string{"_txlock": "immediate"}}}, ""},
+		{DatabaseType{DBType: "sqlite", Options: DSNOptions{TLSMode: TLSRequire}}, "TLS options"},
+	}
+	for _, tt := range tests {
+		lErr := checkOptions(tt.db)
+		switch {
+		case tt.wantErr == "" && lErr != nil:
+			t.Errorf("checkOptions(%s %+v) = %v, want nil", tt.db.DBType, tt.db.Options, lErr)
+		case tt.wantErr != "" && (lErr == nil || !strings.Contains(lErr.Error(), tt.wantErr)):
+			t.Errorf("checkOptions(%s %+v) = %v, want %q", tt.db.DBType, tt.db.Options, lErr, tt.wantErr)
+		}
+	}
+}
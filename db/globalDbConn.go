@@ -1,15 +1,117 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"lumelpkg/common"
+	"lumelpkg/config"
 	"lumelpkg/utils"
 )
 
-func GlobalDBInit(log *utils.Logger) {
+// GlobalDBInit connects every database configured under [Databases.<name>] in dbconfig.toml
+// and keeps the registry in sync with later config reloads. Each database is pinged and
+// retried with exponential backoff (see ConnectRetry); if a primary is still unreachable
+// after the deadline an error is returned so the service can fail fast. Unreachable
+// replicas are only logged, reads fall back to their primary until they recover.
+func GlobalDBInit(log *utils.Logger) error {
 	log.Log("INFO", "GlobalDBInit (+)")
-	var lErr error
-	if Global_DB_Instance, lErr = LocalDbConnect(SQLDB); lErr != nil {
-		log.Log("ERROR", "GlobalDBInit", fmt.Sprintf("loading lDbName: %v", lErr))
+
+	lDbDetails := new(AllUsedDatabases)
+	if lErr := lDbDetails.Init(log); lErr != nil {
+		log.Log("ERROR", "GlobalDBInit", fmt.Sprintf("loading Databases: %v", lErr))
+		return lErr
+	}
+
+	lReplicas := make(map[string]bool)
+	for lName, lDetails := range lDbDetails.Databases {
+		for _, lReplica := range lDetails.Replicas {
+			if _, ok := lDbDetails.Databases[lReplica]; !ok {
+				log.Log(common.ERROR, "GlobalDBInit", fmt.Sprintf("Replica %s of %s is not configured", lReplica, lName))
+			}
+			lReplicas[lReplica] = true
+		}
+	}
+
+	var lErrs []error
+	for lName, lDetails := range lDbDetails.Databases {
+		lErr := connectWithRetry(log, lName, lDetails)
+		if lErr == nil {
+			continue
+		}
+		log.Log(common.ERROR, "GlobalDBInit", lErr.Error())
+		if !lReplicas[lName] {
+			lErrs = append(lErrs, lErr)
+			continue
+		}
+		// Register the replica anyway so the health monitor can bring it back
+		connectDB(log, lName, lDetails)
+		setHealth(lName, false)
+	}
+	if len(lErrs) > 0 {
+		return errors.Join(lErrs...)
+	}
+
+	// Keep database health up to date and reconnect failed pools
+	go MonitorDatabases(log)
+
+	// Open, reopen or close databases whenever their sections change in dbconfig.toml
+	config.Watch("dbconfig", "Databases", func(_, pNew map[string]DatabaseType) {
+		syncDatabases(log, pNew)
+	})
+
+	// Resize the live pools whenever the default DBConnectionPool changes
+	config.Watch("dbconfig", "DBConnectionPool", func(pOld, pNew DBConnectionPool) {
+		log.Log(common.INFO, "GlobalDBInit", fmt.Sprintf("DBConnectionPool changed from %+v to %+v", pOld, pNew))
+		registryMu.RLock()
+		defer registryMu.RUnlock()
+		for _, lEntry := range registry {
+			ApplyConnectionPool(lEntry.db, lEntry.details.EffectivePool(pNew))
+		}
+	})
+	log.Log("INFO", "GlobalDBInit(-)", fmt.Sprintf("Connected databases: %v", DatabaseNames()))
+	return nil
+}
+
+// connectDB opens one logical database without pinging it and stores it in the registry.
+// The health monitor pings it on its next round.
+func connectDB(log *utils.Logger, pName string, pDetails DatabaseType) {
+	lDb, lErr := LocalDbConnect(log, pName)
+	if lErr != nil {
+		log.Log("ERROR", "GlobalDBInit", fmt.Sprintf("connecting %s: %v", pName, lErr))
+		return
+	}
+	registerDB(pName, lDb, pDetails)
+}
+
+// syncDatabases applies a reloaded Databases table to the registry: new databases are
+// opened, changed connection details reopen the pool, pool-only changes are applied
+// in place and removed databases are closed.
+func syncDatabases(log *utils.Logger, pDatabases map[string]DatabaseType) {
+	var lDefaultPool DBConnectionPool
+	if lErr := config.GetAndAssignTomlValue("dbconfig", "DBConnectionPool", &lDefaultPool); lErr != nil {
+		log.Log(common.ERROR, "syncDatabases", fmt.Sprintf("Error reading DBConnectionPool: %v", lErr))
+	}
+
+	registryMu.RLock()
+	lCurrent := make(map[string]registeredDB, len(registry))
+	for lName, lEntry := range registry {
+		lCurrent[lName] = lEntry
+	}
+	registryMu.RUnlock()
+
+	for lName, lDetails := range pDatabases {
+		lEntry, ok := lCurrent[lName]
+		if ok && lEntry.details.sameConnection(lDetails) && updateDetails(lName, lDetails, lDefaultPool) {
+			continue
+		}
+		log.Log(common.INFO, "syncDatabases", "Connecting database "+lName)
+		connectDB(log, lName, lDetails)
+	}
+
+	for lName := range lCurrent {
+		if _, ok := pDatabases[lName]; !ok {
+			log.Log(common.INFO, "syncDatabases", "Closing removed database "+lName)
+			unregisterDB(lName)
+		}
 	}
-	log.Log("INFO", "GlobalDBInit(-)", "Successfully loaded lDbName config")
 }
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"lumelpkg/common"
+	"lumelpkg/config"
+	"lumelpkg/utils"
+	"sync"
+	"time"
+)
+
+// ErrDBUnavailable is returned when a database is not connected or failed its last
+// health check. Handlers map it to 503 Service Unavailable.
+var ErrDBUnavailable = errors.New("database unavailable")
+
+// HealthCheck is the [HealthCheck] section of dbconfig.toml
+type HealthCheck struct {
+	IntervalSec int `validate:"gte=1"`
+	TimeoutSec  int `validate:"gte=1"`
+}
+
+// ConnectRetry is the [ConnectRetry] section of dbconfig.toml, used on startup and reconnects
+type ConnectRetry struct {
+	InitialBackoffMs int     `validate:"gte=1"`
+	MaxBackoffMs     int     `validate:"gtefield=InitialBackoffMs"`
+	Multiplier       float64 `validate:"gte=1"`
+	DeadlineSec      int     `validate:"gte=1"`
+}
+
+var (
+	// dbDown holds the databases that failed their last health check
+	dbDown = make(map[string]bool)
+
+	// healthMu guards dbDown
+	healthMu sync.RWMutex
+)
+
+// IsHealthy reports whether a database passed its last health check.
+func IsHealthy(pName string) bool {
+	healthMu.RLock()
+	defer healthMu.RUnlock()
+	return !dbDown[pName]
+}
+
+// setHealth records a health check result and reports whether it changed.
+func setHealth(pName string, pHealthy bool) bool {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	lChanged := dbDown[pName] == pHealthy
+	dbDown[pName] = !pHealthy
+	return lChanged
+}
+
+// openAndPing opens a fresh pool for pName and only returns it once it answers a ping.
+func openAndPing(log *utils.Logger, pName string, pTimeout time.Duration) (*sql.DB, error) {
+	lDb, lErr := LocalDbConnect(log, pName)
+	if lErr != nil {
+		return nil, lErr
+	}
+
+	lCtx, lCancel := context.WithTimeout(context.Background(), pTimeout)
+	defer lCancel()
+	if lErr := lDb.PingContext(lCtx); lErr != nil {
+		lDb.Close()
+		return nil, lErr
+	}
+	return lDb, nil
+}
+
+// connectWithRetry opens and pings a database, retrying with exponential backoff until
+// the configured deadline. On success the pool is registered and marked healthy.
+func connectWithRetry(log *utils.Logger, pName string, pDetails DatabaseType) error {
+	lRetry := connectRetrySettings()
+	lTimeout := time.Duration(healthCheckSettings().TimeoutSec) * time.Second
+	lDeadline := time.Now().Add(time.Duration(lRetry.DeadlineSec) * time.Second)
+	lBackoff := time.Duration(lRetry.InitialBackoffMs) * time.Millisecond
+
+	for lAttempt := 1; ; lAttempt++ {
+		lDb, lErr := openAndPing(log, pName, lTimeout)
+		if lErr == nil {
+			registerDB(pName, lDb, pDetails)
+			setHealth(pName, true)
+			log.Log(common.INFO, "connectWithRetry", fmt.Sprintf("Connected %s after %d attempt(s)", pName, lAttempt))
+			return nil
+		}
+
+		if time.Now().Add(lBackoff).After(lDeadline) {
+			setHealth(pName, false)
+			return fmt.Errorf("connecting %s: giving up after %d attempts: %w", pName, lAttempt, lErr)
+		}
+		log.Log(common.ERROR, "connectWithRetry", fmt.Sprintf("Attempt %d for %s failed, retrying in %s: %v", lAttempt, pName, lBackoff, lErr))
+		time.Sleep(lBackoff)
+
+		lBackoff = time.Duration(float64(lBackoff) * lRetry.Multiplier)
+		if lMax := time.Duration(lRetry.MaxBackoffMs) * time.Millisecond; lBackoff > lMax {
+			lBackoff = lMax
+		}
+	}
+}
+
+// MonitorDatabases pings every registered database on the interval from dbconfig.toml.
+// A database that fails is marked unhealthy, so GetDB returns ErrDBUnavailable and Reader
+// skips it as a replica, and a fresh pool is opened to replace it. It never returns.
+func MonitorDatabases(log *utils.Logger) {
+	log.Log(common.INFO, "MonitorDatabases", "Started")
+	for {
+		lSettings := healthCheckSettings()
+		time.Sleep(time.Duration(lSettings.IntervalSec) * time.Second)
+		checkDatabases(log, time.Duration(lSettings.TimeoutSec)*time.Second)
+	}
+}
+
+// checkDatabases pings each registered database once, records the result and
+// reconnects the ones that failed.
+func checkDatabases(log *utils.Logger, pTimeout time.Duration) {
+	registryMu.RLock()
+	lEntries := make(map[string]registeredDB, len(registry))
+	for lName, lEntry := range registry {
+		lEntries[lName] = lEntry
+	}
+	registryMu.RUnlock()
+
+	for lName, lEntry := range lEntries {
+		lCtx, lCancel := context.WithTimeout(context.Background(), pTimeout)
+		lErr := lEntry.db.PingContext(lCtx)
+		lCancel()
+
+		if lErr == nil {
+			if setHealth(lName, true) {
+				log.Log(common.INFO, "MonitorDatabases", fmt.Sprintf("Database %s is back up", lName))
+			}
+			continue
+		}
+
+		if setHealth(lName, false) {
+			log.Log(common.ERROR, "MonitorDatabases", fmt.Sprintf("Database %s is down: %v", lName, lErr))
+		}
+
+		// Replace the pool; a broken handle (e.g. stale DNS or TLS state) will not recover by itself.
+		// The old pool is closed after a drain delay, queries holding it can still finish
+		lDb, lErr := openAndPing(log, lName, pTimeout)
+		if lErr != nil {
+			log.Log(common.DEBUG, "MonitorDatabases", fmt.Sprintf("Reconnecting %s failed: %v", lName, lErr))
+			continue
+		}
+		if !replaceDB(lName, lEntry.db, lDb) {
+			// A config reload replaced or removed the pool while this one was opened
+			lDb.Close()
+			continue
+		}
+		setHealth(lName, true)
+		log.Log(common.INFO, "MonitorDatabases", fmt.Sprintf("Database %s reconnected", lName))
+	}
+}
+
+// healthCheckSettings reads the health check timing, falling back to 10s / 2s.
+func healthCheckSettings() HealthCheck {
+	lSettings := HealthCheck{IntervalSec: 10, TimeoutSec: 2}
+	config.GetAndAssignTomlValue("dbconfig", "HealthCheck", &lSettings)
+	if lSettings.IntervalSec <= 0 {
+		lSettings.IntervalSec = 10
+	}
+	if lSettings.TimeoutSec <= 0 {
+		lSettings.TimeoutSec = 2
+	}
+	return lSettings
+}
+
+// connectRetrySettings reads the startup/reconnect backoff, falling back to 500ms..10s over 60s.
+func connectRetrySettings() ConnectRetry {
+	lSettings := ConnectRetry{InitialBackoffMs: 500, MaxBackoffMs: 10000, Multiplier: 2, DeadlineSec: 60}
+	config.GetAndAssignTomlValue("dbconfig", "ConnectRetry", &lSettings)
+	if lSettings.InitialBackoffMs <= 0 {
+		lSettings.InitialBackoffMs = 500
+	}
+	if lSettings.MaxBackoffMs < lSettings.InitialBackoffMs {
+		lSettings.MaxBackoffMs = lSettings.InitialBackoffMs
+	}
+	if lSettings.Multiplier < 1 {
+		lSettings.Multiplier = 1
+	}
+	if lSettings.DeadlineSec <= 0 {
+		lSettings.DeadlineSec = 60
+	}
+	return lSettings
+}
@@ -0,0 +1,572 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"lumelpkg/common"
+	"lumelpkg/utils"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryLog is the [QueryLog] section of dbconfig.toml
+type QueryLog struct {
+	SlowQueryMs int `validate:"gte=0"` // queries taking longer are logged with their SQL, 0 disables
+}
+
+// QueryMetrics aggregates the statements of one kind ("query" or "exec") on one database.
+type QueryMetrics struct {
+	Count       int64   `json:"count"`
+	Errors      int64   `json:"errors"`
+	Slow        int64   `json:"slow"`
+	Rows        int64   `json:"rows"`
+	TotalMs     float64 `json:"totalMs"`
+	MaxMs       float64 `json:"maxMs"`
+	LastError   string  `json:"lastError,omitempty"`
+	LastErrorAt string  `json:"lastErrorAt,omitempty"`
+}
+
+// PoolStats is the JSON view of sql.DBStats, durations in milliseconds.
+type PoolStats struct {
+	MaxOpenConnections int     `json:"maxOpenConnections"`
+	OpenConnections    int     `json:"openConnections"`
+	InUse              int     `json:"inUse"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"waitCount"`
+	WaitDurationMs     float64 `json:"waitDurationMs"`
+	MaxIdleClosed      int64   `json:"maxIdleClosed"`
+	MaxIdleTimeClosed  int64   `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed  int64   `json:"maxLifetimeClosed"`
+}
+
+// DatabaseStats is what Stats reports for one logical database.
+type DatabaseStats struct {
+	Healthy bool                    `json:"healthy"`
+	Circuit string                  `json:"circuit"` // closed, open or half-open
+	Pool    PoolStats               `json:"pool"`
+	Queries map[string]QueryMetrics `json:"queries"`
+}
+
+var (
+	// queryMetrics holds the metrics per logical database and statement kind
+	queryMetrics = make(map[string]map[string]*QueryMetrics)
+
+	// metricsMu guards queryMetrics
+	metricsMu sync.Mutex
+)
+
+// Stats returns the pool statistics and query metrics of every connected database.
+// Query metrics are kept per logical name, so they survive a reconnect.
+func Stats() map[string]DatabaseStats {
+	registryMu.RLock()
+	lStats := make(map[string]DatabaseStats, len(registry))
+	for lName, lEntry := range registry {
+		lPool := lEntry.db.Stats()
+		lStats[lName] = DatabaseStats{
+			Healthy: IsHealthy(lName),
+			Circuit: BreakerState(lName),
+			Pool: PoolStats{
+				MaxOpenConnections: lPool.MaxOpenConnections,
+				OpenConnections:    lPool.OpenConnections,
+				InUse:              lPool.InUse,
+				Idle:               lPool.Idle,
+				WaitCount:          lPool.WaitCount,
+				WaitDurationMs:     float64(lPool.WaitDuration.Microseconds()) / 1000,
+				MaxIdleClosed:      lPool.MaxIdleClosed,
+				MaxIdleTimeClosed:  lPool.MaxIdleTimeClosed,
+				MaxLifetimeClosed:  lPool.MaxLifetimeClosed,
+			},
+			Queries: make(map[string]QueryMetrics),
+		}
+	}
+	registryMu.RUnlock()
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	for lName, lKinds := range queryMetrics {
+		lEntry, ok := lStats[lName]
+		if !ok {
+			continue
+		}
+		for lKind, lMetrics := range lKinds {
+			lEntry.Queries[lKind] = *lMetrics
+		}
+	}
+	return lStats
+}
+
+// openInstrumented opens pDSN with the registered driver pDriver wrapped so that every
+// statement run through the pool is timed and logged under the logical name pName.
+// Statements inside transactions and prepared statements are covered as well.
+// pPin keeps one connection open until the pool is closed (see memoryConnector).
+func openInstrumented(pName, pDriver, pDSN string, pPin bool) (*sql.DB, error) {
+	// sql.Open does not connect, it is only used to look up the registered driver
+	lRaw, lErr := sql.Open(pDriver, pDSN)
+	if lErr != nil {
+		return nil, lErr
+	}
+	lDriver := lRaw.Driver()
+	lRaw.Close()
+
+	var lConnector driver.Connector = dsnConnector{dsn: pDSN, driver: lDriver}
+	if lDriverCtx, ok := lDriver.(driver.DriverContext); ok {
+		if lConnector, lErr = lDriverCtx.OpenConnector(pDSN); lErr != nil {
+			return nil, lErr
+		}
+	}
+	if pPin {
+		lPin, lErr := lConnector.Connect(context.Background())
+		if lErr != nil {
+			return nil, lErr
+		}
+		lConnector = memoryConnector{Connector: lConnector, pin: lPin}
+	}
+	return sql.OpenDB(instrumentedConnector{name: pName, base: lConnector}), nil
+}
+
+// observe records one finished statement: metrics, its outcome on the circuit breaker (pTrial
+// when it was the half-open trial, see admitCircuit), a DEBUG line tagged with the ReqID of
+// the logger in pCtx, and the SQL with redacted arguments when it was slow or failed.
+func observe(pCtx context.Context, pName string, pTrial bool, pKind, pQuery string, pArgs []driver.NamedValue, pStart time.Time, pRows int64, pErr error) {
+	lTook := time.Since(pStart)
+	lMs := float64(lTook.Microseconds()) / 1000
+	lSlowMs := slowQueryMs()
+	lSlow := lSlowMs > 0 && lTook >= time.Duration(lSlowMs)*time.Millisecond
+
+	metricsMu.Lock()
+	if queryMetrics[pName] == nil {
+		queryMetrics[pName] = make(map[string]*QueryMetrics)
+	}
+	lMetrics := queryMetrics[pName][pKind]
+	if lMetrics == nil {
+		lMetrics = new(QueryMetrics)
+		queryMetrics[pName][pKind] = lMetrics
+	}
+	lMetrics.Count++
+	lMetrics.Rows += pRows
+	lMetrics.TotalMs += lMs
+	lMetrics.MaxMs = max(lMetrics.MaxMs, lMs)
+	if lSlow {
+		lMetrics.Slow++
+	}
+	if pErr != nil {
+		lMetrics.Errors++
+		lMetrics.LastError = pErr.Error()
+		lMetrics.LastErrorAt = time.Now().Format(time.RFC3339)
+	}
+	metricsMu.Unlock()
+
+	log := contextLogger(pCtx)
+	if lFrom, lTo, lChanged := recordOutcome(pCtx, pName, pTrial, pErr); lChanged {
+		log.Log(common.ERROR, "CircuitBreaker", fmt.Sprintf("Circuit of database %s went from %s to %s", pName, lFrom, lTo))
+	}
+	lFields := []any{utils.F("db", pName), utils.F("kind", pKind), utils.F("tookMs", lMs), utils.F("rows", pRows)}
+	switch {
+	case pErr != nil:
+		log.Log(common.ERROR, "DBQuery", append(lFields, pErr.Error(), utils.F("sql", compactSQL(pQuery)), utils.F("args", redactArgs(pArgs)))...)
+	case lSlow:
+		log.Log(common.INFO, "SlowQuery", append(lFields, "slow statement", utils.F("sql", compactSQL(pQuery)), utils.F("args", redactArgs(pArgs)))...)
+	default:
+		log.Log(common.DEBUG, "DBQuery", lFields...)
+	}
+}
+
+// contextLogger returns the logger of the request in pCtx, or a new one with its own ReqID.
+func contextLogger(pCtx context.Context) *utils.Logger {
+	log, ok := utils.LoggerFrom(pCtx)
+	if !ok {
+		log = new(utils.Logger)
+		log.SetReqID()
+	}
+	return log
+}
+
+// queryLogSettings caches [QueryLog], the slow query threshold is 500ms when not configured
+var queryLogSettings = newSettingsCache("QueryLog", QueryLog{SlowQueryMs: 500}, nil)
+
+// slowQueryMs returns the slow query threshold.
+func slowQueryMs() int {
+	return queryLogSettings.get().SlowQueryMs
+}
+
+// compactSQL folds a multi-line statement into one line for the log.
+func compactSQL(pQuery string) string {
+	return strings.Join(strings.Fields(pQuery), " ")
+}
+
+// redactArgs describes statement arguments by type only, e.g. [string(10) int64 <nil>],
+// so customer data and credentials never reach the log.
+func redactArgs(pArgs []driver.NamedValue) string {
+	lParts := make([]string, 0, len(pArgs))
+	for _, lArg := range pArgs {
+		switch lValue := lArg.Value.(type) {
+		case nil:
+			lParts = append(lParts, "<nil>")
+		case string:
+			lParts = append(lParts, fmt.Sprintf("string(%d)", len(lValue)))
+		case []byte:
+			lParts = append(lParts, fmt.Sprintf("[]byte(%d)", len(lValue)))
+		default:
+			lParts = append(lParts, fmt.Sprintf("%T", lValue))
+		}
+	}
+	return "[" + strings.Join(lParts, " ") + "]"
+}
+
+// dsnConnector is the driver.Connector of drivers without driver.DriverContext (mssql).
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+
+func (c dsnConnector) Driver() driver.Driver { return c.driver }
+
+// memoryConnector holds one connection to an in-memory SQLite database for the life of the
+// pool. SQLite drops the database with its last connection, which idle timeouts, retireDB or
+// a pool without idle connections would otherwise close. A reconnected pool pins its own
+// connection before the old pool is retired, so the data carries over.
+type memoryConnector struct {
+	driver.Connector
+	pin driver.Conn
+}
+
+// Close releases the pinned connection, called by sql.DB.Close.
+func (c memoryConnector) Close() error {
+	lErr := c.pin.Close()
+	if lCloser, ok := c.Connector.(io.Closer); ok {
+		lErr = errors.Join(lErr, lCloser.Close())
+	}
+	return lErr
+}
+
+// instrumentedConnector hands out instrumented connections.
+type instrumentedConnector struct {
+	name string
+	base driver.Connector
+}
+
+func (c instrumentedConnector) Connect(pCtx context.Context) (driver.Conn, error) {
+	lConn, lErr := c.base.Connect(pCtx)
+	if lErr != nil {
+		// A failed dial is as good as a failed trial: it keeps an open circuit open
+		if lFrom, lTo, lChanged := recordOutcome(pCtx, c.name, true, lErr); lChanged {
+			contextLogger(pCtx).Log(common.ERROR, "CircuitBreaker", fmt.Sprintf("Circuit of database %s went from %s to %s", c.name, lFrom, lTo))
+		}
+		return nil, lErr
+	}
+	return &instrumentedConn{name: c.name, base: lConn}, nil
+}
+
+func (c instrumentedConnector) Driver() driver.Driver { return c.base.Driver() }
+
+func (c instrumentedConnector) Close() error {
+	if lCloser, ok := c.base.(io.Closer); ok {
+		return lCloser.Close()
+	}
+	return nil
+}
+
+// instrumentedConn times the statements of one driver connection. Every optional driver
+// interface is forwarded so the wrapped driver behaves exactly as without the wrapper.
+type instrumentedConn struct {
+	name string
+	base driver.Conn
+}
+
+func (c *instrumentedConn) Prepare(pQuery string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), pQuery)
+}
+
+func (c *instrumentedConn) PrepareContext(pCtx context.Context, pQuery string) (driver.Stmt, error) {
+	var lStmt driver.Stmt
+	var lErr error
+	if lPreparer, ok := c.base.(driver.ConnPrepareContext); ok {
+		lStmt, lErr = lPreparer.PrepareContext(pCtx, pQuery)
+	} else {
+		lStmt, lErr = c.base.Prepare(pQuery)
+	}
+	if lErr != nil {
+		observe(pCtx, c.name, false, "prepare", pQuery, nil, time.Now(), 0, lErr)
+		return nil, lErr
+	}
+	return &instrumentedStmt{conn: c, base: lStmt, query: pQuery}, nil
+}
+
+func (c *instrumentedConn) Close() error { return c.base.Close() }
+
+func (c *instrumentedConn) Begin() (driver.Tx, error) { return c.base.Begin() }
+
+func (c *instrumentedConn) BeginTx(pCtx context.Context, pOpts driver.TxOptions) (driver.Tx, error) {
+	if lBeginner, ok := c.base.(driver.ConnBeginTx); ok {
+		return lBeginner.BeginTx(pCtx, pOpts)
+	}
+	if pOpts.Isolation != driver.IsolationLevel(sql.LevelDefault) || pOpts.ReadOnly {
+		return nil, errors.New("db: driver does not support non-default transaction options")
+	}
+	return c.base.Begin()
+}
+
+func (c *instrumentedConn) QueryContext(pCtx context.Context, pQuery string, pArgs []driver.NamedValue) (driver.Rows, error) {
+	lQueryer, ok := c.base.(driver.QueryerContext)
+	if !ok {
+		// database/sql falls back to PrepareContext, which is instrumented
+		return nil, driver.ErrSkip
+	}
+	lTrial, lErr := admitCircuit(c.name, true)
+	if lErr != nil {
+		return nil, lErr
+	}
+	lStart := time.Now()
+	lRows, lErr := lQueryer.QueryContext(pCtx, pQuery, pArgs)
+	if lErr != nil {
+		if !errors.Is(lErr, driver.ErrSkip) {
+			observe(pCtx, c.name, lTrial, "query", pQuery, pArgs, lStart, 0, lErr)
+		} else if lTrial {
+			releaseTrial(c.name)
+		}
+		return nil, lErr
+	}
+	return &instrumentedRows{ctx: pCtx, name: c.name, trial: lTrial, base: lRows, query: pQuery, args: pArgs, start: lStart}, nil
+}
+
+func (c *instrumentedConn) ExecContext(pCtx context.Context, pQuery string, pArgs []driver.NamedValue) (driver.Result, error) {
+	lExecer, ok := c.base.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	lTrial, lErr := admitCircuit(c.name, true)
+	if lErr != nil {
+		return nil, lErr
+	}
+	lStart := time.Now()
+	lResult, lErr := lExecer.ExecContext(pCtx, pQuery, pArgs)
+	if errors.Is(lErr, driver.ErrSkip) {
+		if lTrial {
+			releaseTrial(c.name)
+		}
+		return nil, lErr
+	}
+	observe(pCtx, c.name, lTrial, "exec", pQuery, pArgs, lStart, rowsAffected(lResult, lErr), lErr)
+	return lResult, lErr
+}
+
+func (c *instrumentedConn) Ping(pCtx context.Context) error {
+	if lPinger, ok := c.base.(driver.Pinger); ok {
+		return lPinger.Ping(pCtx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(pCtx context.Context) error {
+	if lResetter, ok := c.base.(driver.SessionResetter); ok {
+		return lResetter.ResetSession(pCtx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if lValidator, ok := c.base.(driver.Validator); ok {
+		return lValidator.IsValid()
+	}
+	return true
+}
+
+func (c *instrumentedConn) CheckNamedValue(pValue *driver.NamedValue) error {
+	if lChecker, ok := c.base.(driver.NamedValueChecker); ok {
+		return lChecker.CheckNamedValue(pValue)
+	}
+	return driver.ErrSkip
+}
+
+// instrumentedStmt times the executions of a prepared statement.
+type instrumentedStmt struct {
+	conn  *instrumentedConn
+	base  driver.Stmt
+	query string
+}
+
+func (s *instrumentedStmt) Close() error { return s.base.Close() }
+
+func (s *instrumentedStmt) NumInput() int { return s.base.NumInput() }
+
+func (s *instrumentedStmt) Exec(pArgs []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(pArgs))
+}
+
+func (s *instrumentedStmt) Query(pArgs []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(pArgs))
+}
+
+func (s *instrumentedStmt) ExecContext(pCtx context.Context, pArgs []driver.NamedValue) (driver.Result, error) {
+	lTrial, lErr := admitCircuit(s.conn.name, true)
+	if lErr != nil {
+		return nil, lErr
+	}
+	lStart := time.Now()
+	var lResult driver.Result
+	if lExecer, ok := s.base.(driver.StmtExecContext); ok {
+		lResult, lErr = lExecer.ExecContext(pCtx, pArgs)
+	} else {
+		lResult, lErr = s.base.Exec(plainValues(pArgs))
+	}
+	observe(pCtx, s.conn.name, lTrial, "exec", s.query, pArgs, lStart, rowsAffected(lResult, lErr), lErr)
+	return lResult, lErr
+}
+
+func (s *instrumentedStmt) QueryContext(pCtx context.Context, pArgs []driver.NamedValue) (driver.Rows, error) {
+	lTrial, lErr := admitCircuit(s.conn.name, true)
+	if lErr != nil {
+		return nil, lErr
+	}
+	lStart := time.Now()
+	var lRows driver.Rows
+	if lQueryer, ok := s.base.(driver.StmtQueryContext); ok {
+		lRows, lErr = lQueryer.QueryContext(pCtx, pArgs)
+	} else {
+		lRows, lErr = s.base.Query(plainValues(pArgs))
+	}
+	if lErr != nil {
+		observe(pCtx, s.conn.name, lTrial, "query", s.query, pArgs, lStart, 0, lErr)
+		return nil, lErr
+	}
+	return &instrumentedRows{ctx: pCtx, name: s.conn.name, trial: lTrial, base: lRows, query: s.query, args: pArgs, start: lStart}, nil
+}
+
+// CheckNamedValue prefers the statement's own checker, then the connection's (mssql).
+func (s *instrumentedStmt) CheckNamedValue(pValue *driver.NamedValue) error {
+	if lChecker, ok := s.base.(driver.NamedValueChecker); ok {
+		return lChecker.CheckNamedValue(pValue)
+	}
+	return s.conn.CheckNamedValue(pValue)
+}
+
+func (s *instrumentedStmt) ColumnConverter(pIndex int) driver.ValueConverter {
+	if lConverter, ok := s.base.(driver.ColumnConverter); ok {
+		return lConverter.ColumnConverter(pIndex)
+	}
+	return driver.DefaultParameterConverter
+}
+
+// instrumentedRows counts the rows read and records the query when the rows are closed,
+// so the duration includes fetching the result.
+type instrumentedRows struct {
+	ctx   context.Context
+	name  string
+	trial bool // the query is the half-open trial of its circuit
+	base  driver.Rows
+	query string
+	args  []driver.NamedValue
+	start time.Time
+	rows  int64
+	err   error
+	done  bool
+}
+
+func (r *instrumentedRows) Columns() []string { return r.base.Columns() }
+
+func (r *instrumentedRows) Next(pDest []driver.Value) error {
+	lErr := r.base.Next(pDest)
+	switch {
+	case lErr == nil:
+		r.rows++
+	case !errors.Is(lErr, io.EOF):
+		r.err = lErr
+	}
+	return lErr
+}
+
+func (r *instrumentedRows) Close() error {
+	lErr := r.base.Close()
+	if !r.done {
+		r.done = true
+		observe(r.ctx, r.name, r.trial, "query", r.query, r.args, r.start, r.rows, r.err)
+	}
+	return lErr
+}
+
+func (r *instrumentedRows) HasNextResultSet() bool {
+	if lSets, ok := r.base.(driver.RowsNextResultSet); ok {
+		return lSets.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *instrumentedRows) NextResultSet() error {
+	if lSets, ok := r.base.(driver.RowsNextResultSet); ok {
+		return lSets.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *instrumentedRows) ColumnTypeScanType(pIndex int) reflect.Type {
+	if lTypes, ok := r.base.(driver.RowsColumnTypeScanType); ok {
+		return lTypes.ColumnTypeScanType(pIndex)
+	}
+	return reflect.TypeFor[any]()
+}
+
+func (r *instrumentedRows) ColumnTypeDatabaseTypeName(pIndex int) string {
+	if lTypes, ok := r.base.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return lTypes.ColumnTypeDatabaseTypeName(pIndex)
+	}
+	return ""
+}
+
+func (r *instrumentedRows) ColumnTypeLength(pIndex int) (int64, bool) {
+	if lTypes, ok := r.base.(driver.RowsColumnTypeLength); ok {
+		return lTypes.ColumnTypeLength(pIndex)
+	}
+	return 0, false
+}
+
+func (r *instrumentedRows) ColumnTypeNullable(pIndex int) (bool, bool) {
+	if lTypes, ok := r.base.(driver.RowsColumnTypeNullable); ok {
+		return lTypes.ColumnTypeNullable(pIndex)
+	}
+	return false, false
+}
+
+func (r *instrumentedRows) ColumnTypePrecisionScale(pIndex int) (int64, int64, bool) {
+	if lTypes, ok := r.base.(driver.RowsColumnTypePrecisionScale); ok {
+		return lTypes.ColumnTypePrecisionScale(pIndex)
+	}
+	return 0, 0, false
+}
+
+// rowsAffected reads the affected row count of a successful exec, 0 otherwise.
+func rowsAffected(pResult driver.Result, pErr error) int64 {
+	if pErr != nil || pResult == nil {
+		return 0
+	}
+	lCount, lErr := pResult.RowsAffected()
+	if lErr != nil {
+		return 0
+	}
+	return lCount
+}
+
+// namedValues converts the arguments of the pre-context driver API.
+func namedValues(pArgs []driver.Value) []driver.NamedValue {
+	lNamed := make([]driver.NamedValue, len(pArgs))
+	for i, lArg := range pArgs {
+		lNamed[i] = driver.NamedValue{Ordinal: i + 1, Value: lArg}
+	}
+	return lNamed
+}
+
+// plainValues converts arguments for drivers without the context API.
+func plainValues(pArgs []driver.NamedValue) []driver.Value {
+	lValues := make([]driver.Value, len(pArgs))
+	for i, lArg := range pArgs {
+		lValues[i] = lArg.Value
+	}
+	return lValues
+}
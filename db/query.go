@@ -0,0 +1,244 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"lumelpkg/common"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Queryer is what QueryAll and QueryOne read from: *sql.DB, *sql.Tx or *sql.Conn.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+/*
+QueryAll runs a query and scans every row into a T, matching result columns to the
+struct fields tagged `db:"<column>"` (case-insensitive, fields of embedded structs
+included). A column without a matching field is an error, so a typo in an alias fails
+loudly instead of leaving a field empty. SQL NULL leaves the field at its zero value.
+The query must already use the placeholders of its dialect, see Dialect.Rebind.
+
+Example usage:
+
+	type CategoryRevenue struct {
+		Category string  `db:"category"`
+		Revenue  float64 `db:"revenue"`
+	}
+	lRows, lErr := db.QueryAll[CategoryRevenue](lCtx, lDb, lQuery, pFromDate, pToDate)
+*/
+func QueryAll[T any](pCtx context.Context, pDb Queryer, pQuery string, pArgs ...any) ([]T, error) {
+	lRows, lErr := pDb.QueryContext(pCtx, pQuery, pArgs...)
+	if lErr != nil {
+		return nil, ContextErr(pCtx, lErr)
+	}
+	defer lRows.Close()
+
+	lColumns, lErr := lRows.Columns()
+	if lErr != nil {
+		return nil, lErr
+	}
+	lFields, lErr := columnFields(reflect.TypeFor[T](), lColumns)
+	if lErr != nil {
+		return nil, lErr
+	}
+
+	var lResult []T
+	lTargets := make([]any, len(lColumns))
+	for lRows.Next() {
+		var lRecord T
+		lValue := reflect.ValueOf(&lRecord).Elem()
+		for i, lIndex := range lFields {
+			lTargets[i] = fieldScanner{field: lValue.FieldByIndex(lIndex), column: lColumns[i]}
+		}
+		if lErr := lRows.Scan(lTargets...); lErr != nil {
+			return nil, ContextErr(pCtx, lErr)
+		}
+		lResult = append(lResult, lRecord)
+	}
+	if lErr := lRows.Err(); lErr != nil {
+		return nil, ContextErr(pCtx, lErr)
+	}
+	return lResult, nil
+}
+
+// QueryOne is QueryAll for queries expecting a single row, e.g. an aggregate.
+// It returns sql.ErrNoRows when the query yields nothing and ignores further rows.
+func QueryOne[T any](pCtx context.Context, pDb Queryer, pQuery string, pArgs ...any) (T, error) {
+	var lRecord T
+	lResult, lErr := QueryAll[T](pCtx, pDb, pQuery, pArgs...)
+	if lErr != nil {
+		return lRecord, lErr
+	}
+	if len(lResult) == 0 {
+		return lRecord, sql.ErrNoRows
+	}
+	return lResult[0], nil
+}
+
+// fieldIndexes caches the lower-cased db tag -> field index of every scanned struct type
+var fieldIndexes sync.Map
+
+// columnFields finds the field of pType every column is scanned into.
+func columnFields(pType reflect.Type, pColumns []string) ([][]int, error) {
+	if pType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("db: cannot scan into %s, a struct is required", pType)
+	}
+	lCached, ok := fieldIndexes.Load(pType)
+	if !ok {
+		lIndexes := make(map[string][]int)
+		collectFields(pType, nil, lIndexes)
+		lCached, _ = fieldIndexes.LoadOrStore(pType, lIndexes)
+	}
+	lIndexes := lCached.(map[string][]int)
+
+	lFields := make([][]int, len(pColumns))
+	var lUnmapped []string
+	for i, lColumn := range pColumns {
+		lIndex, ok := lIndexes[strings.ToLower(lColumn)]
+		if !ok {
+			lUnmapped = append(lUnmapped, lColumn)
+			continue
+		}
+		lFields[i] = lIndex
+	}
+	if len(lUnmapped) > 0 {
+		return nil, fmt.Errorf("db: columns %v have no `db` tagged field in %s", lUnmapped, pType)
+	}
+	return lFields, nil
+}
+
+// collectFields records the db tags of pType and of its embedded structs.
+// A field of the outer struct wins over an embedded field with the same tag.
+func collectFields(pType reflect.Type, pParent []int, pIndexes map[string][]int) {
+	var lEmbedded []reflect.StructField
+	for i := 0; i < pType.NumField(); i++ {
+		lField := pType.Field(i)
+		lIndex := append(append([]int{}, pParent...), i)
+		lTag := lField.Tag.Get("db")
+		switch {
+		case lTag == "-" || !lField.IsExported():
+		case lTag != "":
+			pIndexes[strings.ToLower(lTag)] = lIndex
+		case lField.Anonymous && lField.Type.Kind() == reflect.Struct:
+			lField.Index = lIndex
+			lEmbedded = append(lEmbedded, lField)
+		}
+	}
+	for _, lField := range lEmbedded {
+		lNested := make(map[string][]int)
+		collectFields(lField.Type, lField.Index, lNested)
+		for lTag, lIndex := range lNested {
+			if _, exists := pIndexes[lTag]; !exists {
+				pIndexes[lTag] = lIndex
+			}
+		}
+	}
+}
+
+// fieldScanner converts one column value into a struct field. Drivers disagree on types,
+// e.g. SUM() is a []byte on mysql and a float64 on sqlite, so plain kinds are converted
+// here and types implementing sql.Scanner decode themselves.
+type fieldScanner struct {
+	field  reflect.Value
+	column string
+}
+
+func (s fieldScanner) Scan(pSrc any) error {
+	if pSrc == nil {
+		s.field.SetZero()
+		return nil
+	}
+	if lScanner, ok := s.field.Addr().Interface().(sql.Scanner); ok {
+		return lScanner.Scan(pSrc)
+	}
+
+	if lBytes, ok := pSrc.([]byte); ok && s.field.Type() == reflect.TypeFor[[]byte]() {
+		// The driver may reuse its buffer for the next row
+		s.field.SetBytes(append([]byte(nil), lBytes...))
+		return nil
+	}
+	lSrc := reflect.ValueOf(pSrc)
+	if lSrc.Type().AssignableTo(s.field.Type()) {
+		s.field.Set(lSrc)
+		return nil
+	}
+
+	lText := asString(pSrc)
+	var lErr error
+	if s.field.Type() == reflect.TypeFor[time.Time]() {
+		// Drivers without a native date type (sqlite) return dates as text
+		var lTime time.Time
+		if lTime, lErr = parseTime(lText); lErr == nil {
+			s.field.Set(reflect.ValueOf(lTime))
+			return nil
+		}
+		return fmt.Errorf("column %s: %w", s.column, lErr)
+	}
+	switch s.field.Kind() {
+	case reflect.String:
+		s.field.SetString(lText)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var lInt int64
+		if lInt, lErr = strconv.ParseInt(lText, 10, 64); lErr == nil {
+			s.field.SetInt(lInt)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var lUint uint64
+		if lUint, lErr = strconv.ParseUint(lText, 10, 64); lErr == nil {
+			s.field.SetUint(lUint)
+		}
+	case reflect.Float32, reflect.Float64:
+		var lFloat float64
+		if lFloat, lErr = strconv.ParseFloat(lText, 64); lErr == nil {
+			s.field.SetFloat(lFloat)
+		}
+	case reflect.Bool:
+		var lBool bool
+		if lBool, lErr = strconv.ParseBool(lText); lErr == nil {
+			s.field.SetBool(lBool)
+		}
+	default:
+		lErr = fmt.Errorf("unsupported field type %s", s.field.Type())
+	}
+	if lErr != nil {
+		return fmt.Errorf("column %s: cannot convert %T to %s: %w", s.column, pSrc, s.field.Type(), lErr)
+	}
+	return nil
+}
+
+// asString renders a driver value as text, keeping decimals out of exponent notation.
+func asString(pSrc any) string {
+	switch lValue := pSrc.(type) {
+	case string:
+		return lValue
+	case []byte:
+		return string(lValue)
+	case float64:
+		return strconv.FormatFloat(lValue, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(lValue), 'f', -1, 32)
+	case time.Time:
+		return lValue.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(lValue)
+	}
+}
+
+// timeLayouts are the text forms of dates and timestamps accepted by parseTime
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02 15:04:05", common.DateLayout}
+
+// parseTime reads a date or timestamp stored as text.
+func parseTime(pText string) (time.Time, error) {
+	for _, lLayout := range timeLayouts {
+		if lTime, lErr := time.Parse(lLayout, pText); lErr == nil {
+			return lTime, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time", pText)
+}
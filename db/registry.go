@@ -0,0 +1,155 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// registeredDB is one open connection pool together with the config it was opened with.
+type registeredDB struct {
+	db      *sql.DB
+	details DatabaseType
+}
+
+var (
+	// registry holds every open database by logical name
+	registry = make(map[string]registeredDB)
+
+	// registryMu guards registry
+	registryMu sync.RWMutex
+)
+
+// GetDB returns the connection pool for a logical database name from dbconfig.toml,
+// e.g. db.GetDB(db.SQLDB). It returns an error wrapping ErrDBUnavailable when the
+// database is not connected, failed its last health check or its circuit is open
+// (a *RejectedError, see breaker.go).
+func GetDB(pName string) (*sql.DB, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	lEntry, ok := registry[pName]
+	if !ok || lEntry.db == nil {
+		return nil, fmt.Errorf("database %s is not connected: %w", pName, ErrDBUnavailable)
+	}
+	if !IsHealthy(pName) {
+		return nil, fmt.Errorf("database %s failed its health check: %w", pName, ErrDBUnavailable)
+	}
+	// Only a check here: the half-open trial is taken by the first statement, see instrument.go
+	if _, lErr := admitCircuit(pName, false); lErr != nil {
+		return nil, lErr
+	}
+	return lEntry.db, nil
+}
+
+// DatabaseNames lists the logical names of all connected databases.
+func DatabaseNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	lNames := make([]string, 0, len(registry))
+	for lName := range registry {
+		lNames = append(lNames, lName)
+	}
+	sort.Strings(lNames)
+	return lNames
+}
+
+// defaultDrainDelay is how long a replaced pool stays open when query timeouts are disabled
+const defaultDrainDelay = 30 * time.Second
+
+// registerDB stores a pool under pName. The pool it replaces, if any, is retired.
+func registerDB(pName string, pDb *sql.DB, pDetails DatabaseType) {
+	registryMu.Lock()
+	lPrevious, lExists := registry[pName]
+	registry[pName] = registeredDB{db: pDb, details: pDetails}
+	registryMu.Unlock()
+
+	if lExists && lPrevious.db != nil && lPrevious.db != pDb {
+		retireDB(lPrevious.db)
+	}
+}
+
+// replaceDB swaps the pool of pName for pDb only while pOld is still the registered one and
+// retires pOld. It reports false when a config reload replaced or removed the pool in the
+// meantime; pDb is then left to the caller.
+func replaceDB(pName string, pOld, pDb *sql.DB) bool {
+	registryMu.Lock()
+	lEntry, lExists := registry[pName]
+	if !lExists || lEntry.db != pOld {
+		registryMu.Unlock()
+		return false
+	}
+	registry[pName] = registeredDB{db: pDb, details: lEntry.details}
+	registryMu.Unlock()
+
+	retireDB(pOld)
+	return true
+}
+
+// updateDetails records reloaded settings that need no new pool (pool limits, replicas)
+// on the pool registered under pName and applies its limits. It reports false when
+// pName is not registered.
+func updateDetails(pName string, pDetails DatabaseType, pDefaultPool DBConnectionPool) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	lEntry, lExists := registry[pName]
+	if !lExists || lEntry.db == nil {
+		return false
+	}
+	lEntry.details = pDetails
+	registry[pName] = lEntry
+	ApplyConnectionPool(lEntry.db, pDetails.EffectivePool(pDefaultPool))
+	return true
+}
+
+// unregisterDB removes the pool registered under pName and retires it.
+func unregisterDB(pName string) {
+	registryMu.Lock()
+	lPrevious, lExists := registry[pName]
+	delete(registry, pName)
+	registryMu.Unlock()
+
+	if lExists && lPrevious.db != nil {
+		retireDB(lPrevious.db)
+	}
+}
+
+// retireDB closes a pool that is no longer registered once drainDelay has passed, so the
+// queries that took it from GetDB just before the swap can still finish. Meanwhile idle
+// connections are closed and connections are not kept once they are returned.
+func retireDB(pDb *sql.DB) {
+	pDb.SetMaxIdleConns(0)
+	time.AfterFunc(drainDelay(), func() { pDb.Close() })
+}
+
+// drainDelay is the longest query timeout (see QueryTimeouts), the time an in-flight query
+// may still need its pool.
+func drainDelay() time.Duration {
+	lSettings := queryTimeoutSettings.get()
+	lLongest := lSettings.DefaultMs
+	for _, lMs := range lSettings.Classes {
+		lLongest = max(lLongest, lMs)
+	}
+	if lLongest <= 0 {
+		return defaultDrainDelay
+	}
+	return time.Duration(lLongest) * time.Millisecond
+}
+
+// CloseAll closes every registered pool right away, e.g. on shutdown.
+func CloseAll() {
+	registryMu.Lock()
+	lEntries := registry
+	registry = make(map[string]registeredDB)
+	registryMu.Unlock()
+
+	for _, lEntry := range lEntries {
+		if lEntry.db != nil {
+			lEntry.db.Close()
+		}
+	}
+}
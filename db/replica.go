@@ -0,0 +1,60 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// replicaCounters keeps the round-robin position per primary
+	replicaCounters = make(map[string]*atomic.Uint64)
+
+	// replicaMu guards replicaCounters
+	replicaMu sync.Mutex
+)
+
+// Writer returns the primary pool of a logical database. Use it for every write.
+func Writer(pName string) (*sql.DB, error) {
+	return GetDB(pName)
+}
+
+// Reader returns a pool for read-only queries on a logical database. Replicas listed in its
+// Replicas setting are used round-robin, skipping those that failed their last health check
+// or whose circuit is open.
+// When no replica is configured or every replica is down, the primary is returned.
+func Reader(pName string) (*sql.DB, error) {
+	registryMu.RLock()
+	lPrimary, ok := registry[pName]
+	var lHealthy []string
+	if ok {
+		for _, lReplica := range lPrimary.details.Replicas {
+			if lEntry, ok := registry[lReplica]; ok && lEntry.db != nil && IsHealthy(lReplica) && circuitAdmits(lReplica) {
+				lHealthy = append(lHealthy, lReplica)
+			}
+		}
+	}
+	registryMu.RUnlock()
+
+	if len(lHealthy) == 0 {
+		return GetDB(pName)
+	}
+	lDb, lErr := GetDB(lHealthy[nextReplica(pName)%uint64(len(lHealthy))])
+	if lErr != nil {
+		// The replica went away or tripped since it was picked
+		return GetDB(pName)
+	}
+	return lDb, nil
+}
+
+// nextReplica advances the round-robin counter of a primary.
+func nextReplica(pName string) uint64 {
+	replicaMu.Lock()
+	lCounter, ok := replicaCounters[pName]
+	if !ok {
+		lCounter = new(atomic.Uint64)
+		replicaCounters[pName] = lCounter
+	}
+	replicaMu.Unlock()
+	return lCounter.Add(1)
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"lumelpkg/config"
+	"sync"
+	"sync/atomic"
+)
+
+// settingsCache holds a dbconfig.toml section read on every statement. It is decoded on
+// first use and again whenever a reload changes it (see config.Watch), so the statement
+// path only loads a pointer instead of decoding the config.
+type settingsCache[T any] struct {
+	key       string
+	defaults  T
+	normalise func(*T) // fixes values the defaults do not cover, may be nil
+	current   atomic.Pointer[T]
+	watchOnce sync.Once
+}
+
+// newSettingsCache prepares the cache of the section pKey, starting from pDefaults.
+func newSettingsCache[T any](pKey string, pDefaults T, pNormalise func(*T)) *settingsCache[T] {
+	return &settingsCache[T]{key: pKey, defaults: pDefaults, normalise: pNormalise}
+}
+
+// get returns the current settings.
+func (c *settingsCache[T]) get() T {
+	if lCurrent := c.current.Load(); lCurrent != nil {
+		return *lCurrent
+	}
+	c.watchOnce.Do(func() {
+		// The new value is read again through refresh, so a removed section falls back to the defaults
+		config.Watch("dbconfig", c.key, func(_, _ T) { c.refresh() })
+	})
+	return c.refresh()
+}
+
+// refresh decodes the section over the defaults and stores the result.
+func (c *settingsCache[T]) refresh() T {
+	lSettings := c.defaults
+	config.GetAndAssignTomlValue("dbconfig", c.key, &lSettings)
+	if c.normalise != nil {
+		c.normalise(&lSettings)
+	}
+	c.current.Store(&lSettings)
+	return lSettings
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// QueryClass groups queries that share a timeout, e.g. the revenue aggregations.
+type QueryClass string
+
+const (
+	// ClassAnalytics covers the read-only revenue reports
+	ClassAnalytics QueryClass = "analytics"
+	// ClassIngestion covers the CSV load writes
+	ClassIngestion QueryClass = "ingestion"
+)
+
+// QueryTimeouts is the [QueryTimeouts] section of dbconfig.toml. Classes maps a QueryClass
+// to its timeout in milliseconds; classes not listed use DefaultMs. 0 disables the timeout.
+type QueryTimeouts struct {
+	DefaultMs int            `validate:"gte=0"`
+	Classes   map[string]int `validate:"dive,gte=0"`
+}
+
+// errQueryTimeout is the cause of a context ended by its class timeout (see WithTimeout),
+// which tells a slow database apart from a client that went away
+var errQueryTimeout = errors.New("query timeout expired")
+
+// WithTimeout derives the context a query of pClass runs under: it is cancelled when
+// pCtx is (e.g. the HTTP client disconnects) or when the class timeout expires.
+//
+//	lCtx, lCancel := db.WithTimeout(pCtx, db.ClassAnalytics)
+//	defer lCancel()
+//	lRows, lErr := lDb.QueryContext(lCtx, lQuery, lArgs...)
+func WithTimeout(pCtx context.Context, pClass QueryClass) (context.Context, context.CancelFunc) {
+	lTimeout := queryTimeout(pClass)
+	if lTimeout <= 0 {
+		return context.WithCancel(pCtx)
+	}
+	return context.WithTimeoutCause(pCtx, lTimeout, errQueryTimeout)
+}
+
+// ContextErr makes a failed query report why its context ended. Drivers return their own
+// error when a statement is cancelled (pq: "canceling statement due to user request"), so
+// the context error is wrapped in as well and errors.Is(err, context.DeadlineExceeded) holds.
+func ContextErr(pCtx context.Context, pErr error) error {
+	if pErr == nil {
+		return nil
+	}
+	lCtxErr := pCtx.Err()
+	if lCtxErr == nil || errors.Is(pErr, lCtxErr) {
+		return pErr
+	}
+	return fmt.Errorf("%w: %w", lCtxErr, pErr)
+}
+
+// queryTimeoutSettings caches [QueryTimeouts], 30s for every class when not configured
+var queryTimeoutSettings = newSettingsCache("QueryTimeouts", QueryTimeouts{DefaultMs: 30000}, nil)
+
+// queryTimeout returns the timeout of a query class, falling back to DefaultMs.
+func queryTimeout(pClass QueryClass) time.Duration {
+	lSettings := queryTimeoutSettings.get()
+	if lMs, ok := lSettings.Classes[string(pClass)]; ok {
+		return time.Duration(lMs) * time.Millisecond
+	}
+	return time.Duration(lSettings.DefaultMs) * time.Millisecond
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// Execer is what write helpers take so they run on a *sql.DB or inside a *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// TxOptions controls a WithTx unit of work.
+type TxOptions struct {
+	Isolation  sql.IsolationLevel // sql.LevelDefault uses the database default
+	ReadOnly   bool
+	MaxRetries int // extra attempts after a deadlock or serialization failure, 0 for none
+}
+
+// DefaultTxOptions retries a deadlocked unit of work three times at the default isolation level.
+var DefaultTxOptions = TxOptions{MaxRetries: 3}
+
+/*
+WithTx runs pFn inside one transaction on pDb: it commits when pFn returns nil and rolls
+back when pFn returns an error or panics. When the database aborts the transaction as a
+deadlock victim or with a serialization failure, the whole unit of work is retried with a
+short backoff, up to pOpts.MaxRetries times. pFn must therefore only touch the database
+through pTx and must not have other side effects that cannot be repeated.
+
+Example usage:
+
+	lErr := db.WithTx(pCtx, lDb, db.DefaultTxOptions, func(pTx *sql.Tx) error {
+		if _, lErr := pTx.ExecContext(pCtx, lInsertOrder, lArgs...); lErr != nil {
+			return lErr
+		}
+		_, lErr := pTx.ExecContext(pCtx, lInsertItem, lItemArgs...)
+		return lErr
+	})
+*/
+func WithTx(pCtx context.Context, pDb *sql.DB, pOpts TxOptions, pFn func(pTx *sql.Tx) error) error {
+	lBackoff := 50 * time.Millisecond
+	for lAttempt := 0; ; lAttempt++ {
+		lErr := runTx(pCtx, pDb, pOpts, pFn)
+		if lErr == nil || lAttempt >= pOpts.MaxRetries || !IsRetryable(lErr) {
+			return ContextErr(pCtx, lErr)
+		}
+
+		// Wait a little, with jitter so competing transactions do not collide again
+		lWait := lBackoff/2 + rand.N(lBackoff)
+		select {
+		case <-pCtx.Done():
+			return ContextErr(pCtx, lErr)
+		case <-time.After(lWait):
+		}
+		lBackoff *= 2
+	}
+}
+
+// runTx is one attempt of WithTx.
+func runTx(pCtx context.Context, pDb *sql.DB, pOpts TxOptions, pFn func(pTx *sql.Tx) error) error {
+	lTx, lErr := pDb.BeginTx(pCtx, &sql.TxOptions{Isolation: pOpts.Isolation, ReadOnly: pOpts.ReadOnly})
+	if lErr != nil {
+		return fmt.Errorf("begin transaction: %w", lErr)
+	}
+	defer func() {
+		if lPanic := recover(); lPanic != nil {
+			lTx.Rollback()
+			panic(lPanic)
+		}
+	}()
+
+	if lErr := pFn(lTx); lErr != nil {
+		if lRollbackErr := lTx.Rollback(); lRollbackErr != nil && !errors.Is(lRollbackErr, sql.ErrTxDone) {
+			return errors.Join(lErr, fmt.Errorf("rollback: %w", lRollbackErr))
+		}
+		return lErr
+	}
+	if lErr := lTx.Commit(); lErr != nil {
+		return fmt.Errorf("commit: %w", lErr)
+	}
+	return nil
+}
+
+// IsRetryable reports whether an error means the database aborted the transaction to
+// resolve a conflict, so running it again can succeed.
+func IsRetryable(pErr error) bool {
+	var lMySQLErr *mysql.MySQLError
+	if errors.As(pErr, &lMySQLErr) {
+		// ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT
+		return lMySQLErr.Number == 1213 || lMySQLErr.Number == 1205
+	}
+	var lPqErr *pq.Error
+	if errors.As(pErr, &lPqErr) {
+		// serialization_failure, deadlock_detected
+		return lPqErr.Code == "40001" || lPqErr.Code == "40P01"
+	}
+	var lMssqlErr mssql.Error
+	if errors.As(pErr, &lMssqlErr) {
+		// Transaction was deadlocked and chosen as the victim
+		return lMssqlErr.Number == 1205
+	}
+	var lSqliteErr *sqlite.Error
+	if errors.As(pErr, &lSqliteErr) {
+		// SQLITE_BUSY, SQLITE_LOCKED (extended codes keep the primary code in the low byte)
+		lCode := lSqliteErr.Code() & 0xff
+		return lCode == 5 || lCode == 6
+	}
+	return false
+}
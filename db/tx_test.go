@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// errDeadlock is what MySQL returns to the victim of a deadlock
+var errDeadlock = &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+func TestWithTxRollback(t *testing.T) {
+	errFailed := errors.New("insert item failed")
+	tests := []struct {
+		name     string
+		fn       func(*sql.Tx) error
+		wantErr  error
+		wantRows int
+	}{
+		{"commit", func(*sql.Tx) error { return nil }, nil, 2},
+		{"error", func(*sql.Tx) error { return errFailed }, errFailed, 0},
+		{"panic", func(*sql.Tx) error { panic(errFailed) }, errFailed, 0},
+	}
+	for _, tt := range tests {
+		lDb := openTestTxDB(t)
+		lErr := func() (lErr error) {
+			defer func() {
+				if lPanic := recover(); lPanic != nil {
+					lErr = lPanic.(error)
+				}
+			}()
+			return WithTx(context.Background(), lDb, DefaultTxOptions, func(pTx *sql.Tx) error {
+				for _, lValue := range []int{1, 2} {
+					if _, lErr := pTx.Exec(`INSERT INTO t (v) VALUES (?)`, lValue); lErr != nil {
+						return lErr
+					}
+				}
+				return tt.fn(pTx)
+			})
+		}()
+		if !errors.Is(lErr, tt.wantErr) {
+			t.Errorf("%s: WithTx() = %v, want %v", tt.name, lErr, tt.wantErr)
+		}
+		if lRows := countTestRows(t, lDb); lRows != tt.wantRows {
+			t.Errorf("%s: %d rows after WithTx, want %d", tt.name, lRows, tt.wantRows)
+		}
+	}
+}
+
+func TestWithTxRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRetries   int
+		failures     int   // attempts that fail before one succeeds
+		err          error // what the failing attempts return
+		wantAttempts int
+		wantRows     int
+	}{
+		{"no failure", 3, 0, errDeadlock, 1, 1},
+		{"deadlock retried", 3, 2, errDeadlock, 3, 1},
+		{"wrapped deadlock retried", 3, 1, fmt.Errorf("insert order: %w", errDeadlock), 2, 1},
+		{"retries exhausted", 2, 5, errDeadlock, 3, 0},
+		{"retries disabled", 0, 1, errDeadlock, 1, 0},
+		{"not retryable", 3, 1, errors.New("UNIQUE constraint failed"), 1, 0},
+	}
+	for _, tt := range tests {
+		lDb := openTestTxDB(t)
+		lAttempts := 0
+		lErr := WithTx(context.Background(), lDb, TxOptions{MaxRetries: tt.maxRetries}, func(pTx *sql.Tx) error {
+			lAttempts++
+			// Every attempt writes, only the committed one may remain
+			if _, lErr := pTx.Exec(`INSERT INTO t (v) VALUES (?)`, lAttempts); lErr != nil {
+				return lErr
+			}
+			if lAttempts <= tt.failures {
+				return tt.err
+			}
+			return nil
+		})
+		if lWantErr := tt.wantRows == 0; (lErr != nil) != lWantErr || (lWantErr && !errors.Is(lErr, tt.err)) {
+			t.Errorf("%s: WithTx() = %v", tt.name, lErr)
+		}
+		if lAttempts != tt.wantAttempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, lAttempts, tt.wantAttempts)
+		}
+		if lRows := countTestRows(t, lDb); lRows != tt.wantRows {
+			t.Errorf("%s: %d rows after WithTx, want %d", tt.name, lRows, tt.wantRows)
+		}
+	}
+}
+
+func TestWithTxStopsRetryingOnCancel(t *testing.T) {
+	lDb := openTestTxDB(t)
+	lCtx, lCancel := context.WithCancel(context.Background())
+	lAttempts := 0
+	lErr := WithTx(lCtx, lDb, TxOptions{MaxRetries: 5}, func(*sql.Tx) error {
+		lAttempts++
+		lCancel()
+		return errDeadlock
+	})
+	if !errors.Is(lErr, context.Canceled) || lAttempts != 1 {
+		t.Errorf("WithTx() = %v after %d attempts, want context.Canceled after 1", lErr, lAttempts)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errDeadlock, true},
+		{&mysql.MySQLError{Number: 1205}, true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{&pq.Error{Code: "40001"}, true},
+		{&pq.Error{Code: "40P01"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{mssql.Error{Number: 1205}, true},
+		{mssql.Error{Number: 2627}, false},
+		{fmt.Errorf("commit: %w", &pq.Error{Code: "40001"}), true},
+		{errors.New("deadlock"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// openTestTxDB opens an empty SQLite database file with one table t (v INTEGER).
+func openTestTxDB(t *testing.T) *sql.DB {
+	t.Helper()
+	lDb, lErr := sql.Open("sqlite", filepath.Join(t.TempDir(), "tx.db"))
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	t.Cleanup(func() { lDb.Close() })
+	if _, lErr := lDb.Exec(`CREATE TABLE t (v INTEGER)`); lErr != nil {
+		t.Fatal(lErr)
+	}
+	return lDb
+}
+
+// countTestRows counts the rows of table t.
+func countTestRows(t *testing.T, pDb *sql.DB) int {
+	t.Helper()
+	var lCount int
+	if lErr := pDb.QueryRow(`SELECT COUNT(*) FROM t`).Scan(&lCount); lErr != nil {
+		t.Fatal(lErr)
+	}
+	return lCount
+}
@@ -0,0 +1,16 @@
+// Package dbfile holds the versioned schema migrations of the order management database.
+//
+// Every DBType has its own folder with numbered pairs of files:
+//
+//	<dbtype>/0001_create_order_tables.up.sql
+//	<dbtype>/0001_create_order_tables.down.sql
+//
+// The files are embedded in the binary and applied by the migrations package.
+package dbfile
+
+import "embed"
+
+// Migrations contains every <dbtype>/<version>_<name>.<up|down>.sql file
+//
+//go:embed */*.sql
+var Migrations embed.FS
@@ -0,0 +1,33 @@
+CREATE TABLE customers (
+    customer_id VARCHAR(50) PRIMARY KEY,
+    name NVARCHAR(255),
+    email NVARCHAR(255),
+    address NVARCHAR(MAX)
+);
+
+CREATE TABLE products (
+    product_id VARCHAR(50) PRIMARY KEY,
+    name NVARCHAR(255),
+    category NVARCHAR(100)
+);
+
+CREATE TABLE orders (
+    order_id VARCHAR(50) PRIMARY KEY,
+    customer_id VARCHAR(50) NOT NULL,
+    region NVARCHAR(100),
+    date_of_sale DATE,
+    payment_method VARCHAR(50),
+    shipping_cost DECIMAL(12, 2),
+    FOREIGN KEY (customer_id) REFERENCES customers (customer_id)
+);
+
+CREATE TABLE order_items (
+    order_id VARCHAR(50) NOT NULL,
+    product_id VARCHAR(50) NOT NULL,
+    quantity_sold INT,
+    unit_price DECIMAL(12, 2),
+    discount DECIMAL(5, 4),
+    PRIMARY KEY (order_id, product_id),
+    FOREIGN KEY (order_id) REFERENCES orders (order_id),
+    FOREIGN KEY (product_id) REFERENCES products (product_id)
+);
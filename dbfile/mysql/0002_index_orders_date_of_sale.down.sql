@@ -0,0 +1 @@
+DROP INDEX idx_orders_date_of_sale ON orders;
@@ -0,0 +1,33 @@
+CREATE TABLE customers (
+    customer_id VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(255),
+    email VARCHAR(255),
+    address TEXT
+);
+
+CREATE TABLE products (
+    product_id VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(255),
+    category VARCHAR(100)
+);
+
+CREATE TABLE orders (
+    order_id VARCHAR(50) PRIMARY KEY,
+    customer_id VARCHAR(50) NOT NULL,
+    region VARCHAR(100),
+    date_of_sale DATE,
+    payment_method VARCHAR(50),
+    shipping_cost NUMERIC(12, 2),
+    FOREIGN KEY (customer_id) REFERENCES customers (customer_id)
+);
+
+CREATE TABLE order_items (
+    order_id VARCHAR(50) NOT NULL,
+    product_id VARCHAR(50) NOT NULL,
+    quantity_sold INTEGER,
+    unit_price NUMERIC(12, 2),
+    discount NUMERIC(5, 4),
+    PRIMARY KEY (order_id, product_id),
+    FOREIGN KEY (order_id) REFERENCES orders (order_id),
+    FOREIGN KEY (product_id) REFERENCES products (product_id)
+);
@@ -0,0 +1 @@
+CREATE INDEX idx_orders_date_of_sale ON orders (date_of_sale);
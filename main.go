@@ -5,31 +5,72 @@ import (
 	"lumelpkg/apps/appscommon"
 	scheduler "lumelpkg/apps/orderManagement/Scheduler"
 	"lumelpkg/apps/orderManagement/api"
+	"lumelpkg/common"
 	"lumelpkg/config"
 	"lumelpkg/db"
+	"lumelpkg/migrations"
 	"lumelpkg/utils"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// logFlushTimeout bounds how long an exiting process waits for queued log entries
+const logFlushTimeout = 5 * time.Second
+
 func main() {
+	// Sub-commands run instead of the server
+	if len(os.Args) > 1 {
+		lCode := runCommand(os.Args[1:])
+		utils.CloseLogs(logFlushTimeout)
+		os.Exit(lCode)
+	}
+
 	// Initialize the logger for app-wide logging
 	utils.InitLogger()
 	logger := &utils.Logger{}
 	logger.SetReqID()
 
-	// Load all toml data in a global variable
+	// Load all toml data in a global variable, validated against the registered schemas
+	registerConfigSchemas()
 	config.Init(logger)
 
-	// Load all global DB instance
-	db.GlobalDBInit(logger)
+	// Apply the configured log sinks, levels, rotation and redaction now and on every reload
+	var lLogSettings utils.LogSettings
+	if lErr := config.GetAndAssignTomlValue("appconfig", "Logger", &lLogSettings); lErr == nil {
+		utils.ApplyLogSettings(lLogSettings)
+	}
+	config.Watch("appconfig", "Logger", func(_, pNew utils.LogSettings) {
+		utils.ApplyLogSettings(pNew)
+	})
+
+	// Reload the toml folder whenever a file changes
+	go config.WatchConfigFolder(logger)
 
-	// Load CSV File Data
-	scheduler.SchedularInit()
+	// Connect all databases, exiting when a primary stays unreachable
+	if lErr := db.GlobalDBInit(logger); lErr != nil {
+		logger.Log(common.ERROR, "main", "Database startup failed: "+lErr.Error())
+		fmt.Println("Database startup failed:", lErr)
+		utils.CloseLogs(logFlushTimeout)
+		os.Exit(1)
+	}
 
-	// Set up the router
+	// Apply or check schema migrations, refusing to serve on an outdated schema
+	if lErr := migrations.Startup(logger); lErr != nil {
+		logger.Log(common.ERROR, "main", "Schema migration check failed: "+lErr.Error())
+		fmt.Println("Schema migration check failed:", lErr)
+		utils.CloseLogs(logFlushTimeout)
+		os.Exit(1)
+	}
+
+	// Load CSV File Data on its own ticker so the server can start
+	go scheduler.SchedularInit()
+
+	// Set up the router; every request gets its logger and X-Request-ID first
 	router := mux.NewRouter()
+	router.Use(appscommon.RequestLogger)
 
 	// Define the /ready route (GET method)
 	router.HandleFunc("/ready", appscommon.Ready).Methods(http.MethodGet)
@@ -38,7 +79,17 @@ func main() {
 	router.HandleFunc("/orders/categrevenue", api.FetchCategoryRevenue).Methods(http.MethodPost)
 	router.HandleFunc("/orders/regionrevenue", api.FetchRegionRevenue).Methods(http.MethodPost)
 
+	// Admin routes, guarded by the admin token
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(appscommon.AdminOnly)
+	adminRouter.HandleFunc("/resettoml", appscommon.ResetToml).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/config", appscommon.InspectConfig).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/dbstats", appscommon.DatabaseStats).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/logs", appscommon.SearchLogs).Methods(http.MethodGet)
+
 	// Start the server
 	fmt.Println("Server started at http://localhost:8080")
-	http.ListenAndServe(":26301", router)
+	lErr := http.ListenAndServe(":26301", router)
+	logger.Log(common.ERROR, "main", "Server stopped: "+lErr.Error())
+	utils.CloseLogs(logFlushTimeout)
 }
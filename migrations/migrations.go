@@ -0,0 +1,130 @@
+package migrations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"lumelpkg/config"
+	"lumelpkg/dbfile"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Settings is the [Migrations] section of dbconfig.toml
+type Settings struct {
+	Database     string `validate:"required"` // logical database the order tables live in
+	ApplyOnStart bool   // apply pending migrations on start instead of refusing to start
+}
+
+// RegisterConfigSchemas declares the dbconfig.toml sections owned by the migrations package.
+func RegisterConfigSchemas() {
+	config.RegisterSchema[Settings]("dbconfig", "Migrations")
+}
+
+// Migration is one numbered schema change with its up and down SQL.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of Up, recorded when applied to notice later edits
+}
+
+// fileName matches <version>_<name>.<up|down>.sql, e.g. 0001_create_order_tables.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the migrations of one DBType from dbfile/<dbtype>, ordered by version.
+// Every version needs both an up and a down file.
+func Load(pDBType string) ([]Migration, error) {
+	lEntries, lErr := fs.ReadDir(dbfile.Migrations, pDBType)
+	if lErr != nil {
+		return nil, fmt.Errorf("no migrations for DB type %s: %w", pDBType, lErr)
+	}
+
+	lByVersion := make(map[int]*Migration)
+	for _, lEntry := range lEntries {
+		lMatch := fileName.FindStringSubmatch(lEntry.Name())
+		if lEntry.IsDir() || lMatch == nil {
+			continue
+		}
+		lVersion, _ := strconv.Atoi(lMatch[1])
+		lContent, lErr := fs.ReadFile(dbfile.Migrations, path.Join(pDBType, lEntry.Name()))
+		if lErr != nil {
+			return nil, lErr
+		}
+
+		lMigration, ok := lByVersion[lVersion]
+		if !ok {
+			lMigration = &Migration{Version: lVersion, Name: lMatch[2]}
+			lByVersion[lVersion] = lMigration
+		}
+		if lMigration.Name != lMatch[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", lVersion, lMigration.Name, lMatch[2])
+		}
+		if lMatch[3] == "up" {
+			lMigration.Up = string(lContent)
+		} else {
+			lMigration.Down = string(lContent)
+		}
+	}
+
+	lMigrations := make([]Migration, 0, len(lByVersion))
+	for _, lMigration := range lByVersion {
+		if strings.TrimSpace(lMigration.Up) == "" || strings.TrimSpace(lMigration.Down) == "" {
+			return nil, fmt.Errorf("migration %s/%04d_%s needs both an up and a down file", pDBType, lMigration.Version, lMigration.Name)
+		}
+		lMigration.Checksum = checksum(lMigration.Up)
+		lMigrations = append(lMigrations, *lMigration)
+	}
+	sort.Slice(lMigrations, func(i, j int) bool { return lMigrations[i].Version < lMigrations[j].Version })
+	return lMigrations, nil
+}
+
+// checksum is the hex SHA-256 of an up file.
+func checksum(pSQL string) string {
+	lSum := sha256.Sum256([]byte(pSQL))
+	return hex.EncodeToString(lSum[:])
+}
+
+// splitStatements cuts a migration file into single statements on `;`, ignoring
+// semicolons inside quotes and `--` comments. Drivers such as mysql reject several
+// statements in one Exec.
+func splitStatements(pSQL string) []string {
+	var lStatements []string
+	var lCurrent strings.Builder
+	var lQuote byte
+
+	for i := 0; i < len(pSQL); i++ {
+		lChar := pSQL[i]
+		switch {
+		case lQuote != 0:
+			if lChar == lQuote {
+				lQuote = 0
+			}
+		case lChar == '\'' || lChar == '"' || lChar == '`':
+			lQuote = lChar
+		case lChar == '-' && i+1 < len(pSQL) && pSQL[i+1] == '-':
+			// Skip the comment up to the end of the line
+			for i < len(pSQL) && pSQL[i] != '\n' {
+				i++
+			}
+			lCurrent.WriteByte('\n')
+			continue
+		case lChar == ';':
+			if lStatement := strings.TrimSpace(lCurrent.String()); lStatement != "" {
+				lStatements = append(lStatements, lStatement)
+			}
+			lCurrent.Reset()
+			continue
+		}
+		lCurrent.WriteByte(lChar)
+	}
+	if lStatement := strings.TrimSpace(lCurrent.String()); lStatement != "" {
+		lStatements = append(lStatements, lStatement)
+	}
+	return lStatements
+}
@@ -0,0 +1,301 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"lumelpkg/common"
+	"lumelpkg/config"
+	"lumelpkg/db"
+	"lumelpkg/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrSchemaBehind is returned when migrations exist that the live database has not applied.
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// ErrChecksumMismatch is returned when the up file of an applied migration was edited afterwards.
+var ErrChecksumMismatch = errors.New("applied migration changed")
+
+// createTable creates schema_migrations per DBType; createTableDefault serves the rest
+var (
+	createTable = map[string]string{
+		"mssql": `IF OBJECT_ID('schema_migrations', 'U') IS NULL
+			CREATE TABLE schema_migrations (version BIGINT PRIMARY KEY, name NVARCHAR(255) NOT NULL, checksum CHAR(64), applied_at DATETIME2 NOT NULL)`,
+		"mysql": `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, checksum CHAR(64), applied_at DATETIME NOT NULL)`,
+	}
+	createTableDefault = `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, checksum CHAR(64), applied_at TIMESTAMP NOT NULL)`
+)
+
+// Status compares the migration files with the versions recorded in schema_migrations.
+type Status struct {
+	Current int         // highest applied version, 0 for an empty database
+	Applied []int       // every recorded version
+	Pending []Migration // files not yet applied, in version order
+	Unknown []int       // recorded versions without a file, e.g. from a newer binary
+	Changed []Migration // applied migrations whose up file no longer matches the recorded checksum
+}
+
+// checkChanged returns an error wrapping ErrChecksumMismatch when an applied migration was edited.
+func (s Status) checkChanged() error {
+	if len(s.Changed) == 0 {
+		return nil
+	}
+	lNames := make([]string, len(s.Changed))
+	for i, lMigration := range s.Changed {
+		lNames[i] = fmt.Sprintf("%04d_%s", lMigration.Version, lMigration.Name)
+	}
+	return fmt.Errorf("%w: %s differ from the applied version, add a new migration instead",
+		ErrChecksumMismatch, strings.Join(lNames, ", "))
+}
+
+// Migrator applies the migrations of one DBType to one database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    db.Dialect
+	migrations []Migration
+}
+
+// New loads the migrations matching the dialect of pDb.
+func New(pDb *sql.DB, pDialect db.Dialect) (*Migrator, error) {
+	lMigrations, lErr := Load(pDialect.Name())
+	if lErr != nil {
+		return nil, lErr
+	}
+	return &Migrator{db: pDb, dialect: pDialect, migrations: lMigrations}, nil
+}
+
+// ensureTable creates schema_migrations when it does not exist yet.
+func (m *Migrator) ensureTable(pCtx context.Context) error {
+	lQuery, ok := createTable[m.dialect.Name()]
+	if !ok {
+		lQuery = createTableDefault
+	}
+	if _, lErr := m.db.ExecContext(pCtx, lQuery); lErr != nil {
+		return fmt.Errorf("creating schema_migrations: %w", lErr)
+	}
+	return nil
+}
+
+// Status reads schema_migrations and reports what is applied and pending.
+func (m *Migrator) Status(pCtx context.Context) (Status, error) {
+	var lStatus Status
+	if lErr := m.ensureTable(pCtx); lErr != nil {
+		return lStatus, lErr
+	}
+
+	lRows, lErr := m.db.QueryContext(pCtx, `SELECT version, checksum FROM schema_migrations`)
+	if lErr != nil {
+		return lStatus, fmt.Errorf("reading schema_migrations: %w", lErr)
+	}
+	defer lRows.Close()
+
+	lApplied := make(map[int]sql.NullString)
+	for lRows.Next() {
+		var lVersion int
+		var lChecksum sql.NullString
+		if lErr := lRows.Scan(&lVersion, &lChecksum); lErr != nil {
+			return lStatus, fmt.Errorf("reading schema_migrations: %w", lErr)
+		}
+		lApplied[lVersion] = lChecksum
+		lStatus.Applied = append(lStatus.Applied, lVersion)
+		lStatus.Current = max(lStatus.Current, lVersion)
+	}
+	if lErr := lRows.Err(); lErr != nil {
+		return lStatus, fmt.Errorf("reading schema_migrations: %w", lErr)
+	}
+	sort.Ints(lStatus.Applied)
+
+	lKnown := make(map[int]bool)
+	for _, lMigration := range m.migrations {
+		lKnown[lMigration.Version] = true
+		lChecksum, ok := lApplied[lMigration.Version]
+		switch {
+		case !ok:
+			lStatus.Pending = append(lStatus.Pending, lMigration)
+		case lChecksum.Valid && lChecksum.String != lMigration.Checksum:
+			lStatus.Changed = append(lStatus.Changed, lMigration)
+		}
+	}
+	for _, lVersion := range lStatus.Applied {
+		if !lKnown[lVersion] {
+			lStatus.Unknown = append(lStatus.Unknown, lVersion)
+		}
+	}
+	return lStatus, nil
+}
+
+// Up applies every pending migration up to and including pTarget (0 for all) and returns
+// how many were applied. Each migration runs in its own transaction together with its
+// schema_migrations row; drivers that auto-commit DDL (mysql) still stop at the first failure.
+// Nothing is applied while an applied migration was edited.
+func (m *Migrator) Up(pCtx context.Context, log *utils.Logger, pTarget int) (int, error) {
+	lStatus, lErr := m.Status(pCtx)
+	if lErr != nil {
+		return 0, lErr
+	}
+	if lErr := lStatus.checkChanged(); lErr != nil {
+		return 0, lErr
+	}
+
+	lCount := 0
+	for _, lMigration := range lStatus.Pending {
+		if pTarget > 0 && lMigration.Version > pTarget {
+			break
+		}
+		log.Log(common.INFO, "Migrate", fmt.Sprintf("Applying %04d_%s", lMigration.Version, lMigration.Name))
+		lErr := m.apply(pCtx, lMigration.Up, func(pTx *sql.Tx) error {
+			return m.record(pCtx, pTx, lMigration)
+		})
+		if lErr != nil {
+			return lCount, fmt.Errorf("migration %04d_%s: %w", lMigration.Version, lMigration.Name, lErr)
+		}
+		lCount++
+	}
+	return lCount, nil
+}
+
+// Baseline records every pending migration up to and including pVersion as applied without
+// running it, for a database whose tables were created before migrations existed, and
+// returns how many were recorded.
+func (m *Migrator) Baseline(pCtx context.Context, log *utils.Logger, pVersion int) (int, error) {
+	if pVersion <= 0 {
+		return 0, errors.New("baseline needs the version the existing schema matches")
+	}
+	lStatus, lErr := m.Status(pCtx)
+	if lErr != nil {
+		return 0, lErr
+	}
+
+	lCount := 0
+	lErr = m.apply(pCtx, "", func(pTx *sql.Tx) error {
+		for _, lMigration := range lStatus.Pending {
+			if lMigration.Version > pVersion {
+				break
+			}
+			log.Log(common.INFO, "Migrate", fmt.Sprintf("Recording %04d_%s as applied", lMigration.Version, lMigration.Name))
+			if lErr := m.record(pCtx, pTx, lMigration); lErr != nil {
+				return fmt.Errorf("recording %04d_%s: %w", lMigration.Version, lMigration.Name, lErr)
+			}
+			lCount++
+		}
+		return nil
+	})
+	if lErr != nil {
+		return 0, lErr
+	}
+	return lCount, nil
+}
+
+// record inserts the schema_migrations row of pMigration.
+func (m *Migrator) record(pCtx context.Context, pTx *sql.Tx, pMigration Migration) error {
+	_, lErr := pTx.ExecContext(pCtx,
+		m.dialect.Rebind(`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`),
+		pMigration.Version, pMigration.Name, pMigration.Checksum, time.Now().UTC())
+	return lErr
+}
+
+// Down reverts the pSteps most recently applied migrations, newest first.
+func (m *Migrator) Down(pCtx context.Context, log *utils.Logger, pSteps int) (int, error) {
+	lStatus, lErr := m.Status(pCtx)
+	if lErr != nil {
+		return 0, lErr
+	}
+	if len(lStatus.Unknown) > 0 {
+		return 0, fmt.Errorf("cannot revert, versions %v have no migration files", lStatus.Unknown)
+	}
+
+	lByVersion := make(map[int]Migration, len(m.migrations))
+	for _, lMigration := range m.migrations {
+		lByVersion[lMigration.Version] = lMigration
+	}
+
+	lCount := 0
+	for i := len(lStatus.Applied) - 1; i >= 0 && lCount < pSteps; i-- {
+		lMigration := lByVersion[lStatus.Applied[i]]
+		log.Log(common.INFO, "Migrate", fmt.Sprintf("Reverting %04d_%s", lMigration.Version, lMigration.Name))
+		lErr := m.apply(pCtx, lMigration.Down, func(pTx *sql.Tx) error {
+			_, lErr := pTx.ExecContext(pCtx, m.dialect.Rebind(`DELETE FROM schema_migrations WHERE version = ?`), lMigration.Version)
+			return lErr
+		})
+		if lErr != nil {
+			return lCount, fmt.Errorf("reverting %04d_%s: %w", lMigration.Version, lMigration.Name, lErr)
+		}
+		lCount++
+	}
+	return lCount, nil
+}
+
+// apply runs the statements of one migration file and pRecord in a single transaction.
+func (m *Migrator) apply(pCtx context.Context, pSQL string, pRecord func(*sql.Tx) error) error {
+	lTx, lErr := m.db.BeginTx(pCtx, nil)
+	if lErr != nil {
+		return lErr
+	}
+	defer lTx.Rollback()
+
+	for _, lStatement := range splitStatements(pSQL) {
+		if _, lErr := lTx.ExecContext(pCtx, lStatement); lErr != nil {
+			return lErr
+		}
+	}
+	if lErr := pRecord(lTx); lErr != nil {
+		return lErr
+	}
+	return lTx.Commit()
+}
+
+// Startup brings the database named in [Migrations] up to date when ApplyOnStart is set,
+// and otherwise returns an error wrapping ErrSchemaBehind if any migration is pending.
+// It runs after db.GlobalDBInit.
+func Startup(log *utils.Logger) error {
+	log.Log(common.INFO, "Migrations Startup (+)")
+
+	var lSettings Settings
+	if lErr := config.GetAndAssignTomlValue("dbconfig", "Migrations", &lSettings); lErr != nil {
+		return fmt.Errorf("reading Migrations settings: %w", lErr)
+	}
+	lDb, lErr := db.Writer(lSettings.Database)
+	if lErr != nil {
+		return lErr
+	}
+	lDialect, lErr := db.DialectOf(lSettings.Database)
+	if lErr != nil {
+		return lErr
+	}
+	lMigrator, lErr := New(lDb, lDialect)
+	if lErr != nil {
+		return lErr
+	}
+
+	lCtx := utils.WithLogger(context.Background(), log)
+	if lSettings.ApplyOnStart {
+		lCount, lErr := lMigrator.Up(lCtx, log, 0)
+		if lErr != nil {
+			return lErr
+		}
+		log.Log(common.INFO, "Migrations Startup", fmt.Sprintf("%d migrations applied", lCount))
+	}
+
+	lStatus, lErr := lMigrator.Status(lCtx)
+	if lErr != nil {
+		return lErr
+	}
+	if len(lStatus.Unknown) > 0 {
+		log.Log(common.ERROR, "Migrations Startup", fmt.Sprintf("Database has versions %v unknown to this build", lStatus.Unknown))
+	}
+	if lErr := lStatus.checkChanged(); lErr != nil {
+		return lErr
+	}
+	if len(lStatus.Pending) > 0 {
+		return fmt.Errorf("%w: %s is at version %d, %d migrations pending "+
+			"(run `migrate up`, or `migrate baseline <version>` if the tables already exist)",
+			ErrSchemaBehind, lSettings.Database, lStatus.Current, len(lStatus.Pending))
+	}
+
+	log.Log(common.INFO, "Migrations Startup (-)", fmt.Sprintf("schema at version %d", lStatus.Current))
+	return nil
+}
@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"lumelpkg/db"
+	"lumelpkg/utils"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUpAndDown(t *testing.T) {
+	lMigrator, log := newTestMigrator(t)
+	lCtx := context.Background()
+
+	if lCount, lErr := lMigrator.Up(lCtx, log, 1); lErr != nil || lCount != 1 {
+		t.Fatalf("Up(1) = %d, %v", lCount, lErr)
+	}
+	if lCount, lErr := lMigrator.Up(lCtx, log, 0); lErr != nil || lCount != len(lMigrator.migrations)-1 {
+		t.Fatalf("Up(0) = %d, %v", lCount, lErr)
+	}
+	lStatus := testStatus(t, lMigrator)
+	if lStatus.Current != 2 || len(lStatus.Pending) != 0 {
+		t.Errorf("after up: current %d, pending %d", lStatus.Current, len(lStatus.Pending))
+	}
+
+	if lCount, lErr := lMigrator.Down(lCtx, log, 1); lErr != nil || lCount != 1 {
+		t.Fatalf("Down(1) = %d, %v", lCount, lErr)
+	}
+	if lStatus := testStatus(t, lMigrator); lStatus.Current != 1 || !reflect.DeepEqual(lStatus.Applied, []int{1}) {
+		t.Errorf("after down: current %d, applied %v", lStatus.Current, lStatus.Applied)
+	}
+}
+
+func TestBaselineAdoptsExistingTables(t *testing.T) {
+	lMigrator, log := newTestMigrator(t)
+	lCtx := context.Background()
+
+	// The order tables exist already, created before migrations
+	for _, lStatement := range splitStatements(lMigrator.migrations[0].Up) {
+		if _, lErr := lMigrator.db.ExecContext(lCtx, lStatement); lErr != nil {
+			t.Fatal(lErr)
+		}
+	}
+	if _, lErr := lMigrator.Up(lCtx, log, 0); lErr == nil {
+		t.Fatal("Up() over existing tables succeeded")
+	}
+
+	if _, lErr := lMigrator.Baseline(lCtx, log, 0); lErr == nil {
+		t.Error("Baseline(0) succeeded")
+	}
+	if lCount, lErr := lMigrator.Baseline(lCtx, log, 1); lErr != nil || lCount != 1 {
+		t.Fatalf("Baseline(1) = %d, %v", lCount, lErr)
+	}
+	if lCount, lErr := lMigrator.Up(lCtx, log, 0); lErr != nil || lCount != 1 {
+		t.Fatalf("Up() after baseline = %d, %v", lCount, lErr)
+	}
+	if lStatus := testStatus(t, lMigrator); lStatus.Current != 2 || len(lStatus.Pending) != 0 {
+		t.Errorf("after baseline and up: current %d, pending %d", lStatus.Current, len(lStatus.Pending))
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		edit        func(*Migration)
+		wantChanged []int
+	}{
+		{"unchanged", func(*Migration) {}, nil},
+		{"up file edited", func(pMigration *Migration) { pMigration.Up += "\n-- tweak" }, []int{1}},
+		{"down file edited", func(pMigration *Migration) { pMigration.Down += "\n-- tweak" }, nil},
+	}
+	for _, tt := range tests {
+		lMigrator, log := newTestMigrator(t)
+		lCtx := context.Background()
+		if _, lErr := lMigrator.Up(lCtx, log, 1); lErr != nil {
+			t.Fatal(lErr)
+		}
+
+		// A later build ships the edited file
+		lEdited, lErr := Load("sqlite")
+		if lErr != nil {
+			t.Fatal(lErr)
+		}
+		tt.edit(&lEdited[0])
+		lEdited[0].Checksum = checksum(lEdited[0].Up)
+		lMigrator.migrations = lEdited
+
+		lStatus := testStatus(t, lMigrator)
+		var lChanged []int
+		for _, lMigration := range lStatus.Changed {
+			lChanged = append(lChanged, lMigration.Version)
+		}
+		if !reflect.DeepEqual(lChanged, tt.wantChanged) {
+			t.Errorf("%s: changed = %v, want %v", tt.name, lChanged, tt.wantChanged)
+		}
+
+		lCount, lErr := lMigrator.Up(lCtx, log, 0)
+		if lWantErr := tt.wantChanged != nil; errors.Is(lErr, ErrChecksumMismatch) != lWantErr {
+			t.Errorf("%s: Up() = %d, %v, want mismatch %v", tt.name, lCount, lErr, lWantErr)
+		}
+		if tt.wantChanged != nil && lCount != 0 {
+			t.Errorf("%s: Up() applied %d migrations despite the mismatch", tt.name, lCount)
+		}
+	}
+}
+
+// newTestMigrator returns a migrator for the sqlite migrations on an empty database file.
+func newTestMigrator(t *testing.T) (*Migrator, *utils.Logger) {
+	t.Helper()
+	lDb, lErr := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	t.Cleanup(func() { lDb.Close() })
+	lDialect, lErr := db.DialectFor("sqlite")
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	lMigrator, lErr := New(lDb, lDialect)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	return lMigrator, new(utils.Logger)
+}
+
+// testStatus returns the migration status or fails the test.
+func testStatus(t *testing.T, pMigrator *Migrator) Status {
+	t.Helper()
+	lStatus, lErr := pMigrator.Status(context.Background())
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	return lStatus
+}
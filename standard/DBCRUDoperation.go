@@ -1,89 +1,118 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"lumelpkg/common"
+	"lumelpkg/db"
 )
 
+// RecordStruct is a sample row: every selected column needs a field with the matching `db` tag.
+type RecordStruct struct {
+	Id   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+}
+
 // Step-by-step comments for SelectRecordsMethod:
 // Step 1: Log the start of the function to track its execution.
-// Step 2: Establish a connection to the database using a predefined connection key.
-// Step 3: If the connection fails, log the error and return it with a specific error code.
-// Step 4: Ensure the database connection is closed when the function exits to avoid leaks.
-// Step 5: Prepare an SQL query to select records from the database.
-// Step 6: If preparing the SQL statement fails, log the error and return it.
-// Step 7: Ensure the prepared statement is closed after its use to free resources.
-// Step 8: Execute the prepared SQL query with the given parameter.
-// Step 9: If the query execution fails, log the error and return it.
-// Step 10: Ensure the result set is closed after its use to free resources.
-// Step 11: Process the result set by iterating over it.
-// Step 12: For each row, scan the result into a variable and handle any scanning errors.
-// Step 13: Log the end of the function.
-// Step 14: Return the result and any error encountered.
+// Step 2: Get the read pool of the logical database from the registry (replicas first).
+// Step 3: If the database is unavailable, log the error and return it with a specific error code.
+// Step 4: Get the SQL dialect of the database to convert the `?` placeholders.
+// Step 5: Derive the query context from the caller's context with the timeout of the query class.
+// Step 6: Run the query with db.QueryAll, which scans every row into RecordStruct by its `db` tags.
+// Step 7: If the query or the scan fails, log the error and return it with a specific error code.
+// Step 8: Log the end of the function.
+// Step 9: Return the result and any error encountered.
 
 // This method is used to fetch data for this purpose from this table.
-func SelectRecordsMethod(pParameterName string) (lVariable string, lErr error) {
+func SelectRecordsMethod(pCtx context.Context, pParameterName string) (lRecords []RecordStruct, lErr error) {
 	// Log the start of the SelectRecordsMethod function
 	log.Println("SelectRecordsMethod (+)")
 
-	// Connect to the database using a connection key
-	lDb, lErr := DBConnection()
+	// Get the read pool of the logical database
+	lDb, lErr := db.Reader(db.SQLDB)
 	if lErr != nil {
-		// Log an error message if the database connection fails
+		// Log an error message if the database is unavailable
 		log.Println("ASRM:001", lErr.Error())
-		// Return the local variable and an error with a specific code and the error message
-		return lVariable, fmt.Errorf("SelectRecordsMethod - (ASRM-001) " + lErr.Error())
-	} else {
-		// Ensure the database connection is closed when the function exits
-		defer lDb.Close()
+		// Return the records and an error with a specific code, keeping the cause for errors.Is
+		return lRecords, fmt.Errorf("SelectRecordsMethod - (ASRM-001) %w", lErr)
+	}
 
-		// Prepare the SQL statement to retrieve data from the table (replace with actual query)
-		lCoreString := `// Enter Select Query`
-		lStmt, lErr := lDb.Prepare(lCoreString)
-		if lErr != nil {
-			// Log an error message if the statement preparation fails
-			log.Println("ASRM:002", lErr.Error())
-			// Return the local variable and an error with a specific code and the error message
-			return lVariable, fmt.Errorf("SelectRecordsMethod - (ASRM-002) " + lErr.Error())
-		} else {
-			// Ensure the prepared statement is closed when the function exits
-			defer lStmt.Close()
+	// Get the dialect to rebind the placeholders of the query
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	if lErr != nil {
+		// Log an error message if the dialect is unknown
+		log.Println("ASRM:002", lErr.Error())
+		return lRecords, fmt.Errorf("SelectRecordsMethod - (ASRM-002) %w", lErr)
+	}
 
-			// Execute the prepared statement with the provided parameter
-			lRows, lErr := lStmt.Query(pParameterName)
-			if lErr != nil {
-				// Log an error message if the query execution fails
-				log.Println("ASRM:003", lErr.Error())
-				// Return the local variable and an error with a specific code and the error message
-				return lVariable, fmt.Errorf("SelectRecordsMethod - (ASRM-003) " + lErr.Error())
-			} else {
-				// Ensure the result set is closed when the function exits
-				defer lRows.Close()
-
-				// Process the result set
-				for lRows.Next() {
-					// Scan the row and store the result in the local variable
-					lErr := lRows.Scan(&lVariable)
-					if lErr != nil {
-						// Log an error message if scanning the row fails
-						log.Println("ASRM:004", lErr.Error())
-						// Return the local variable and an error with a specific code and the error message
-						return lVariable, fmt.Errorf("SelectRecordsMethod - (ASRM-004) " + lErr.Error())
-					} else {
-						// Additional logic for processing the result can be added here
-					}
-				}
-			}
-		}
+	// Stop the query when the caller gives up or the class timeout expires
+	lCtx, lCancel := db.WithTimeout(pCtx, db.ClassAnalytics)
+	defer lCancel()
+
+	// Select statement to retrieve data from the table (replace with actual query)
+	lCoreString := `SELECT id, name FROM your_table WHERE name = ?`
+	lRecords, lErr = db.QueryAll[RecordStruct](lCtx, lDb, lDialect.Rebind(lCoreString), pParameterName)
+	if lErr != nil {
+		// Log an error message if the query or the scan fails
+		log.Println("ASRM:003", lErr.Error())
+		return lRecords, fmt.Errorf("SelectRecordsMethod - (ASRM-003) %w", lErr)
 	}
 
 	// Log the end of the SelectRecordsMethod function
 	log.Println("SelectRecordsMethod (-)")
 
-	// Return the local variable and no error
-	return lVariable, nil
+	// Return the records and no error
+	return lRecords, nil
+}
+
+// Step-by-step comments for SelectRecordMethod:
+// Step 1: Log the start of the function to track its execution.
+// Step 2: Get the read pool and the SQL dialect of the logical database.
+// Step 3: Derive the query context with the timeout of the query class.
+// Step 4: Run the query with db.QueryOne, which scans the first row into RecordStruct.
+// Step 5: If no row matched, return sql.ErrNoRows so the caller can answer "not found".
+// Step 6: Log the end of the function and return the record.
+
+// This method is used to fetch a single record for this purpose from this table.
+func SelectRecordMethod(pCtx context.Context, pId int) (lRecord RecordStruct, lErr error) {
+	// Log the start of the SelectRecordMethod function
+	log.Println("SelectRecordMethod (+)")
+
+	// Get the read pool and the dialect of the logical database
+	lDb, lErr := db.Reader(db.SQLDB)
+	if lErr != nil {
+		log.Println("ASOM:001", lErr.Error())
+		return lRecord, fmt.Errorf("SelectRecordMethod - (ASOM-001) %w", lErr)
+	}
+	lDialect, lErr := db.DialectOf(db.SQLDB)
+	if lErr != nil {
+		log.Println("ASOM:002", lErr.Error())
+		return lRecord, fmt.Errorf("SelectRecordMethod - (ASOM-002) %w", lErr)
+	}
+
+	lCtx, lCancel := db.WithTimeout(pCtx, db.ClassAnalytics)
+	defer lCancel()
+
+	// Select statement returning at most one row (replace with actual query)
+	lCoreString := `SELECT id, name FROM your_table WHERE id = ?`
+	lRecord, lErr = db.QueryOne[RecordStruct](lCtx, lDb, lDialect.Rebind(lCoreString), pId)
+	if errors.Is(lErr, sql.ErrNoRows) {
+		// No matching row, the caller decides whether that is an error
+		log.Println("SelectRecordMethod (-) no record")
+		return lRecord, lErr
+	}
+	if lErr != nil {
+		log.Println("ASOM:003", lErr.Error())
+		return lRecord, fmt.Errorf("SelectRecordMethod - (ASOM-003) %w", lErr)
+	}
+
+	// Log the end of the SelectRecordMethod function
+	log.Println("SelectRecordMethod (-)")
+	return lRecord, nil
 }
 
 // Step-by-step comments for InsertUpdateMethod:
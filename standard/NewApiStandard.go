@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -75,7 +76,7 @@ func SampleAPI(lHttpWriter http.ResponseWriter, lHttpRequest *http.Request) {
 		}
 
 		// 4. Communicate: Interact with other services or databases and get data
-		lResponseArr, lErr := CommunicateMethod(lBatchId)
+		lResponseArr, lErr := CommunicateMethod(lHttpRequest.Context(), lBatchId)
 		if lErr != nil {
 			log.Println("SampleAPI:004 - Communication error:", lErr)
 			lResponseRec.Status = "Error"
@@ -151,22 +152,20 @@ func ConstructMethod(lRequestData RequestStruct) (string, error) {
 // 4. Communicate: CommunicateMethod interacts with other services to retrieve data
 // CommunicateMethod calls SelectRecordsMethod to retrieve data from the database
 // and processes the result before returning it.
-func CommunicateMethod(pParameterName string) (lResponseArr []ResponseArr, lErr error) {
+func CommunicateMethod(pCtx context.Context, pParameterName string) (lResponseArr []ResponseArr, lErr error) {
 	// Log the start of the CommunicateMethod function
 	log.Println("CommunicateMethod (+)")
-	// lData := "asd"
 	// Call SelectRecordsMethod to fetch data based on the parameter
-	lData, lErr := SelectRecordsMethod(pParameterName)
+	lRecords, lErr := SelectRecordsMethod(pCtx, pParameterName)
 	if lErr != nil {
 		// Log and return an error if SelectRecordsMethod fails
 		log.Println("CommunicateMethod: Error in SelectRecordsMethod", lErr.Error())
 		return lResponseArr, fmt.Errorf("CommunicateMethod - Error: %s", lErr.Error())
 	}
 
-	// Simulate fetching data, in a real scenario this could be a database query or an API call
-	lResponseArr = []ResponseArr{
-		{Field1: lData, Field2: 1}, // Example response item 1
-		{Field1: lData, Field2: 2}, // Example response item 2
+	// Map the typed records into the response items
+	for _, lRecord := range lRecords {
+		lResponseArr = append(lResponseArr, ResponseArr{Field1: lRecord.Name, Field2: lRecord.Id})
 	}
 
 	// Log the successful completion of the CommunicateMethod function
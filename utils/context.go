@@ -0,0 +1,36 @@
+package utils
+
+import "context"
+
+const (
+	// RequestIDHeader carries the request ID in and out of the service
+	RequestIDHeader = "X-Request-ID"
+	// CorrelationIDHeader is accepted on inbound requests when RequestIDHeader is absent
+	CorrelationIDHeader = "X-Correlation-ID"
+)
+
+// loggerKey is the context key of the request's Logger
+type loggerKey struct{}
+
+// WithLogger returns a copy of pCtx carrying pLog, so code further down (e.g. the DB layer)
+// logs under the same ReqID.
+func WithLogger(pCtx context.Context, pLog *Logger) context.Context {
+	return context.WithValue(pCtx, loggerKey{}, pLog)
+}
+
+// LoggerFrom returns the Logger stored in pCtx by WithLogger.
+func LoggerFrom(pCtx context.Context) (*Logger, bool) {
+	lLog, ok := pCtx.Value(loggerKey{}).(*Logger)
+	return lLog, ok && lLog != nil
+}
+
+// ContextLogger returns the Logger stored in pCtx, or a new one with a fresh ReqID for work
+// that did not start from a request.
+func ContextLogger(pCtx context.Context) *Logger {
+	if lLog, ok := LoggerFrom(pCtx); ok {
+		return lLog
+	}
+	lLog := new(Logger)
+	lLog.SetReqID()
+	return lLog
+}
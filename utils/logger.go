@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"lumelpkg/common"
 	"net/http"
-	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,21 +19,112 @@ type Logger struct {
 	ReqID string
 }
 
+// LogSettings is the [Logger] section of appconfig.toml. Level and Format are the defaults
+// of every sink that does not set its own.
+type LogSettings struct {
+	Level     string             `validate:"omitempty,oneof=DEBUG INFO ERROR debug info error"`
+	Format    string             `validate:"omitempty,oneof=json text"` // json by default
+	Rotation  LogRotation        // see rotate.go
+	Redaction Redaction          // see redact.go
+	Sinks     map[string]LogSink `validate:"dive"` // see sink.go; the rotated file alone when empty
+}
+
+// Field is a key/value pair attached to a log entry, see F.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// F builds a Field. Fields passed to Log are written as structured data, not in the message:
+//
+//	log.Log(common.INFO, "LoadCSVFile", "Ended", utils.F("records", 5))
+func F(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// logEntry is one line of the JSON log
+type logEntry struct {
+	Time   string         `json:"time"`
+	Level  string         `json:"level"`
+	ReqID  string         `json:"reqId,omitempty"`
+	Step   string         `json:"step"`
+	Msg    string         `json:"msg"`
+	Fields map[string]any `json:"fields,omitempty"`
+
+	at time.Time // Time before formatting, for sinks that need it as a number
+}
+
+// entryTimeLayout is the timestamp of every entry, in UTC with milliseconds
+const entryTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// logLevels orders the known levels so lower ones can be filtered out
+var logLevels = map[string]int32{
+	common.DEBUG: 0,
+	common.INFO:  1,
+	common.ERROR: 2,
+}
+
+// minLevel is the lowest level any sink writes; entries below it are not even built
+var minLevel atomic.Int32
+
+// levelRank returns the rank of a level name, DEBUG for an empty or unknown one.
+func levelRank(pLevel string) int32 {
+	return logLevels[strings.ToUpper(pLevel)]
+}
+
+// ApplyLogSettings applies the [Logger] section, on start and on every config reload.
+func ApplyLogSettings(pSettings LogSettings) {
+	SetLogRotation(pSettings.Rotation)
+	SetRedaction(pSettings.Redaction)
+	SetLogSinks(pSettings)
+}
+
+// SetSid takes the ReqID from the inbound X-Request-ID or X-Correlation-ID header, so one ID
+// follows a request across services. A missing or malformed ID is replaced by a new one.
 func (l *Logger) SetSid(lHttpRequest *http.Request) {
-	panic("unimplemented")
+	for _, lHeader := range []string{RequestIDHeader, CorrelationIDHeader} {
+		if lID := lHttpRequest.Header.Get(lHeader); validReqID(lID) {
+			l.ReqID = lID
+			return
+		}
+	}
+	l.SetReqID()
+}
+
+// validReqID accepts IDs of up to 128 letters, digits and . _ : - so a header cannot
+// inject anything into the log.
+func validReqID(pID string) bool {
+	if pID == "" || len(pID) > 128 {
+		return false
+	}
+	for _, lChar := range pID {
+		switch {
+		case lChar >= 'a' && lChar <= 'z', lChar >= 'A' && lChar <= 'Z', lChar >= '0' && lChar <= '9':
+		case lChar == '.', lChar == '_', lChar == ':', lChar == '-':
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // Initialize the logger (This will configure the log file and output)
+// The file is rotated, compressed and pruned as set by SetLogRotation; until the config is
+// loaded it is the only sink and goes to ./log without limits. Before InitLogger, entries
+// are written to stderr.
 func InitLogger() {
-	// Open log file for appending
-	logFile, err := os.OpenFile("./log/logfile"+time.Now().Format("02012006.15.04.05.000000000")+".txt", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	// Open the first log file
+	logFile.mu.Lock()
+	err := logFile.rotate()
+	logFile.mu.Unlock()
 	if err != nil {
 		log.Fatalf("error opening file: %v", err)
 	}
 
-	// Set the log output to both file and console
+	// Logger entries carry their own timestamp; plain log.Print calls keep the standard one
+	SetLogSinks(LogSettings{})
 	log.SetOutput(logFile)
-	log.SetFlags(log.LstdFlags) // Log with timestamp
+	log.SetFlags(log.LstdFlags)
 }
 
 // Generate a new unique Request ID (ReqID)
@@ -43,8 +138,75 @@ func (l *Logger) SetReqID() {
 	l.ReqID = GenerateReqID()
 }
 
-// Log method to print logs with the Request ID and message, including log level
+// Log writes one entry with the Request ID, level and step. message parts are joined with
+// spaces into msg; Field arguments (see F) are collected into the entry's fields instead.
+// Sensitive values are masked before the entry is written, see SetRedaction.
 func (l *Logger) Log(level, step string, message ...any) {
-	// Format log with timestamp, log level, and ReqID
-	log.Printf("%s [%s] [ReqID: %s] %s [Step %s] %s", time.Now().Format("2006/01/02 15:04:05"), level, l.ReqID, level, step, fmt.Sprintf("%v", message))
+	// Skip levels below the configured threshold; unknown levels are always written
+	if lRank, ok := logLevels[level]; ok && lRank < minLevel.Load() {
+		return
+	}
+
+	lNow := time.Now()
+	lEntry := logEntry{
+		Time:  lNow.UTC().Format(entryTimeLayout),
+		Level: level,
+		ReqID: l.ReqID,
+		Step:  strings.TrimSpace(step),
+		at:    lNow,
+	}
+	lParts := make([]string, 0, len(message))
+	for _, lPart := range message {
+		lField, ok := lPart.(Field)
+		if !ok {
+			lParts = append(lParts, fmt.Sprint(lPart))
+			continue
+		}
+		if lEntry.Fields == nil {
+			lEntry.Fields = make(map[string]any)
+		}
+		lEntry.Fields[lField.Key] = fieldValue(lField.Value)
+	}
+	lEntry.Msg = strings.Join(lParts, " ")
+	activeRedactor.Load().entry(&lEntry)
+
+	dispatch(lEntry)
+}
+
+// formatEntry renders an entry as one JSON object, or as a text line when pText is set.
+func formatEntry(pEntry logEntry, pText bool) string {
+	if !pText {
+		if lLine, lErr := json.Marshal(pEntry); lErr == nil {
+			return string(lLine)
+		}
+	}
+
+	var lLine strings.Builder
+	fmt.Fprintf(&lLine, "%s [%s] [ReqID: %s] [Step %s] %s", pEntry.Time, pEntry.Level, pEntry.ReqID, pEntry.Step, pEntry.Msg)
+	lKeys := make([]string, 0, len(pEntry.Fields))
+	for lKey := range pEntry.Fields {
+		lKeys = append(lKeys, lKey)
+	}
+	sort.Strings(lKeys)
+	for _, lKey := range lKeys {
+		fmt.Fprintf(&lLine, " %s=%v", lKey, pEntry.Fields[lKey])
+	}
+	return lLine.String()
+}
+
+// fieldValue makes a field JSON friendly: errors and durations become their text,
+// values json cannot encode are formatted with %v.
+func fieldValue(pValue any) any {
+	switch lValue := pValue.(type) {
+	case error:
+		return lValue.Error()
+	case time.Duration:
+		return lValue.String()
+	case fmt.Stringer:
+		return lValue.String()
+	}
+	if _, lErr := json.Marshal(pValue); lErr != nil {
+		return fmt.Sprintf("%v", pValue)
+	}
+	return pValue
 }
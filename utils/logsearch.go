@@ -0,0 +1,367 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LogQuery selects the entries returned by SearchLogs. Empty filters match everything.
+type LogQuery struct {
+	ReqID  string    // exact request ID
+	Level  string    // minimum level: DEBUG, INFO or ERROR
+	Step   string    // case-insensitive substring of the step
+	Since  time.Time // entries at or after this time
+	Until  time.Time // entries before this time
+	Limit  int       // stop after this many entries, 0 for no limit
+	Follow bool      // keep watching the newest file for new entries, until the context ends
+}
+
+// LogRecord is one entry found by SearchLogs
+type LogRecord struct {
+	Time   time.Time      `json:"time"`
+	Level  string         `json:"level"`
+	ReqID  string         `json:"reqId,omitempty"`
+	Step   string         `json:"step"`
+	Msg    string         `json:"msg"`
+	Fields map[string]any `json:"fields,omitempty"`
+	File   string         `json:"file"` // name of the log file it was read from
+}
+
+// Text renders the record like a line of the text log format.
+func (r LogRecord) Text() string {
+	return formatEntry(logEntry{
+		Time:   r.Time.UTC().Format(entryTimeLayout),
+		Level:  r.Level,
+		ReqID:  r.ReqID,
+		Step:   r.Step,
+		Msg:    r.Msg,
+		Fields: r.Fields,
+	}, true)
+}
+
+// errSearchDone stops a search once Limit records were emitted
+var errSearchDone = fmt.Errorf("log search limit reached")
+
+// followPollInterval is how often Follow checks the newest file for new lines
+const followPollInterval = 500 * time.Millisecond
+
+// textLinePattern parses lines of the text format and of the older
+// "<date> <date> [LEVEL] [ReqID: x] LEVEL [Step s] msg" lines
+var textLinePattern = regexp.MustCompile(`^(?:\d{4}/\d\d/\d\d \d\d:\d\d:\d\d )?(\d{4}[-/]\d\d[-/]\d\d[T ][0-9:.]+(?:Z|[+-]\d\d:\d\d)?) \[(\w+)\] \[ReqID: ([^\]]*)\] (?:\w+ )?\[Step ([^\]]*)\] ?(.*)$`)
+
+// SearchLogs reads the log files of pDir, oldest first and gzipped ones included, and calls
+// pEmit for every entry matching pQuery. Lines that are not log entries (plain log.Print
+// output) are skipped. With Follow it then keeps reading the newest file, moving on to the
+// next one after a rotation, until pCtx ends. An error from pEmit stops the search.
+func SearchLogs(pCtx context.Context, pDir string, pQuery LogQuery, pEmit func(LogRecord) error) error {
+	lMinRank := levelRank(pQuery.Level)
+	lCount := 0
+	lMatch := func(pRecord LogRecord) error {
+		if !pQuery.matches(pRecord, lMinRank) {
+			return nil
+		}
+		if lErr := pEmit(pRecord); lErr != nil {
+			return lErr
+		}
+		lCount++
+		if pQuery.Limit > 0 && lCount >= pQuery.Limit {
+			return errSearchDone
+		}
+		return nil
+	}
+
+	lFiles, lErr := logFilesByAge(pDir)
+	if lErr != nil {
+		return lErr
+	}
+
+	// A file holds the entries from its own start to the start of the next one, so files
+	// entirely outside the time range are not opened
+	var lLast string
+	var lOffset int64
+	for i, lFile := range lFiles {
+		if lErr := pCtx.Err(); lErr != nil {
+			return nil
+		}
+		if !pQuery.Until.IsZero() && lFile.start.After(pQuery.Until) {
+			break
+		}
+		if !pQuery.Since.IsZero() && i+1 < len(lFiles) && lFiles[i+1].start.Before(pQuery.Since) {
+			continue
+		}
+		lLast = lFile.path
+		lOffset, lErr = scanLogFile(pCtx, lFile.path, 0, lMatch)
+		if lErr == errSearchDone {
+			return nil
+		}
+		if lErr != nil {
+			return lErr
+		}
+		if strings.HasSuffix(lFile.path, ".gz") {
+			lOffset = -1
+		}
+	}
+
+	if !pQuery.Follow {
+		return nil
+	}
+	return followLogs(pCtx, pDir, pQuery, lLast, lOffset, lMatch)
+}
+
+// followLogs polls the newest log file from pOffset on. When a newer file appears, the rest
+// of the current one is read before switching to it, from its .gz when it was compressed in
+// the meantime. Files rotated by this process are left once their recorded size is read,
+// for the file the rotation opened next, even in another Dir (see logHandoff). A negative
+// pOffset marks pPath as read.
+func followLogs(pCtx context.Context, pDir string, pQuery LogQuery, pPath string, pOffset int64, pMatch func(LogRecord) error) error {
+	lTicker := time.NewTicker(followPollInterval)
+	defer lTicker.Stop()
+
+	// lFinal is set once a newer file exists: pPath gets no more lines, one last scan reads
+	// the ones written after the previous poll
+	var lFinal bool
+	for {
+		if pPath != "" && pOffset >= 0 {
+			lOffset, lErr := scanLogFile(pCtx, pPath, pOffset, pMatch)
+			if lErr == errSearchDone {
+				return nil
+			}
+			if os.IsNotExist(lErr) && !strings.HasSuffix(pPath, ".gz") {
+				// Rotated and compressed since the last poll; the .gz holds the same bytes
+				if _, lStatErr := os.Stat(pPath + ".gz"); lStatErr == nil {
+					pPath += ".gz"
+					continue
+				}
+			}
+			if lErr != nil && !os.IsNotExist(lErr) {
+				return lErr
+			}
+			pOffset = lOffset
+			if strings.HasSuffix(pPath, ".gz") {
+				// Compressed files are complete
+				pOffset = -1
+			}
+		}
+
+		if lHandoff, ok := rotatedLogHandoff(pPath); ok && (pOffset < 0 || pOffset >= lHandoff.size) {
+			pPath, pOffset, lFinal = lHandoff.next, 0, false
+			continue
+		}
+
+		lFiles, lErr := logFilesByAge(pDir)
+		if lErr != nil {
+			return lErr
+		}
+		if lNext := newerLogFile(lFiles, pPath); lNext != "" {
+			if !lFinal && pPath != "" && pOffset >= 0 {
+				lFinal = true
+				continue
+			}
+			// Its first lines are already there, so do not wait for the next tick
+			pPath, pOffset, lFinal = lNext, 0, false
+			continue
+		}
+
+		if !pQuery.Until.IsZero() && time.Now().After(pQuery.Until) {
+			return nil
+		}
+		select {
+		case <-pCtx.Done():
+			return nil
+		case <-lTicker.C:
+		}
+	}
+}
+
+// newerLogFile returns the first file started after pPath, the oldest file when pPath is
+// empty, or "" when there is none.
+func newerLogFile(pFiles []logFileInfo, pPath string) string {
+	if pPath == "" {
+		if len(pFiles) > 0 {
+			return pFiles[0].path
+		}
+		return ""
+	}
+	lStart := fileStart(pPath)
+	for _, lFile := range pFiles {
+		if lFile.start.After(lStart) {
+			return lFile.path
+		}
+	}
+	return ""
+}
+
+// scanLogFile parses pPath from byte pOffset on and passes every entry to pMatch. It returns
+// the offset after the last complete line, so a follow pass can resume there; a line still
+// being written is left for that pass. The offset of a gzipped file counts uncompressed bytes.
+func scanLogFile(pCtx context.Context, pPath string, pOffset int64, pMatch func(LogRecord) error) (int64, error) {
+	lFile, lErr := os.Open(pPath)
+	if lErr != nil {
+		return pOffset, lErr
+	}
+	defer lFile.Close()
+
+	var lSource io.Reader = lFile
+	if strings.HasSuffix(pPath, ".gz") {
+		lZip, lErr := gzip.NewReader(lFile)
+		if lErr != nil {
+			return pOffset, fmt.Errorf("%s: %w", pPath, lErr)
+		}
+		defer lZip.Close()
+		if _, lErr := io.CopyN(io.Discard, lZip, pOffset); lErr == io.EOF {
+			return pOffset, nil
+		} else if lErr != nil {
+			return pOffset, fmt.Errorf("%s: %w", pPath, lErr)
+		}
+		lSource = lZip
+	} else if pOffset > 0 {
+		if _, lErr := lFile.Seek(pOffset, io.SeekStart); lErr != nil {
+			return pOffset, lErr
+		}
+	}
+
+	lName := filepath.Base(pPath)
+	lReader := bufio.NewReaderSize(lSource, 64<<10)
+	for lLineNo := 0; ; lLineNo++ {
+		if lLineNo%1024 == 0 && pCtx.Err() != nil {
+			return pOffset, nil
+		}
+		lLine, lErr := lReader.ReadBytes('\n')
+		if lErr == io.EOF {
+			// An unterminated last line is only final in a gzipped file
+			if len(lLine) > 0 && strings.HasSuffix(pPath, ".gz") {
+				if lRecord, ok := parseLogLine(lLine, lName); ok {
+					return pOffset, pMatch(lRecord)
+				}
+			}
+			return pOffset, nil
+		}
+		if lErr != nil {
+			return pOffset, fmt.Errorf("%s: %w", pPath, lErr)
+		}
+		pOffset += int64(len(lLine))
+		if lRecord, ok := parseLogLine(lLine, lName); ok {
+			if lErr := pMatch(lRecord); lErr != nil {
+				return pOffset, lErr
+			}
+		}
+	}
+}
+
+// parseLogLine reads a JSON or text entry; ok is false for any other line.
+func parseLogLine(pLine []byte, pFile string) (LogRecord, bool) {
+	pLine = bytes.TrimSpace(pLine)
+	if len(pLine) == 0 {
+		return LogRecord{}, false
+	}
+
+	if pLine[0] == '{' {
+		var lEntry logEntry
+		if json.Unmarshal(pLine, &lEntry) != nil || lEntry.Level == "" {
+			return LogRecord{}, false
+		}
+		lTime, lErr := time.Parse(entryTimeLayout, lEntry.Time)
+		if lErr != nil {
+			return LogRecord{}, false
+		}
+		return LogRecord{Time: lTime, Level: lEntry.Level, ReqID: lEntry.ReqID, Step: lEntry.Step,
+			Msg: lEntry.Msg, Fields: lEntry.Fields, File: pFile}, true
+	}
+
+	lParts := textLinePattern.FindSubmatch(pLine)
+	if lParts == nil {
+		return LogRecord{}, false
+	}
+	lTime, lErr := time.Parse(entryTimeLayout, string(lParts[1]))
+	if lErr != nil {
+		if lTime, lErr = time.ParseInLocation("2006/01/02 15:04:05", string(lParts[1]), time.Local); lErr != nil {
+			return LogRecord{}, false
+		}
+	}
+	// Fields of text lines stay part of the message
+	return LogRecord{Time: lTime, Level: string(lParts[2]), ReqID: string(lParts[3]), Step: string(lParts[4]),
+		Msg: string(lParts[5]), File: pFile}, true
+}
+
+// matches applies the filters of the query to one record.
+func (q LogQuery) matches(pRecord LogRecord, pMinRank int32) bool {
+	if q.ReqID != "" && pRecord.ReqID != q.ReqID {
+		return false
+	}
+	if lRank, ok := logLevels[strings.ToUpper(pRecord.Level)]; ok && lRank < pMinRank {
+		return false
+	}
+	if q.Step != "" && !strings.Contains(strings.ToLower(pRecord.Step), strings.ToLower(q.Step)) {
+		return false
+	}
+	if !q.Since.IsZero() && pRecord.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !pRecord.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// logFileInfo is a log file with the time its name says it was started
+type logFileInfo struct {
+	path  string
+	start time.Time
+}
+
+// logFilesByAge lists every log file of pDir, plain and gzipped, oldest first.
+func logFilesByAge(pDir string) ([]logFileInfo, error) {
+	lPaths, lErr := RotatedLogFiles(pDir, "")
+	if lErr != nil {
+		return nil, lErr
+	}
+	lFiles := make([]logFileInfo, 0, len(lPaths))
+	for _, lPath := range lPaths {
+		lFiles = append(lFiles, logFileInfo{path: lPath, start: fileStart(lPath)})
+	}
+	sort.Slice(lFiles, func(i, j int) bool { return lFiles[i].start.Before(lFiles[j].start) })
+	return lFiles, nil
+}
+
+// fileStart reads the timestamp in a log file name, falling back to the modification time.
+func fileStart(pPath string) time.Time {
+	lName := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(pPath), ".gz"), logFileSuffix)
+	if lStart, lErr := time.ParseInLocation(logFileTimeLayout, strings.TrimPrefix(lName, logFilePrefix), time.Local); lErr == nil {
+		return lStart
+	}
+	if lInfo, lErr := os.Stat(pPath); lErr == nil {
+		return lInfo.ModTime()
+	}
+	return time.Time{}
+}
+
+// ParseLogTime reads a time filter: RFC 3339, "2006-01-02 15:04:05" or "2006-01-02" in local
+// time, or a duration such as "15m" or "2h" meaning that long before pNow.
+func ParseLogTime(pValue string, pNow time.Time) (time.Time, error) {
+	if pValue == "" {
+		return time.Time{}, nil
+	}
+	if lAgo, lErr := time.ParseDuration(pValue); lErr == nil {
+		return pNow.Add(-lAgo), nil
+	}
+	if lTime, lErr := time.Parse(time.RFC3339Nano, pValue); lErr == nil {
+		return lTime, nil
+	}
+	for _, lLayout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if lTime, lErr := time.ParseInLocation(lLayout, pValue, time.Local); lErr == nil {
+			return lTime, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339, 2006-01-02 15:04:05, 2006-01-02 or a duration like 15m", pValue)
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"context"
+	"lumelpkg/common"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSearchLogsFilters(t *testing.T) {
+	lDir := t.TempDir()
+	lStart := time.Date(2025, 5, 17, 10, 0, 0, 0, time.UTC)
+	writeTestLog(t, lDir, lStart, "first", "second")
+	writeTestLog(t, lDir, lStart.Add(time.Hour), "third")
+	if lErr := gzipFile(testLogPath(lDir, lStart)); lErr != nil {
+		t.Fatal(lErr)
+	}
+
+	lGot := searchTestLogs(t, lDir, LogQuery{})
+	if !reflect.DeepEqual(lGot, []string{"first", "second", "third"}) {
+		t.Errorf("all entries = %v", lGot)
+	}
+	lGot = searchTestLogs(t, lDir, LogQuery{Limit: 2})
+	if !reflect.DeepEqual(lGot, []string{"first", "second"}) {
+		t.Errorf("limited entries = %v", lGot)
+	}
+	lGot = searchTestLogs(t, lDir, LogQuery{Since: lStart.Add(time.Hour)})
+	if !reflect.DeepEqual(lGot, []string{"third"}) {
+		t.Errorf("entries since the second file = %v", lGot)
+	}
+}
+
+func TestFollowLogsAcrossCompressedRotation(t *testing.T) {
+	lDir := t.TempDir()
+	lStart := time.Now().Add(-time.Minute)
+	writeTestLog(t, lDir, lStart, "before 1", "before 2")
+
+	lCtx, lCancel := context.WithCancel(context.Background())
+	defer lCancel()
+	var lMu sync.Mutex
+	var lGot []string
+	lDone := make(chan error, 1)
+	go func() {
+		lDone <- SearchLogs(lCtx, lDir, LogQuery{Follow: true}, func(pRecord LogRecord) error {
+			lMu.Lock()
+			defer lMu.Unlock()
+			lGot = append(lGot, pRecord.Msg)
+			return nil
+		})
+	}()
+	waitForTestLogs(t, &lMu, &lGot, 2)
+
+	// The tail, the rotation and the compression all happen between two polls
+	writeTestLog(t, lDir, lStart, "tail 1", "tail 2")
+	writeTestLog(t, lDir, lStart.Add(time.Second), "after")
+	if lErr := gzipFile(testLogPath(lDir, lStart)); lErr != nil {
+		t.Fatal(lErr)
+	}
+
+	waitForTestLogs(t, &lMu, &lGot, 5)
+	lCancel()
+	if lErr := <-lDone; lErr != nil {
+		t.Fatal(lErr)
+	}
+	lWant := []string{"before 1", "before 2", "tail 1", "tail 2", "after"}
+	if !reflect.DeepEqual(lGot, lWant) {
+		t.Errorf("followed entries = %v, want %v", lGot, lWant)
+	}
+}
+
+func TestFollowLogsIntoAnotherDir(t *testing.T) {
+	lFirstDir, lSecondDir := t.TempDir(), t.TempDir()
+	lFile := &rotatingFile{settings: LogRotation{Dir: lFirstDir}}
+	defer func() { lFile.file.Close() }()
+	writeTestEntry(t, lFile, "first")
+
+	lCtx, lCancel := context.WithCancel(context.Background())
+	defer lCancel()
+	var lMu sync.Mutex
+	var lGot []string
+	lDone := make(chan error, 1)
+	go func() {
+		lDone <- SearchLogs(lCtx, lFirstDir, LogQuery{Follow: true}, func(pRecord LogRecord) error {
+			lMu.Lock()
+			defer lMu.Unlock()
+			lGot = append(lGot, pRecord.Msg)
+			return nil
+		})
+	}()
+	waitForTestLogs(t, &lMu, &lGot, 1)
+
+	// Only the recorded handoff leads to the new Dir
+	writeTestEntry(t, lFile, "tail")
+	lFile.mu.Lock()
+	lFile.settings.Dir = lSecondDir
+	lErr := lFile.rotate()
+	lFile.mu.Unlock()
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	writeTestEntry(t, lFile, "moved")
+
+	waitForTestLogs(t, &lMu, &lGot, 3)
+	lCancel()
+	if lErr := <-lDone; lErr != nil {
+		t.Fatal(lErr)
+	}
+	if lWant := []string{"first", "tail", "moved"}; !reflect.DeepEqual(lGot, lWant) {
+		t.Errorf("followed entries = %v, want %v", lGot, lWant)
+	}
+}
+
+func TestScanCompressedLogFromOffset(t *testing.T) {
+	lDir := t.TempDir()
+	lStart := time.Date(2025, 5, 17, 10, 0, 0, 0, time.UTC)
+	writeTestLog(t, lDir, lStart, "one", "two")
+	lPath := testLogPath(lDir, lStart)
+	lInfo, lErr := os.Stat(lPath)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	writeTestLog(t, lDir, lStart, "three")
+	if lErr := gzipFile(lPath); lErr != nil {
+		t.Fatal(lErr)
+	}
+
+	var lGot []string
+	lOffset, lErr := scanLogFile(context.Background(), lPath+".gz", lInfo.Size(), func(pRecord LogRecord) error {
+		lGot = append(lGot, pRecord.Msg)
+		return nil
+	})
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	if !reflect.DeepEqual(lGot, []string{"three"}) {
+		t.Errorf("entries after offset %d = %v", lInfo.Size(), lGot)
+	}
+	if lOffset <= lInfo.Size() {
+		t.Errorf("offset = %d, want past %d", lOffset, lInfo.Size())
+	}
+}
+
+// testLogPath is the log file of pDir started at pStart.
+func testLogPath(pDir string, pStart time.Time) string {
+	return filepath.Join(pDir, logFilePrefix+pStart.Local().Format(logFileTimeLayout)+logFileSuffix)
+}
+
+// writeTestLog appends one INFO entry per message to the log file started at pStart.
+func writeTestLog(t *testing.T, pDir string, pStart time.Time, pMsgs ...string) {
+	t.Helper()
+	lFile, lErr := os.OpenFile(testLogPath(pDir, pStart), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	defer lFile.Close()
+	for i, lMsg := range pMsgs {
+		lAt := pStart.Add(time.Duration(i) * time.Millisecond)
+		lLine := formatEntry(logEntry{Time: lAt.UTC().Format(entryTimeLayout), Level: common.INFO, Step: "Test", Msg: lMsg, at: lAt}, false)
+		if _, lErr := lFile.WriteString(lLine + "\n"); lErr != nil {
+			t.Fatal(lErr)
+		}
+	}
+}
+
+// writeTestEntry writes one INFO entry through pFile.
+func writeTestEntry(t *testing.T, pFile *rotatingFile, pMsg string) {
+	t.Helper()
+	lAt := time.Now()
+	lLine := formatEntry(logEntry{Time: lAt.UTC().Format(entryTimeLayout), Level: common.INFO, Step: "Test", Msg: pMsg, at: lAt}, false)
+	if _, lErr := pFile.Write([]byte(lLine + "\n")); lErr != nil {
+		t.Fatal(lErr)
+	}
+}
+
+// searchTestLogs returns the messages SearchLogs finds in pDir.
+func searchTestLogs(t *testing.T, pDir string, pQuery LogQuery) []string {
+	t.Helper()
+	var lMsgs []string
+	lErr := SearchLogs(context.Background(), pDir, pQuery, func(pRecord LogRecord) error {
+		lMsgs = append(lMsgs, pRecord.Msg)
+		return nil
+	})
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	return lMsgs
+}
+
+// waitForTestLogs waits a few polls for pCount followed entries.
+func waitForTestLogs(t *testing.T, pMu *sync.Mutex, pGot *[]string, pCount int) {
+	t.Helper()
+	lDeadline := time.Now().Add(5 * followPollInterval)
+	for {
+		pMu.Lock()
+		lLen := len(*pGot)
+		pMu.Unlock()
+		if lLen >= pCount {
+			return
+		}
+		if time.Now().After(lDeadline) {
+			pMu.Lock()
+			defer pMu.Unlock()
+			t.Fatalf("followed %v, want %d entries", *pGot, pCount)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,336 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// Redaction is the [Logger.Redaction] section of appconfig.toml. Fields and Patterns extend
+// the built-in lists (see defaultRedactFields and defaultRedactPatterns), they never replace them.
+type Redaction struct {
+	Fields   []string // field names whose values are masked, case-insensitive and as whole words; "email" also matches "customerEmail"
+	Patterns []string // regular expressions masked in messages and string values; with capture groups only the groups are masked
+	Mask     string   // replacement text, [REDACTED] by default
+}
+
+// defaultRedactMask replaces every redacted value
+const defaultRedactMask = "[REDACTED]"
+
+// defaultRedactFields are always treated as sensitive, in the log and in config.Inspect
+var defaultRedactFields = []string{
+	"password", "passwd", "pwd", "secret", "token", "apikey", "authorization", "cookie",
+	"header", "credential", "privatekey", "email", "card", "cvv",
+}
+
+// defaultRedactPatterns are always masked in messages and string values
+var defaultRedactPatterns = []string{
+	// e-mail addresses
+	`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`,
+	// bearer tokens outside an Authorization header; the scheme stays visible
+	`(?i)\bbearer\s+([^\s"',;}]+)`,
+}
+
+// fieldPattern finds name=value, name: value and "name":"value" pairs in messages. Groups:
+// 1 the name, 2 the whitespace after the separator, then the value: 3 double quoted,
+// 4 single quoted, 5 after an Authorization scheme, 6 unquoted.
+var fieldPattern = regexp.MustCompile(`([A-Za-z0-9_\-]+)["']?\s*[:=](\s*)(?:"([^"]*)"|'([^']*)'|(?i:basic|bearer|digest)\s+([^\s"',;&}]+)|([^\s"',;&}]+))`)
+
+// nextFieldPattern matches a value that is really the next name of a %+v struct, e.g.
+// "Database:./lumel.db" in "Password: Database:./lumel.db"
+var nextFieldPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_\-]*:`)
+
+// cardPattern finds card-like numbers: 13 to 19 digits, optionally grouped by spaces or dashes.
+// A match is masked only when it passes the Luhn check, so order IDs and timestamps survive.
+var cardPattern = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`)
+
+// redactor is the compiled form of the redaction settings
+type redactor struct {
+	fields   []string         // normalised field names, see normaliseKey
+	patterns []*regexp.Regexp // defaults and configured patterns
+	mask     string
+}
+
+// activeRedactor is used by every Log call; it starts with the built-in lists
+var activeRedactor atomic.Pointer[redactor]
+
+func init() {
+	SetRedaction(Redaction{})
+}
+
+// SetRedaction compiles and applies new redaction settings. Invalid patterns are reported on
+// stderr and skipped; the remaining ones still apply.
+func SetRedaction(pSettings Redaction) {
+	lRedactor := &redactor{mask: pSettings.Mask}
+	if lRedactor.mask == "" {
+		lRedactor.mask = defaultRedactMask
+	}
+
+	for _, lName := range append(append([]string{}, defaultRedactFields...), pSettings.Fields...) {
+		if lKey := normaliseKey(lName); lKey != "" {
+			lRedactor.fields = append(lRedactor.fields, lKey)
+		}
+	}
+
+	for _, lPattern := range append(append([]string{}, defaultRedactPatterns...), pSettings.Patterns...) {
+		lRegexp, lErr := regexp.Compile(lPattern)
+		if lErr != nil {
+			fmt.Fprintf(os.Stderr, "log redaction: skipping pattern %q: %v\n", lPattern, lErr)
+			continue
+		}
+		lRedactor.patterns = append(lRedactor.patterns, lRegexp)
+	}
+	activeRedactor.Store(lRedactor)
+}
+
+// Redact masks the sensitive parts of pText with the active settings. Log applies it to
+// every message and field; it is exported for output that does not go through Log.
+func Redact(pText string) string {
+	return activeRedactor.Load().text(pText)
+}
+
+// SensitiveKey reports whether values under the key name pKey are masked: it contains one of
+// defaultRedactFields or of the configured Redaction Fields. config.Inspect uses it, so the
+// admin endpoints hide the same names as the log.
+func SensitiveKey(pKey string) bool {
+	return activeRedactor.Load().sensitive(pKey)
+}
+
+// entry masks the step, message and fields of a log entry in place.
+func (r *redactor) entry(pEntry *logEntry) {
+	pEntry.Step = r.text(pEntry.Step)
+	pEntry.Msg = r.text(pEntry.Msg)
+	for lKey, lValue := range pEntry.Fields {
+		pEntry.Fields[lKey] = r.value(lKey, lValue)
+	}
+}
+
+// value masks a field value: completely when its key is sensitive, otherwise its strings
+// are run through the patterns. Structs, maps and slices are walked key by key.
+func (r *redactor) value(pKey string, pValue any) any {
+	if r.sensitive(pKey) {
+		if pValue == nil {
+			return nil
+		}
+		return r.mask
+	}
+
+	switch lValue := pValue.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return pValue
+	case string:
+		return r.text(lValue)
+	case map[string]any:
+		lMasked := make(map[string]any, len(lValue))
+		for lKey, lItem := range lValue {
+			lMasked[lKey] = r.value(lKey, lItem)
+		}
+		return lMasked
+	case []any:
+		lMasked := make([]any, len(lValue))
+		for i, lItem := range lValue {
+			lMasked[i] = r.value("", lItem)
+		}
+		return lMasked
+	}
+
+	// Anything else (structs, typed maps and slices) is walked in its JSON form, so the
+	// names of nested fields are checked too
+	lJSON, lErr := json.Marshal(pValue)
+	if lErr != nil {
+		return r.text(fmt.Sprintf("%v", pValue))
+	}
+	var lGeneric any
+	if lErr := json.Unmarshal(lJSON, &lGeneric); lErr != nil {
+		return r.text(string(lJSON))
+	}
+	return r.value("", lGeneric)
+}
+
+// sensitive reports whether a field name holds one of the configured names as whole words,
+// split at separators and camelCase: customerEmail and CUSTOMER_EMAIL match "email", apiKey
+// matches "apikey", discard and cardinality do not match "card". A plural "s" is allowed.
+func (r *redactor) sensitive(pKey string) bool {
+	lWords := keyWords(pKey)
+	for i := range lWords {
+		lRun := ""
+		for _, lWord := range lWords[i:] {
+			lRun += lWord
+			for _, lName := range r.fields {
+				if lRun == lName || lRun == lName+"s" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// text masks the values of sensitive names, every pattern match and every card number in pText.
+func (r *redactor) text(pText string) string {
+	if pText == "" {
+		return pText
+	}
+	pText = r.fieldValues(pText)
+	for _, lPattern := range r.patterns {
+		pText = maskMatches(lPattern, pText, r.mask)
+	}
+	return cardPattern.ReplaceAllStringFunc(pText, func(pMatch string) string {
+		if luhnValid(pMatch) {
+			return r.mask
+		}
+		return pMatch
+	})
+}
+
+// fieldValues masks the value of every name=value, name: value and "name":"value" pair
+// whose name is sensitive, e.g. in a logged request body. Quoted values are masked up to
+// the closing quote so addresses with spaces are covered; the scheme of an unquoted
+// "Authorization: Basic ..." stays visible. An unquoted value after whitespace that looks
+// like the next name ("Password: Database:x" from %+v) is not a value, the scan resumes there.
+func (r *redactor) fieldValues(pText string) string {
+	var lResult strings.Builder
+	lLast, lFrom := 0, 0
+	for lFrom < len(pText) {
+		lMatch := fieldPattern.FindStringSubmatchIndex(pText[lFrom:])
+		if lMatch == nil {
+			break
+		}
+		for i := range lMatch {
+			if lMatch[i] >= 0 {
+				lMatch[i] += lFrom
+			}
+		}
+
+		lValue := [2]int{-1, -1}
+		for lGroup := 3; lGroup <= 6; lGroup++ {
+			if lMatch[2*lGroup] >= 0 {
+				lValue = [2]int{lMatch[2*lGroup], lMatch[2*lGroup+1]}
+				break
+			}
+		}
+		lSpaced := lMatch[5] > lMatch[4]
+		if lMatch[12] >= 0 && lSpaced && nextFieldPattern.MatchString(pText[lValue[0]:lValue[1]]) {
+			lFrom = lValue[0]
+			continue
+		}
+		lFrom = lMatch[1]
+
+		if lValue[0] == lValue[1] || !r.sensitive(pText[lMatch[2]:lMatch[3]]) {
+			continue
+		}
+		lResult.WriteString(pText[lLast:lValue[0]])
+		lResult.WriteString(r.mask)
+		lLast = lValue[1]
+	}
+	if lLast == 0 {
+		return pText
+	}
+	lResult.WriteString(pText[lLast:])
+	return lResult.String()
+}
+
+// maskMatches replaces the matches of pPattern in pText by pMask. When the pattern has capture
+// groups only the groups that took part in the match are replaced, so "password=x" keeps its key.
+func maskMatches(pPattern *regexp.Regexp, pText, pMask string) string {
+	lMatches := pPattern.FindAllStringSubmatchIndex(pText, -1)
+	if lMatches == nil {
+		return pText
+	}
+
+	var lResult strings.Builder
+	lLast := 0
+	for _, lMatch := range lMatches {
+		lSpans := [][2]int{{lMatch[0], lMatch[1]}}
+		if len(lMatch) > 2 {
+			lSpans = lSpans[:0]
+			for i := 2; i+1 < len(lMatch); i += 2 {
+				if lMatch[i] >= 0 {
+					lSpans = append(lSpans, [2]int{lMatch[i], lMatch[i+1]})
+				}
+			}
+		}
+		for _, lSpan := range lSpans {
+			if lSpan[0] < lLast || lSpan[0] == lSpan[1] {
+				continue
+			}
+			lResult.WriteString(pText[lLast:lSpan[0]])
+			lResult.WriteString(pMask)
+			lLast = lSpan[1]
+		}
+	}
+	lResult.WriteString(pText[lLast:])
+	return lResult.String()
+}
+
+// luhnValid reports whether the digits of pNumber pass the Luhn checksum used by card numbers.
+func luhnValid(pNumber string) bool {
+	lSum, lDouble := 0, false
+	for i := len(pNumber) - 1; i >= 0; i-- {
+		lDigit := int(pNumber[i] - '0')
+		if lDigit < 0 || lDigit > 9 {
+			continue
+		}
+		if lDouble {
+			if lDigit *= 2; lDigit > 9 {
+				lDigit -= 9
+			}
+		}
+		lSum += lDigit
+		lDouble = !lDouble
+	}
+	return lSum%10 == 0
+}
+
+// keyWords splits a field name into lowercase words at separators, camelCase and digits:
+// "DBPassword" gives db, password and "customer_email2" customer, email, 2.
+func keyWords(pKey string) []string {
+	var lWords []string
+	lRunes := []rune(pKey)
+	lStart := -1
+	for i, lChar := range lRunes {
+		if !unicode.IsLetter(lChar) && !unicode.IsDigit(lChar) {
+			if lStart >= 0 {
+				lWords = append(lWords, strings.ToLower(string(lRunes[lStart:i])))
+				lStart = -1
+			}
+			continue
+		}
+		if lStart >= 0 && unicode.IsDigit(lChar) != unicode.IsDigit(lRunes[i-1]) {
+			// card2 gives card, 2
+			lWords = append(lWords, strings.ToLower(string(lRunes[lStart:i])))
+			lStart = i
+		} else if lStart >= 0 && unicode.IsUpper(lChar) {
+			lPrev := lRunes[i-1]
+			lNextLower := i+1 < len(lRunes) && unicode.IsLower(lRunes[i+1])
+			// aB starts a word, and so does the B of ABc (the end of an acronym)
+			if !unicode.IsUpper(lPrev) || lNextLower {
+				lWords = append(lWords, strings.ToLower(string(lRunes[lStart:i])))
+				lStart = i
+			}
+		}
+		if lStart < 0 {
+			lStart = i
+		}
+	}
+	if lStart >= 0 {
+		lWords = append(lWords, strings.ToLower(string(lRunes[lStart:])))
+	}
+	return lWords
+}
+
+// normaliseKey lowercases a field name and drops separators, so Customer_Email, customer-email
+// and customerEmail compare equal.
+func normaliseKey(pKey string) string {
+	return strings.Map(func(pChar rune) rune {
+		switch pChar {
+		case '_', '-', ' ', '.':
+			return -1
+		}
+		return pChar
+	}, strings.ToLower(strings.TrimSpace(pKey)))
+}
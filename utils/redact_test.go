@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLuhnValid(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4111 1111 1111 1111", true},
+		{"5500-0000-0000-0004", true},
+		{"378282246310005", true},
+		{"4111111111111112", false},
+		{"1234567890123", false},
+		{"20250517102103", false},
+	}
+	for _, tt := range tests {
+		if got := luhnValid(tt.number); got != tt.want {
+			t.Errorf("luhnValid(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestRedactCardNumbers(t *testing.T) {
+	r := newTestRedactor(t, Redaction{})
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"paid with 4111 1111 1111 1111 today", "paid with [REDACTED] today"},
+		{"paid with 4111-1111-1111-1111", "paid with [REDACTED]"},
+		{"order 4111111111111112 loaded", "order 4111111111111112 loaded"},
+		{"started at 20250517102103", "started at 20250517102103"},
+	}
+	for _, tt := range tests {
+		if got := r.text(tt.in); got != tt.want {
+			t.Errorf("text(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactFieldValues(t *testing.T) {
+	r := newTestRedactor(t, Redaction{})
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"equals", "user=ana password=hunter2", "user=ana password=[REDACTED]"},
+		{"query string", "?user=ana&token=abc123&page=2", "?user=ana&token=[REDACTED]&page=2"},
+		{"colon and space", "password: hunter2", "password: [REDACTED]"},
+		{"json", `{"user":"ana","password":"hunter2"}`, `{"user":"ana","password":"[REDACTED]"}`},
+		{"json with spaces", `{"password" : "two words"}`, `{"password" : "[REDACTED]"}`},
+		{"single quoted", "secret='a b c'", "secret='[REDACTED]'"},
+		{"prefixed name", "dbPassword=hunter2", "dbPassword=[REDACTED]"},
+		{"authorization scheme", "Authorization: Basic dXNlcjpwYXNz", "Authorization: Basic [REDACTED]"},
+		{"struct", "{User:sa Password:hunter2 Database:orders}", "{User:sa Password:[REDACTED] Database:orders}"},
+		{"struct with empty value", "{Password: Database:./lumel.db DBType:sqlite}", "{Password: Database:./lumel.db DBType:sqlite}"},
+		{"struct with empty value before a secret", "{Password: Token:abc}", "{Password: Token:[REDACTED]}"},
+		{"not a word", "discard=3 cardinality=7 scorecard=9", "discard=3 cardinality=7 scorecard=9"},
+		{"card word", "card=visa cardNumber=x", "card=[REDACTED] cardNumber=[REDACTED]"},
+		{"no value", "password=", "password="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.text(tt.in); got != tt.want {
+				t.Errorf("text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactPatterns(t *testing.T) {
+	r := newTestRedactor(t, Redaction{Patterns: []string{`IBAN\s*(\S+)`}, Mask: "***"})
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"mail ana@example.com now", "mail *** now"},
+		{"sent Bearer abc.def.ghi", "sent Bearer ***"},
+		{"IBAN DE89370400440532013000", "IBAN ***"},
+	}
+	for _, tt := range tests {
+		if got := r.text(tt.in); got != tt.want {
+			t.Errorf("text(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactSensitive(t *testing.T) {
+	r := newTestRedactor(t, Redaction{Fields: []string{"customerAddress"}})
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"password", true},
+		{"DBPassword", true},
+		{"customer_email", true},
+		{"CustomerEmail", true},
+		{"api_key", true},
+		{"apiKey", true},
+		{"X-API-KEY", true},
+		{"Headers", true},
+		{"AUTHORIZATION", true},
+		{"cvv2", true},
+		{"CustomerAddress", true},
+		{"shipping_customer_address", true},
+		{"discard", false},
+		{"cardinality", false},
+		{"scorecard", false},
+		{"keyboard", false},
+		{"DbConMaxOpenConns", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := r.sensitive(tt.key); got != tt.want {
+			t.Errorf("sensitive(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestRedactNestedValues(t *testing.T) {
+	type card struct {
+		Holder string
+		Number string `json:"cardNumber"`
+	}
+	type customer struct {
+		Name     string
+		Email    string
+		Payments []card
+		Password string `json:"password,omitempty"`
+		Note     string
+	}
+	r := newTestRedactor(t, Redaction{})
+
+	got := r.value("customer", customer{
+		Name:     "Ana",
+		Email:    "ana@example.com",
+		Payments: []card{{Holder: "Ana", Number: "4111111111111111"}},
+		Password: "hunter2",
+		Note:     "call back on token=abc",
+	})
+	want := map[string]any{
+		"Name":     "Ana",
+		"Email":    "[REDACTED]",
+		"Payments": []any{map[string]any{"Holder": "Ana", "cardNumber": "[REDACTED]"}},
+		"password": "[REDACTED]",
+		"Note":     "call back on token=[REDACTED]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("value() = %#v\nwant %#v", got, want)
+	}
+
+	if got := r.value("order", map[string]any{"id": 7, "auth": map[string]any{"token": "abc"}}); !reflect.DeepEqual(got,
+		map[string]any{"id": 7, "auth": map[string]any{"token": "[REDACTED]"}}) {
+		t.Errorf("value() of a nested map = %#v", got)
+	}
+	if got := r.value("secretKey", 42); got != "[REDACTED]" {
+		t.Errorf("value() of a sensitive key = %#v", got)
+	}
+	if got := r.value("secretKey", nil); got != nil {
+		t.Errorf("value() of a nil sensitive value = %#v", got)
+	}
+}
+
+func TestRedactLogEntry(t *testing.T) {
+	r := newTestRedactor(t, Redaction{})
+	lEntry := logEntry{
+		Step:   "Login",
+		Msg:    fmt.Sprintf("%+v", struct{ User, Password string }{"ana", "hunter2"}),
+		Fields: map[string]any{"token": "abc", "rows": 5},
+	}
+	r.entry(&lEntry)
+	if lEntry.Msg != "{User:ana Password:[REDACTED]}" {
+		t.Errorf("Msg = %q", lEntry.Msg)
+	}
+	if lEntry.Fields["token"] != "[REDACTED]" || lEntry.Fields["rows"] != 5 {
+		t.Errorf("Fields = %#v", lEntry.Fields)
+	}
+}
+
+// newTestRedactor compiles pSettings the way SetRedaction does and restores the active
+// redactor afterwards.
+func newTestRedactor(t *testing.T, pSettings Redaction) *redactor {
+	t.Helper()
+	lPrevious := activeRedactor.Load()
+	t.Cleanup(func() { activeRedactor.Store(lPrevious) })
+	SetRedaction(pSettings)
+	return activeRedactor.Load()
+}
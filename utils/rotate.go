@@ -0,0 +1,323 @@
+package utils
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"lumelpkg/common"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogRotation is the [Logger.Rotation] section of appconfig.toml. Zero values switch a
+// feature off: no size limit, no interval, no retention limits, no compression, no link.
+type LogRotation struct {
+	Dir        string // folder of the log files, ./log by default
+	MaxSizeMB  int    `validate:"gte=0"`                        // start a new file once the current one reaches this size
+	Interval   string `validate:"omitempty,oneof=hourly daily"` // also start a new file every hour or day
+	MaxFiles   int    `validate:"gte=0"`                        // rotated files kept besides the current one
+	MaxAgeDays int    `validate:"gte=0"`                        // rotated files older than this are deleted
+	Compress   bool   // gzip rotated files
+	Symlink    string // name of a link in Dir that always points at the current file, e.g. "current.log"
+}
+
+const (
+	// logFilePrefix and logFileSuffix frame the name of every log file: logfile<timestamp>.txt
+	logFilePrefix = "logfile"
+	logFileSuffix = ".txt"
+
+	// logFileTimeLayout is the timestamp in a log file name
+	logFileTimeLayout = "02012006.15.04.05.000000000"
+
+	// defaultLogDir is used when Dir is not configured
+	defaultLogDir = "./log"
+)
+
+// rotatingFile is the log output. It appends to Dir/logfile<timestamp>.txt and moves on to a
+// new file when the current one is too big or its interval has passed. Rotated files are
+// compressed and pruned in the background.
+type rotatingFile struct {
+	mu       sync.Mutex
+	settings LogRotation
+	file     *os.File
+	path     string
+	size     int64
+	openedAt time.Time
+}
+
+// logHandoff records where a rotated file ended and which file continues it, so a follow
+// pass can finish the rotated file (or its .gz) and resume in the next one at offset 0
+type logHandoff struct {
+	size int64  // bytes written to the rotated file
+	next string // path of the file written after it
+}
+
+var (
+	// logFile receives every log line once InitLogger has run
+	logFile = new(rotatingFile)
+
+	// cleanupMu lets only one compression/retention pass run at a time
+	cleanupMu sync.Mutex
+
+	// handoffs maps the cleaned path of each rotated file, without .gz, to its handoff;
+	// entries are dropped when retention deletes the file
+	handoffs   = make(map[string]logHandoff)
+	handoffsMu sync.Mutex
+)
+
+// SetLogRotation applies new rotation settings. A changed Dir starts a new file there at once;
+// otherwise the link is refreshed and the existing files are compressed and pruned right away.
+func SetLogRotation(pSettings LogRotation) {
+	logFile.mu.Lock()
+	defer logFile.mu.Unlock()
+
+	lDirChanged := logDir(pSettings) != logDir(logFile.settings)
+	logFile.settings = pSettings
+	if logFile.file == nil {
+		return
+	}
+	if lDirChanged {
+		if lErr := logFile.rotate(); lErr != nil {
+			fmt.Fprintf(os.Stderr, "log rotation: %v\n", lErr)
+		}
+		return
+	}
+	logFile.link()
+	go cleanupLogs(logDir(pSettings), pSettings, logFile.path)
+}
+
+// CurrentLogFile returns the path of the file currently written to.
+func CurrentLogFile() string {
+	logFile.mu.Lock()
+	defer logFile.mu.Unlock()
+	return logFile.path
+}
+
+// LogDir returns the folder the log files are written to.
+func LogDir() string {
+	logFile.mu.Lock()
+	defer logFile.mu.Unlock()
+	return logDir(logFile.settings)
+}
+
+func (r *rotatingFile) Write(pLine []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil || r.due(len(pLine)) {
+		if lErr := r.rotate(); lErr != nil && r.file == nil {
+			return os.Stderr.Write(pLine)
+		}
+	}
+	lWritten, lErr := r.file.Write(pLine)
+	r.size += int64(lWritten)
+	return lWritten, lErr
+}
+
+// due reports whether writing pNext more bytes should go to a new file.
+func (r *rotatingFile) due(pNext int) bool {
+	if lMax := int64(r.settings.MaxSizeMB) << 20; lMax > 0 && r.size > 0 && r.size+int64(pNext) > lMax {
+		return true
+	}
+	lNow := time.Now()
+	switch r.settings.Interval {
+	case "hourly":
+		return !lNow.Truncate(time.Hour).Equal(r.openedAt.Truncate(time.Hour))
+	case "daily":
+		return lNow.YearDay() != r.openedAt.YearDay() || lNow.Year() != r.openedAt.Year()
+	}
+	return false
+}
+
+// rotate opens a fresh log file, points the symlink at it and starts a cleanup pass.
+// The caller holds r.mu.
+func (r *rotatingFile) rotate() error {
+	lDir := logDir(r.settings)
+	if lErr := os.MkdirAll(lDir, 0755); lErr != nil {
+		return lErr
+	}
+	lPath := filepath.Join(lDir, logFilePrefix+time.Now().Format(logFileTimeLayout)+logFileSuffix)
+	lFile, lErr := os.OpenFile(lPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if lErr != nil {
+		return lErr
+	}
+
+	if r.file != nil {
+		r.file.Close()
+		recordHandoff(r.path, logHandoff{size: r.size, next: lPath})
+	}
+	r.file, r.path, r.size, r.openedAt = lFile, lPath, 0, time.Now()
+
+	r.link()
+	go cleanupLogs(lDir, r.settings, lPath)
+	return nil
+}
+
+// link points the configured symlink at the current file. The caller holds r.mu.
+func (r *rotatingFile) link() {
+	if r.settings.Symlink == "" || r.path == "" {
+		return
+	}
+	lLink := filepath.Join(logDir(r.settings), r.settings.Symlink)
+	if lErr := relink(lLink, filepath.Base(r.path)); lErr != nil {
+		fmt.Fprintf(os.Stderr, "log rotation: linking %s: %v\n", lLink, lErr)
+	}
+}
+
+// relink atomically replaces the link pLink with one pointing at pTarget.
+func relink(pLink, pTarget string) error {
+	lTemp := pLink + ".tmp"
+	os.Remove(lTemp)
+	if lErr := os.Symlink(pTarget, lTemp); lErr != nil {
+		return lErr
+	}
+	return os.Rename(lTemp, pLink)
+}
+
+// cleanupLogs compresses the rotated files in pDir when configured and deletes the ones
+// beyond MaxFiles or older than MaxAgeDays. pCurrent is never touched.
+func cleanupLogs(pDir string, pSettings LogRotation, pCurrent string) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+
+	log := new(Logger)
+	log.SetReqID()
+
+	lFiles, lErr := RotatedLogFiles(pDir, pCurrent)
+	if lErr != nil {
+		log.Log(common.ERROR, "LogRotation", "listing log files failed", F("dir", pDir), F("error", lErr))
+		return
+	}
+
+	if pSettings.Compress {
+		for i, lPath := range lFiles {
+			if strings.HasSuffix(lPath, ".gz") {
+				continue
+			}
+			if lErr := gzipFile(lPath); lErr != nil {
+				log.Log(common.ERROR, "LogRotation", "compressing failed", F("file", lPath), F("error", lErr))
+				continue
+			}
+			lFiles[i] = lPath + ".gz"
+		}
+	}
+
+	// Newest first, so the files beyond MaxFiles are the oldest ones
+	lModTimes := make(map[string]time.Time, len(lFiles))
+	for _, lPath := range lFiles {
+		if lInfo, lErr := os.Stat(lPath); lErr == nil {
+			lModTimes[lPath] = lInfo.ModTime()
+		}
+	}
+	sort.Slice(lFiles, func(i, j int) bool { return lModTimes[lFiles[i]].After(lModTimes[lFiles[j]]) })
+
+	lOldest := time.Now().AddDate(0, 0, -pSettings.MaxAgeDays)
+	for i, lPath := range lFiles {
+		lTooMany := pSettings.MaxFiles > 0 && i >= pSettings.MaxFiles
+		lTooOld := pSettings.MaxAgeDays > 0 && lModTimes[lPath].Before(lOldest)
+		if !lTooMany && !lTooOld {
+			continue
+		}
+		if lErr := os.Remove(lPath); lErr != nil {
+			log.Log(common.ERROR, "LogRotation", "deleting failed", F("file", lPath), F("error", lErr))
+			continue
+		}
+		handoffsMu.Lock()
+		delete(handoffs, handoffKey(lPath))
+		handoffsMu.Unlock()
+	}
+}
+
+// recordHandoff remembers how the rotated file pPath ended.
+func recordHandoff(pPath string, pHandoff logHandoff) {
+	handoffsMu.Lock()
+	defer handoffsMu.Unlock()
+	handoffs[handoffKey(pPath)] = pHandoff
+}
+
+// rotatedLogHandoff returns the handoff of pPath, plain or gzipped; ok is false while pPath
+// is still being written or when it was rotated by another process.
+func rotatedLogHandoff(pPath string) (logHandoff, bool) {
+	handoffsMu.Lock()
+	defer handoffsMu.Unlock()
+	lHandoff, ok := handoffs[handoffKey(pPath)]
+	return lHandoff, ok
+}
+
+// handoffKey is the cleaned path of a log file without its .gz suffix.
+func handoffKey(pPath string) string {
+	return filepath.Clean(strings.TrimSuffix(pPath, ".gz"))
+}
+
+// RotatedLogFiles lists the log files in pDir, plain and gzipped, except pCurrent.
+func RotatedLogFiles(pDir, pCurrent string) ([]string, error) {
+	lEntries, lErr := os.ReadDir(pDir)
+	if lErr != nil {
+		return nil, lErr
+	}
+	var lFiles []string
+	for _, lEntry := range lEntries {
+		lName := lEntry.Name()
+		if !lEntry.Type().IsRegular() || !strings.HasPrefix(lName, logFilePrefix) ||
+			!(strings.HasSuffix(lName, logFileSuffix) || strings.HasSuffix(lName, logFileSuffix+".gz")) {
+			continue
+		}
+		lPath := filepath.Join(pDir, lName)
+		if pCurrent != "" && filepath.Clean(lPath) == filepath.Clean(pCurrent) {
+			continue
+		}
+		lFiles = append(lFiles, lPath)
+	}
+	return lFiles, nil
+}
+
+// gzipFile replaces pPath by pPath.gz with the same modification time.
+func gzipFile(pPath string) error {
+	lSource, lErr := os.Open(pPath)
+	if lErr != nil {
+		return lErr
+	}
+	defer lSource.Close()
+	lInfo, lErr := lSource.Stat()
+	if lErr != nil {
+		return lErr
+	}
+
+	lTemp := pPath + ".gz.tmp"
+	lTarget, lErr := os.Create(lTemp)
+	if lErr != nil {
+		return lErr
+	}
+	lZip := gzip.NewWriter(lTarget)
+	lZip.Name = filepath.Base(pPath)
+	lZip.ModTime = lInfo.ModTime()
+	_, lErr = io.Copy(lZip, lSource)
+	if lErr == nil {
+		lErr = lZip.Close()
+	}
+	if lCloseErr := lTarget.Close(); lErr == nil {
+		lErr = lCloseErr
+	}
+	if lErr != nil {
+		os.Remove(lTemp)
+		return lErr
+	}
+
+	if lErr := os.Rename(lTemp, pPath+".gz"); lErr != nil {
+		return lErr
+	}
+	os.Chtimes(pPath+".gz", lInfo.ModTime(), lInfo.ModTime())
+	return os.Remove(pPath)
+}
+
+// logDir returns the configured folder or ./log.
+func logDir(pSettings LogRotation) string {
+	if pSettings.Dir == "" {
+		return defaultLogDir
+	}
+	return pSettings.Dir
+}
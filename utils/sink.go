@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"lumelpkg/common"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogSink is one [Logger.Sinks.<name>] section of appconfig.toml. Every sink gets each entry
+// at or above its own level, in its own format, through its own buffer, so a slow sink only
+// drops its own entries and never blocks the caller of Log.
+type LogSink struct {
+	Type       string `validate:"required,oneof=console file syslog otlp"`
+	Level      string `validate:"omitempty,oneof=DEBUG INFO ERROR debug info error"` // [Logger] Level when empty
+	Format     string `validate:"omitempty,oneof=json text"`                         // [Logger] Format when empty; otlp ignores it
+	BufferSize int    `validate:"gte=0"`                                             // entries queued before new ones are dropped, 4096 by default
+
+	// console
+	Stream string `validate:"omitempty,oneof=stdout stderr"` // stdout by default
+
+	// syslog and otlp
+	Network string            `validate:"omitempty,oneof=unix unixgram udp tcp"` // syslog only; empty uses the local syslog socket
+	Address string            // syslog host:port or socket path; otlp endpoint, http://localhost:4318/v1/logs by default
+	Tag     string            // syslog tag and otlp service.name, lumelpkg by default
+	Headers map[string]string `secret:"true"` // otlp only, e.g. an Authorization header for the collector
+
+	TimeoutMs int `validate:"gte=0"` // otlp request timeout, 5000 by default
+}
+
+// sinkBackend delivers batches of entries to one destination. Backends are only called from
+// the sink's own goroutine.
+type sinkBackend interface {
+	send(pEntries []logEntry) error
+	close() error
+}
+
+const (
+	// defaultSinkBuffer is the queue length of a sink without BufferSize
+	defaultSinkBuffer = 4096
+
+	// maxSinkBatch caps the entries handed to a backend at once
+	maxSinkBatch = 512
+
+	// defaultSinkTag names the service in syslog and OTLP
+	defaultSinkTag = "lumelpkg"
+)
+
+// sink is a running LogSink: a queue drained by one goroutine into a backend
+type sink struct {
+	name    string
+	rank    int32
+	queue   chan logEntry
+	dropped atomic.Int64
+	backend sinkBackend
+	done    chan struct{}
+}
+
+var (
+	// activeSinks receive every entry written by Log
+	activeSinks []*sink
+
+	// sinksMu guards activeSinks; Log holds it for reading while it queues an entry so a
+	// reconfiguration never closes a queue that is being written to
+	sinksMu sync.RWMutex
+)
+
+func init() {
+	// Until InitLogger runs, entries go to stderr, as sub-commands expect
+	lSink := startSink("stderr", 0, defaultSinkBuffer, &lineBackend{writer: os.Stderr})
+	activeSinks = []*sink{lSink}
+}
+
+// SetLogSinks replaces the running sinks by the ones configured in pSettings; without any,
+// the rotated log file is the only sink. The old sinks finish their queued entries in the
+// background. A sink that cannot be set up is reported on stderr and left out.
+func SetLogSinks(pSettings LogSettings) {
+	lConfigs := pSettings.Sinks
+	if len(lConfigs) == 0 {
+		lConfigs = map[string]LogSink{"file": {Type: "file"}}
+	}
+	lNames := make([]string, 0, len(lConfigs))
+	for lName := range lConfigs {
+		lNames = append(lNames, lName)
+	}
+	sort.Strings(lNames)
+
+	var lSinks []*sink
+	lMin := levelRank(common.ERROR)
+	for _, lName := range lNames {
+		lConfig := lConfigs[lName]
+		if lConfig.Level == "" {
+			lConfig.Level = pSettings.Level
+		}
+		if lConfig.Format == "" {
+			lConfig.Format = pSettings.Format
+		}
+		lBackend, lErr := newSinkBackend(lConfig)
+		if lErr != nil {
+			fmt.Fprintf(os.Stderr, "log sink %s: %v\n", lName, lErr)
+			continue
+		}
+		lBuffer := lConfig.BufferSize
+		if lBuffer <= 0 {
+			lBuffer = defaultSinkBuffer
+		}
+		lRank := levelRank(lConfig.Level)
+		lMin = min(lMin, lRank)
+		lSinks = append(lSinks, startSink(lName, lRank, lBuffer, lBackend))
+	}
+	if len(lSinks) == 0 {
+		// Never lose the log completely: fall back to stderr
+		lSinks = append(lSinks, startSink("stderr", 0, defaultSinkBuffer, &lineBackend{writer: os.Stderr}))
+		lMin = 0
+	}
+
+	sinksMu.Lock()
+	lOld := activeSinks
+	activeSinks = lSinks
+	minLevel.Store(lMin)
+	sinksMu.Unlock()
+
+	for _, lSink := range lOld {
+		close(lSink.queue)
+	}
+}
+
+// CloseLogs stops every sink and waits up to pTimeout for the queued entries to be written.
+// Call it before the process exits; entries logged afterwards are dropped.
+func CloseLogs(pTimeout time.Duration) {
+	sinksMu.Lock()
+	lOld := activeSinks
+	activeSinks = nil
+	sinksMu.Unlock()
+
+	lDeadline := time.After(pTimeout)
+	for _, lSink := range lOld {
+		close(lSink.queue)
+	}
+	for _, lSink := range lOld {
+		select {
+		case <-lSink.done:
+		case <-lDeadline:
+			return
+		}
+	}
+}
+
+// dispatch queues an entry on every sink whose level it reaches. A full queue drops the
+// entry and counts it; the sink reports the count once it catches up.
+func dispatch(pEntry logEntry) {
+	lRank, lKnown := logLevels[pEntry.Level]
+
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	for _, lSink := range activeSinks {
+		if lKnown && lRank < lSink.rank {
+			continue
+		}
+		select {
+		case lSink.queue <- pEntry:
+		default:
+			lSink.dropped.Add(1)
+		}
+	}
+}
+
+// startSink starts the goroutine that drains a new sink into pBackend.
+func startSink(pName string, pRank int32, pBuffer int, pBackend sinkBackend) *sink {
+	lSink := &sink{
+		name:    pName,
+		rank:    pRank,
+		queue:   make(chan logEntry, pBuffer),
+		backend: pBackend,
+		done:    make(chan struct{}),
+	}
+	go lSink.run()
+	return lSink
+}
+
+// run sends the queued entries in batches until the queue is closed. Delivery errors are
+// reported on stderr once when they start and once when the sink recovers.
+func (s *sink) run() {
+	defer close(s.done)
+	defer s.backend.close()
+
+	var lFailing bool
+	lBatch := make([]logEntry, 0, maxSinkBatch)
+	for lEntry := range s.queue {
+		lBatch = append(lBatch[:0], lEntry)
+	drain:
+		for len(lBatch) < maxSinkBatch {
+			select {
+			case lNext, ok := <-s.queue:
+				if !ok {
+					break drain
+				}
+				lBatch = append(lBatch, lNext)
+			default:
+				break drain
+			}
+		}
+		if lDropped := s.dropped.Swap(0); lDropped > 0 {
+			lBatch = append(lBatch, droppedEntry(lDropped))
+		}
+
+		lErr := s.backend.send(lBatch)
+		switch {
+		case lErr != nil && !lFailing:
+			fmt.Fprintf(os.Stderr, "log sink %s: %v\n", s.name, lErr)
+		case lErr == nil && lFailing:
+			fmt.Fprintf(os.Stderr, "log sink %s: recovered\n", s.name)
+		}
+		lFailing = lErr != nil
+	}
+}
+
+// droppedEntry tells a sink's readers that entries were lost because it fell behind.
+func droppedEntry(pCount int64) logEntry {
+	lNow := time.Now()
+	return logEntry{
+		Time:   lNow.UTC().Format(entryTimeLayout),
+		Level:  common.ERROR,
+		Step:   "LogSink",
+		Msg:    "entries dropped, the sink could not keep up",
+		Fields: map[string]any{"dropped": pCount},
+		at:     lNow,
+	}
+}
+
+// newSinkBackend opens the destination of a sink.
+func newSinkBackend(pConfig LogSink) (sinkBackend, error) {
+	lText := pConfig.Format == "text"
+	switch pConfig.Type {
+	case "console":
+		if pConfig.Stream == "stderr" {
+			return &lineBackend{writer: os.Stderr, text: lText}, nil
+		}
+		return &lineBackend{writer: os.Stdout, text: lText}, nil
+	case "file":
+		return &lineBackend{writer: logFile, text: lText}, nil
+	case "syslog":
+		return newSyslogBackend(pConfig, lText)
+	case "otlp":
+		return newOTLPBackend(pConfig)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", pConfig.Type)
+}
+
+// lineBackend writes one formatted entry per line to a console or the rotated log file
+type lineBackend struct {
+	writer io.Writer
+	text   bool
+	buffer []byte
+}
+
+func (b *lineBackend) send(pEntries []logEntry) error {
+	// One write per batch; the rotated file still sees whole lines
+	b.buffer = b.buffer[:0]
+	for _, lEntry := range pEntries {
+		b.buffer = append(b.buffer, formatEntry(lEntry, b.text)...)
+		b.buffer = append(b.buffer, '\n')
+	}
+	_, lErr := b.writer.Write(b.buffer)
+	return lErr
+}
+
+// close leaves the console and the shared log file open for the next set of sinks.
+func (b *lineBackend) close() error { return nil }
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"lumelpkg/common"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultOTLPEndpoint is the logs path of a local OpenTelemetry collector (OTLP/HTTP)
+const defaultOTLPEndpoint = "http://localhost:4318/v1/logs"
+
+// otlpSeverity maps the levels to OpenTelemetry severity numbers
+var otlpSeverity = map[string]int{
+	common.DEBUG: 5,
+	common.INFO:  9,
+	common.ERROR: 17,
+}
+
+// otlpBackend posts batches of entries as an OTLP/HTTP JSON logs request
+type otlpBackend struct {
+	endpoint string
+	service  string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// newOTLPBackend prepares the exporter; nothing is sent until the first batch.
+func newOTLPBackend(pConfig LogSink) (sinkBackend, error) {
+	lBackend := &otlpBackend{
+		endpoint: pConfig.Address,
+		service:  pConfig.Tag,
+		headers:  pConfig.Headers,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+	if lBackend.endpoint == "" {
+		lBackend.endpoint = defaultOTLPEndpoint
+	}
+	if lBackend.service == "" {
+		lBackend.service = defaultSinkTag
+	}
+	if pConfig.TimeoutMs > 0 {
+		lBackend.client.Timeout = time.Duration(pConfig.TimeoutMs) * time.Millisecond
+	}
+	return lBackend, nil
+}
+
+// otlpValue is an OTLP AnyValue; exactly one member is set
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 travels as a string in OTLP JSON
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// otlpAttribute is an OTLP KeyValue
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// otlpRecord is an OTLP LogRecord
+type otlpRecord struct {
+	TimeUnixNano   string          `json:"timeUnixNano"`
+	SeverityNumber int             `json:"severityNumber,omitempty"`
+	SeverityText   string          `json:"severityText"`
+	Body           otlpValue       `json:"body"`
+	Attributes     []otlpAttribute `json:"attributes,omitempty"`
+}
+
+func (b *otlpBackend) send(pEntries []logEntry) error {
+	lRecords := make([]otlpRecord, 0, len(pEntries))
+	for _, lEntry := range pEntries {
+		lAttributes := []otlpAttribute{{Key: "step", Value: otlpAny(lEntry.Step)}}
+		if lEntry.ReqID != "" {
+			lAttributes = append(lAttributes, otlpAttribute{Key: "reqId", Value: otlpAny(lEntry.ReqID)})
+		}
+		lKeys := make([]string, 0, len(lEntry.Fields))
+		for lKey := range lEntry.Fields {
+			lKeys = append(lKeys, lKey)
+		}
+		sort.Strings(lKeys)
+		for _, lKey := range lKeys {
+			lAttributes = append(lAttributes, otlpAttribute{Key: lKey, Value: otlpAny(lEntry.Fields[lKey])})
+		}
+
+		lRecords = append(lRecords, otlpRecord{
+			TimeUnixNano:   strconv.FormatInt(lEntry.at.UnixNano(), 10),
+			SeverityNumber: otlpSeverity[lEntry.Level],
+			SeverityText:   lEntry.Level,
+			Body:           otlpAny(lEntry.Msg),
+			Attributes:     lAttributes,
+		})
+	}
+
+	lRequest := map[string]any{
+		"resourceLogs": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []otlpAttribute{{Key: "service.name", Value: otlpAny(b.service)}},
+			},
+			"scopeLogs": []any{map[string]any{
+				"scope":      map[string]any{"name": "lumelpkg/utils"},
+				"logRecords": lRecords,
+			}},
+		}},
+	}
+	lBody, lErr := json.Marshal(lRequest)
+	if lErr != nil {
+		return lErr
+	}
+
+	lHttpRequest, lErr := http.NewRequest(http.MethodPost, b.endpoint, bytes.NewReader(lBody))
+	if lErr != nil {
+		return lErr
+	}
+	lHttpRequest.Header.Set("Content-Type", "application/json")
+	for lKey, lValue := range b.headers {
+		lHttpRequest.Header.Set(lKey, lValue)
+	}
+	lResponse, lErr := b.client.Do(lHttpRequest)
+	if lErr != nil {
+		return lErr
+	}
+	defer lResponse.Body.Close()
+	io.Copy(io.Discard, lResponse.Body)
+	if lResponse.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", b.endpoint, lResponse.Status)
+	}
+	return nil
+}
+
+func (b *otlpBackend) close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// otlpAny converts a field value to an OTLP AnyValue; maps, slices and other values are
+// sent as their JSON text.
+func otlpAny(pValue any) otlpValue {
+	switch lValue := pValue.(type) {
+	case string:
+		return otlpValue{StringValue: &lValue}
+	case bool:
+		return otlpValue{BoolValue: &lValue}
+	case int:
+		lText := strconv.FormatInt(int64(lValue), 10)
+		return otlpValue{IntValue: &lText}
+	case int64:
+		lText := strconv.FormatInt(lValue, 10)
+		return otlpValue{IntValue: &lText}
+	case int32:
+		lText := strconv.FormatInt(int64(lValue), 10)
+		return otlpValue{IntValue: &lText}
+	case float64:
+		return otlpValue{DoubleValue: &lValue}
+	case float32:
+		lDouble := float64(lValue)
+		return otlpValue{DoubleValue: &lDouble}
+	}
+	lText := fmt.Sprintf("%v", pValue)
+	if lJSON, lErr := json.Marshal(pValue); lErr == nil {
+		lText = string(lJSON)
+	}
+	return otlpValue{StringValue: &lText}
+}
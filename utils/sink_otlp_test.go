@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"lumelpkg/common"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// otlpRequest is the part of an OTLP/HTTP JSON logs request the tests look at
+type otlpRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			LogRecords []otlpRecord `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+// records returns every log record of the request.
+func (r otlpRequest) records() []otlpRecord {
+	var lRecords []otlpRecord
+	for _, lResource := range r.ResourceLogs {
+		for _, lScope := range lResource.ScopeLogs {
+			lRecords = append(lRecords, lScope.LogRecords...)
+		}
+	}
+	return lRecords
+}
+
+// otlpCollector is an httptest collector that keeps every request it receives. The first
+// failures requests are answered with 503.
+type otlpCollector struct {
+	mu       sync.Mutex
+	failures int
+	headers  []http.Header
+	requests []otlpRequest
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var lRequest otlpRequest
+	lErr := json.NewDecoder(r.Body).Decode(&lRequest)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if lErr != nil || r.Method != http.MethodPost || r.URL.Path != "/v1/logs" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	c.headers = append(c.headers, r.Header.Clone())
+	c.requests = append(c.requests, lRequest)
+	if len(c.requests) <= c.failures {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}
+}
+
+func TestOTLPPayload(t *testing.T) {
+	lCollector := &otlpCollector{}
+	lServer := httptest.NewServer(lCollector)
+	defer lServer.Close()
+
+	lBackend, lErr := newOTLPBackend(LogSink{
+		Type:    "otlp",
+		Address: lServer.URL + "/v1/logs",
+		Tag:     "orders",
+		Headers: map[string]string{"Authorization": "Bearer abc", "X-Scope-OrgID": "lumel"},
+	})
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	defer lBackend.close()
+
+	lAt := time.Date(2025, 5, 17, 10, 21, 3, 500, time.UTC)
+	lErr = lBackend.send([]logEntry{
+		{
+			Level:  common.INFO,
+			ReqID:  "req-1",
+			Step:   "LoadCSV",
+			Msg:    "file loaded",
+			Fields: map[string]any{"rows": 5, "ok": true, "ratio": 0.5, "files": []string{"a.csv"}},
+			at:     lAt,
+		},
+		{Level: common.ERROR, Step: "Refresh", Msg: "refresh failed", at: lAt},
+	})
+	if lErr != nil {
+		t.Fatalf("send() = %v", lErr)
+	}
+
+	if len(lCollector.requests) != 1 {
+		t.Fatalf("collector got %d requests, want 1", len(lCollector.requests))
+	}
+	lHeader := lCollector.headers[0]
+	for lKey, lWant := range map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": "Bearer abc",
+		"X-Scope-OrgID": "lumel",
+	} {
+		if lGot := lHeader.Get(lKey); lGot != lWant {
+			t.Errorf("header %s = %q, want %q", lKey, lGot, lWant)
+		}
+	}
+
+	lRequest := lCollector.requests[0]
+	if len(lRequest.ResourceLogs) != 1 || len(lRequest.ResourceLogs[0].ScopeLogs) != 1 {
+		t.Fatalf("request = %+v, want one resource with one scope", lRequest)
+	}
+	if lAttributes := lRequest.ResourceLogs[0].Resource.Attributes; len(lAttributes) != 1 ||
+		lAttributes[0].Key != "service.name" || *lAttributes[0].Value.StringValue != "orders" {
+		t.Errorf("resource attributes = %+v, want service.name orders", lAttributes)
+	}
+	if lScope := lRequest.ResourceLogs[0].ScopeLogs[0].Scope.Name; lScope != "lumelpkg/utils" {
+		t.Errorf("scope = %q", lScope)
+	}
+
+	lRecords := lRequest.records()
+	if len(lRecords) != 2 {
+		t.Fatalf("got %d records, want 2", len(lRecords))
+	}
+	lRecord := lRecords[0]
+	if lRecord.TimeUnixNano != "1747477263000000500" {
+		t.Errorf("timeUnixNano = %q", lRecord.TimeUnixNano)
+	}
+	if lRecord.SeverityNumber != 9 || lRecord.SeverityText != common.INFO {
+		t.Errorf("severity = %d %q, want 9 INFO", lRecord.SeverityNumber, lRecord.SeverityText)
+	}
+	if *lRecord.Body.StringValue != "file loaded" {
+		t.Errorf("body = %q", *lRecord.Body.StringValue)
+	}
+	lWant := []otlpAttribute{
+		{Key: "step", Value: otlpAny("LoadCSV")},
+		{Key: "reqId", Value: otlpAny("req-1")},
+		{Key: "files", Value: otlpAny(`["a.csv"]`)},
+		{Key: "ok", Value: otlpAny(true)},
+		{Key: "ratio", Value: otlpAny(0.5)},
+		{Key: "rows", Value: otlpAny(5)},
+	}
+	if !reflect.DeepEqual(lRecord.Attributes, lWant) {
+		lGot, _ := json.Marshal(lRecord.Attributes)
+		lWantJSON, _ := json.Marshal(lWant)
+		t.Errorf("attributes = %s\nwant %s", lGot, lWantJSON)
+	}
+
+	if lRecords[1].SeverityNumber != 17 || len(lRecords[1].Attributes) != 1 {
+		t.Errorf("second record = %+v, want severity 17 and only the step", lRecords[1])
+	}
+}
+
+func TestOTLPAny(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{"text", `{"stringValue":"text"}`},
+		{true, `{"boolValue":true}`},
+		{42, `{"intValue":"42"}`},
+		{int64(1) << 40, `{"intValue":"1099511627776"}`},
+		{int32(-3), `{"intValue":"-3"}`},
+		{1.5, `{"doubleValue":1.5}`},
+		{float32(0.25), `{"doubleValue":0.25}`},
+		{map[string]int{"a": 1}, `{"stringValue":"{\"a\":1}"}`},
+		{nil, `{"stringValue":"null"}`},
+	}
+	for _, tt := range tests {
+		lGot, _ := json.Marshal(otlpAny(tt.in))
+		if string(lGot) != tt.want {
+			t.Errorf("otlpAny(%#v) = %s, want %s", tt.in, lGot, tt.want)
+		}
+	}
+}
+
+func TestOTLPSinkBatches(t *testing.T) {
+	lCollector := &otlpCollector{}
+	lServer := httptest.NewServer(lCollector)
+	defer lServer.Close()
+
+	lStderr := runOTLPSink(t, lServer.URL+"/v1/logs", maxSinkBatch+88)
+	if lStderr != "" {
+		t.Errorf("stderr = %q, want nothing", lStderr)
+	}
+
+	var lSizes []int
+	for _, lRequest := range lCollector.requests {
+		lSizes = append(lSizes, len(lRequest.records()))
+	}
+	if !reflect.DeepEqual(lSizes, []int{maxSinkBatch, 88}) {
+		t.Errorf("batch sizes = %v, want [%d 88]", lSizes, maxSinkBatch)
+	}
+	lRecords := lCollector.requests[1].records()
+	if lLast := *lRecords[len(lRecords)-1].Body.StringValue; lLast != "entry 599" {
+		t.Errorf("last record = %q, want entry 599", lLast)
+	}
+}
+
+func TestOTLPSinkCollectorDown(t *testing.T) {
+	lServer := httptest.NewServer(&otlpCollector{})
+	lEndpoint := lServer.URL + "/v1/logs"
+	lServer.Close()
+
+	// Three failed batches are reported once
+	lStderr := runOTLPSink(t, lEndpoint, 3*maxSinkBatch)
+	if strings.Count(lStderr, "log sink otlp:") != 1 {
+		t.Errorf("stderr = %q, want the send error once", lStderr)
+	}
+	if strings.Contains(lStderr, "recovered") {
+		t.Errorf("stderr = %q, the collector never came back", lStderr)
+	}
+}
+
+func TestOTLPSinkRecovers(t *testing.T) {
+	lCollector := &otlpCollector{failures: 2}
+	lServer := httptest.NewServer(lCollector)
+	defer lServer.Close()
+
+	lStderr := runOTLPSink(t, lServer.URL+"/v1/logs", 4*maxSinkBatch)
+	lWant := "log sink otlp: " + lServer.URL + "/v1/logs answered 503 Service Unavailable\n" +
+		"log sink otlp: recovered\n"
+	if lStderr != lWant {
+		t.Errorf("stderr = %q, want %q", lStderr, lWant)
+	}
+	if len(lCollector.requests) != 4 {
+		t.Errorf("collector got %d requests, want 4", len(lCollector.requests))
+	}
+}
+
+// runOTLPSink queues pCount entries on a sink posting to pEndpoint, drains it to the end and
+// returns what the sink wrote on stderr.
+func runOTLPSink(t *testing.T, pEndpoint string, pCount int) string {
+	t.Helper()
+	lBackend, lErr := newOTLPBackend(LogSink{Type: "otlp", Address: pEndpoint, TimeoutMs: 2000})
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	// The queue is filled and closed before run, so the batches do not depend on timing
+	lSink := &sink{name: "otlp", queue: make(chan logEntry, pCount), backend: lBackend, done: make(chan struct{})}
+	for i := 0; i < pCount; i++ {
+		lSink.queue <- logEntry{Level: common.INFO, Step: "Test", Msg: "entry " + strconv.Itoa(i), at: time.Now()}
+	}
+	close(lSink.queue)
+
+	lReader, lWriter, lErr := os.Pipe()
+	if lErr != nil {
+		t.Fatal(lErr)
+	}
+	lStderr := os.Stderr
+	os.Stderr = lWriter
+	lSink.run()
+	os.Stderr = lStderr
+	lWriter.Close()
+
+	lOutput, _ := io.ReadAll(lReader)
+	lReader.Close()
+	return string(lOutput)
+}
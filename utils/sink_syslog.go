@@ -0,0 +1,49 @@
+//go:build !windows && !plan9
+
+package utils
+
+import (
+	"log/syslog"
+	"lumelpkg/common"
+)
+
+// syslogBackend writes entries to a syslog daemon with a severity matching their level
+type syslogBackend struct {
+	writer *syslog.Writer
+	text   bool
+}
+
+// newSyslogBackend connects to the local syslog socket, or to Network/Address when set.
+func newSyslogBackend(pConfig LogSink, pText bool) (sinkBackend, error) {
+	lTag := pConfig.Tag
+	if lTag == "" {
+		lTag = defaultSinkTag
+	}
+	lWriter, lErr := syslog.Dial(pConfig.Network, pConfig.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, lTag)
+	if lErr != nil {
+		return nil, lErr
+	}
+	return &syslogBackend{writer: lWriter, text: pText}, nil
+}
+
+func (b *syslogBackend) send(pEntries []logEntry) error {
+	var lFirstErr error
+	for _, lEntry := range pEntries {
+		lLine := formatEntry(lEntry, b.text)
+		var lErr error
+		switch lEntry.Level {
+		case common.DEBUG:
+			lErr = b.writer.Debug(lLine)
+		case common.ERROR:
+			lErr = b.writer.Err(lLine)
+		default:
+			lErr = b.writer.Info(lLine)
+		}
+		if lErr != nil && lFirstErr == nil {
+			lFirstErr = lErr
+		}
+	}
+	return lFirstErr
+}
+
+func (b *syslogBackend) close() error { return b.writer.Close() }
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package utils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newSyslogBackend fails: log/syslog is not available on this platform.
+func newSyslogBackend(pConfig LogSink, pText bool) (sinkBackend, error) {
+	return nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}